@@ -0,0 +1,138 @@
+package account
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Source 账号来源
+type Source string
+
+const (
+	SourceEnv   Source = "env"   // 来自 MONICA_COOKIE / MONICA_COOKIES，运行时只能停用或启用
+	SourceFile  Source = "file"  // 来自账号文件，可以通过管理接口修改并写回文件
+	SourceStore Source = "store" // 来自加密凭据库，可以通过管理接口修改并写回凭据库
+)
+
+// Account 一个 Monica 账号（cookie），记录自身的并发数与调用统计。
+// 管理接口修改 cookie、权重等配置时创建新的 Account 替换旧的，新旧对象共享 runtime，
+// 正在使用旧对象的请求释放时仍计入同一份并发数与统计
+type Account struct {
+	ID             string
+	Cookie         string
+	Weight         int       // weighted 策略下的权重，最小为 1
+	MaxConcurrency int       // 账号的并发上限，为 0 时使用全局的 ACCOUNT_MAX_CONCURRENCY
+	ExpiresAt      time.Time // 从 cookie 解析出的过期时间，无法解析时为零值
+	Proxy          string    // 访问 Monica 使用的上游代理，为空时使用全局代理，为 direct 时直接连接
+	Source         Source
+
+	*runtime
+}
+
+// runtime 账号的运行时状态
+type runtime struct {
+	inFlight atomic.Int64
+	disabled atomic.Bool
+
+	mu              sync.Mutex
+	stats           Stats
+	health          health
+	expiryWarnedFor time.Time // 已经为该过期时间发出过预警
+}
+
+// Stats 账号调用统计
+type Stats struct {
+	Requests    int64     `json:"requests"`
+	Successes   int64     `json:"successes"`
+	Failures    int64     `json:"failures"`
+	Canceled    int64     `json:"canceled"` // 客户端取消的请求，不计入失败
+	LastError   string    `json:"last_error,omitempty"`
+	LastErrorAt time.Time `json:"last_error_at,omitempty"`
+	LastUsedAt  time.Time `json:"last_used_at,omitempty"`
+}
+
+// NewAccount 创建账号，id 为空时根据 cookie 生成稳定的 ID
+func NewAccount(id, cookie string, weight int) *Account {
+	if id == "" {
+		id = CookieID(cookie)
+	}
+	if weight <= 0 {
+		weight = 1
+	}
+	expiresAt, _ := CookieExpiry(cookie)
+	return &Account{ID: id, Cookie: cookie, Weight: weight, ExpiresAt: expiresAt, runtime: &runtime{}}
+}
+
+// CookieID 根据 cookie 生成账号 ID，避免在日志与管理接口中暴露 cookie 本身
+func CookieID(cookie string) string {
+	sum := sha256.Sum256([]byte(cookie))
+	return "acc_" + hex.EncodeToString(sum[:])[:12]
+}
+
+// Acquire 标记一个请求开始使用该账号
+func (a *Account) Acquire() {
+	a.inFlight.Add(1)
+	a.mu.Lock()
+	a.stats.Requests++
+	a.stats.LastUsedAt = time.Now()
+	a.mu.Unlock()
+}
+
+// Release 标记请求结束，err 不为空时记录为失败，客户端取消的请求单独计数
+func (a *Account) Release(err error) {
+	a.inFlight.Add(-1)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var upErr *UpstreamError
+	if errors.As(err, &upErr) && upErr.Outcome == OutcomeCanceled {
+		a.stats.Canceled++
+		return
+	}
+	if err != nil {
+		a.stats.Failures++
+		a.stats.LastError = err.Error()
+		a.stats.LastErrorAt = time.Now()
+		return
+	}
+	a.stats.Successes++
+}
+
+// InFlight 返回当前正在使用该账号的请求数
+func (a *Account) InFlight() int64 {
+	return a.inFlight.Load()
+}
+
+// Disabled 返回账号是否被手动停用，停用的账号不参与选择与健康检查
+func (a *Account) Disabled() bool {
+	return a.disabled.Load()
+}
+
+// SetDisabled 停用或启用账号
+func (a *Account) SetDisabled(disabled bool) {
+	a.disabled.Store(disabled)
+}
+
+// Stats 返回调用统计快照
+func (a *Account) Stats() Stats {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.stats
+}
+
+type contextKey struct{}
+
+// WithAccount 将本次请求使用的账号放入 context，供上传图片、发送对话等上游调用读取
+func WithAccount(ctx context.Context, a *Account) context.Context {
+	return context.WithValue(ctx, contextKey{}, a)
+}
+
+// FromContext 返回 context 中的账号，不存在时返回 nil
+func FromContext(ctx context.Context) *Account {
+	a, _ := ctx.Value(contextKey{}).(*Account)
+	return a
+}
@@ -0,0 +1,95 @@
+package account
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"monica-proxy/internal/utils"
+)
+
+// Record 可持久化的账号条目，账号文件与加密凭据库使用相同的格式
+type Record struct {
+	ID             string `json:"id"`
+	Cookie         string `json:"cookie"`
+	Weight         int    `json:"weight"`
+	MaxConcurrency int    `json:"max_concurrency,omitempty"`
+	Proxy          string `json:"proxy,omitempty"`
+	Disabled       bool   `json:"disabled,omitempty"`
+}
+
+// Backend 可写回的账号来源，管理接口的修改通过它持久化
+type Backend interface {
+	Source() Source
+	Load() ([]Record, error)
+	Save(records []Record) error
+}
+
+func (a *Account) record() Record {
+	return Record{ID: a.ID, Cookie: a.Cookie, Weight: a.Weight, MaxConcurrency: a.MaxConcurrency, Proxy: a.Proxy, Disabled: a.Disabled()}
+}
+
+// loadBackend 读取来源中的账号
+func loadBackend(b Backend) ([]*Account, error) {
+	records, err := b.Load()
+	if err != nil {
+		return nil, err
+	}
+	accounts := make([]*Account, 0, len(records))
+	for i, r := range records {
+		if r.Cookie == "" {
+			return nil, fmt.Errorf("%s account entry %d has no cookie", b.Source(), i)
+		}
+		a := NewAccount(r.ID, r.Cookie, r.Weight)
+		a.Source = b.Source()
+		a.MaxConcurrency = max(r.MaxConcurrency, 0)
+		if _, err := utils.ParseProxy(r.Proxy); err != nil {
+			return nil, fmt.Errorf("%s account %s: %v", b.Source(), a.ID, err)
+		}
+		a.Proxy = r.Proxy
+		a.SetDisabled(r.Disabled)
+		accounts = append(accounts, a)
+	}
+	return accounts, nil
+}
+
+// FileBackend JSON 格式的账号文件：[{"id": "...", "cookie": "...", "weight": 1}]
+type FileBackend struct {
+	Path string
+}
+
+func (f *FileBackend) Source() Source {
+	return SourceFile
+}
+
+// Load 读取账号文件，文件不存在时视为没有账号，之后可以通过管理接口添加
+func (f *FileBackend) Load() ([]Record, error) {
+	data, err := os.ReadFile(f.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read accounts file failed: %v", err)
+	}
+	var records []Record
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, fmt.Errorf("parse accounts file failed: %v", err)
+	}
+	return records, nil
+}
+
+// Save 写回账号文件
+func (f *FileBackend) Save(records []Record) error {
+	if records == nil {
+		records = []Record{}
+	}
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := utils.WriteFileAtomic(f.Path, data); err != nil {
+		return fmt.Errorf("write accounts file failed: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+package account
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// expiryCheckInterval 后台检查 cookie 过期时间的间隔
+const expiryCheckInterval = time.Hour
+
+// webhookClient 发送过期通知的客户端。webhook 是运维配置的内部服务，不经过 Monica 的上游代理，
+// 并且校验 TLS 证书
+var webhookClient = resty.New().SetTimeout(10 * time.Second)
+
+// ErrCookieExpired cookie 已过期
+var ErrCookieExpired = errors.New("monica cookie has expired")
+
+// CookieExpiry 从 cookie 中的 session_id 解析过期时间。session_id 是 JWT 格式的令牌，
+// 过期时间为 payload 中的 exp 字段（Unix 秒）；无法解析时返回 false
+func CookieExpiry(cookie string) (time.Time, bool) {
+	token := cookie
+	for _, part := range strings.Split(cookie, ";") {
+		name, value, found := strings.Cut(strings.TrimSpace(part), "=")
+		if found && name == "session_id" {
+			token = value
+			break
+		}
+	}
+
+	segments := strings.Split(token, ".")
+	if len(segments) < 2 {
+		return time.Time{}, false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(segments[1], "="))
+	if err != nil {
+		return time.Time{}, false
+	}
+	var claims struct {
+		Exp float64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Exp <= 0 {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(claims.Exp), 0), true
+}
+
+// Expiry cookie 过期信息
+type Expiry struct {
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+	DaysLeft  float64   `json:"days_left,omitempty"`
+	Expired   bool      `json:"expired"`
+	Warning   bool      `json:"warning"` // 距离过期不足 warnBefore
+}
+
+// Expiry 返回 cookie 的过期信息，无法解析过期时间时 ExpiresAt 为零值
+func (a *Account) Expiry(warnBefore time.Duration) Expiry {
+	if a.ExpiresAt.IsZero() {
+		return Expiry{}
+	}
+	left := time.Until(a.ExpiresAt)
+	return Expiry{
+		ExpiresAt: a.ExpiresAt,
+		DaysLeft:  float64(int(left.Hours()/24*10)) / 10,
+		Expired:   left <= 0,
+		Warning:   left <= warnBefore,
+	}
+}
+
+// ExpiryOf 按账号池的预警天数返回账号的过期信息
+func (p *Pool) ExpiryOf(a *Account) Expiry {
+	return a.Expiry(p.expiryWarn)
+}
+
+// checkExpiry 检查账号的 cookie 是否已过期
+func checkExpiry(a *Account) error {
+	if !a.ExpiresAt.IsZero() && time.Now().After(a.ExpiresAt) {
+		return fmt.Errorf("account %s: %w at %s", a.ID, ErrCookieExpired, a.ExpiresAt.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// ExpiryNotifier 账号即将过期时的通知
+type ExpiryNotifier func(ctx context.Context, a *Account, expiry Expiry) error
+
+// ExpiryWebhook 返回向 url 发送 JSON 通知的 ExpiryNotifier，响应码为 2xx 时视为成功
+func ExpiryWebhook(url string) ExpiryNotifier {
+	return func(ctx context.Context, a *Account, expiry Expiry) error {
+		event := "account_expiring"
+		if expiry.Expired {
+			event = "account_expired"
+		}
+		resp, err := webhookClient.R().
+			SetContext(ctx).
+			SetBody(map[string]any{
+				"event":      event,
+				"account_id": a.ID,
+				"expires_at": expiry.ExpiresAt,
+				"days_left":  expiry.DaysLeft,
+			}).
+			Post(url)
+		if err != nil {
+			return err
+		}
+		if !resp.IsSuccess() {
+			return fmt.Errorf("webhook returned status %d", resp.StatusCode())
+		}
+		return nil
+	}
+}
+
+// warnExpiry 账号进入预警期或已过期时输出日志并通知，同一过期时间只通知一次，通知失败时下次检查重试
+func (a *Account) warnExpiry(ctx context.Context, warnBefore time.Duration, notify ExpiryNotifier) {
+	expiry := a.Expiry(warnBefore)
+	if !expiry.Warning {
+		return
+	}
+	if expiry.Expired {
+		a.Observe(OutcomeAuthExpired, "cookie expired at "+expiry.ExpiresAt.Format(time.RFC3339))
+	}
+
+	a.mu.Lock()
+	warned := a.expiryWarnedFor.Equal(a.ExpiresAt)
+	a.mu.Unlock()
+	if warned {
+		return
+	}
+
+	if expiry.Expired {
+		log.Printf("Account %s cookie expired at %s, please renew it", a.ID, expiry.ExpiresAt.Format(time.RFC3339))
+	} else {
+		log.Printf("Account %s cookie expires at %s (%.1f days left), please renew it", a.ID, expiry.ExpiresAt.Format(time.RFC3339), expiry.DaysLeft)
+	}
+	if notify != nil {
+		if err := notify(ctx, a, expiry); err != nil {
+			log.Printf("Account %s expiry notification failed, will retry: %v", a.ID, err)
+			return
+		}
+	}
+
+	a.mu.Lock()
+	a.expiryWarnedFor = expiry.ExpiresAt
+	a.mu.Unlock()
+}
+
+// StartExpiryCheck 在后台立即检查一次，之后定期检查全部账号的 cookie 过期时间，ctx 结束时停止。
+// notify 为 nil 时只输出日志
+func (p *Pool) StartExpiryCheck(ctx context.Context, notify ExpiryNotifier) {
+	checkAll := func() {
+		for _, a := range p.Accounts() {
+			if !a.Disabled() {
+				a.warnExpiry(ctx, p.expiryWarn, notify)
+			}
+		}
+	}
+
+	go func() {
+		checkAll()
+		ticker := time.NewTicker(expiryCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				checkAll()
+			}
+		}
+	}()
+}
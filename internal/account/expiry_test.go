@@ -0,0 +1,38 @@
+package account
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestExpiryWebhookRetriesFailedNotification(t *testing.T) {
+	status := http.StatusInternalServerError
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	a := NewAccount("a", "session_id=a", 1)
+	a.ExpiresAt = time.Now().Add(24 * time.Hour)
+	notify := ExpiryWebhook(srv.URL)
+	ctx := context.Background()
+
+	// 通知失败时不记录，下次检查重试
+	a.warnExpiry(ctx, 7*24*time.Hour, notify)
+	if calls != 1 || !a.expiryWarnedFor.IsZero() {
+		t.Fatalf("calls = %d, warned for %v after failed notification", calls, a.expiryWarnedFor)
+	}
+
+	// 204 等 2xx 响应视为成功，之后不再重复通知
+	status = http.StatusNoContent
+	a.warnExpiry(ctx, 7*24*time.Hour, notify)
+	a.warnExpiry(ctx, 7*24*time.Hour, notify)
+	if calls != 2 || !a.expiryWarnedFor.Equal(a.ExpiresAt) {
+		t.Fatalf("calls = %d, warned for %v, want 2 calls and a recorded warning", calls, a.expiryWarnedFor)
+	}
+}
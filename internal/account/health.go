@@ -0,0 +1,310 @@
+package account
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// State 账号健康状态
+type State string
+
+const (
+	StateHealthy     State = "healthy"      // 正常
+	StateDegraded    State = "degraded"     // 偶发失败，仍可使用，但优先选择健康账号
+	StateCoolingDown State = "cooling_down" // 限流或额度耗尽，冷却期内不参与选择
+	StateDead        State = "dead"         // cookie 失效，需要人工更换
+)
+
+const (
+	coolDown          = 5 * time.Minute // 限流或连续失败后的冷却时间
+	creditCoolDown    = time.Hour       // 额度耗尽后的冷却时间
+	maxFailures       = 3               // 连续失败达到该次数后进入冷却
+	maxTransitions    = 20              // 每个账号保留的状态变更记录数
+	probeTimeout      = 15 * time.Second
+	maxErrorBodyBytes = 512
+)
+
+// Outcome 一次上游调用结果的分类
+type Outcome int
+
+const (
+	OutcomeOK           Outcome = iota
+	OutcomeBadRequest           // 请求本身有问题，与账号状态无关
+	OutcomeAuthExpired          // cookie 失效或未登录
+	OutcomeOutOfCredits         // 额度耗尽
+	OutcomeRateLimited          // 被限流
+	OutcomeTransient            // 上游 5xx 等临时错误
+	OutcomeNetwork              // 网络错误
+	OutcomeCanceled             // 客户端断开或请求的 context 结束，与账号状态无关
+)
+
+func (o Outcome) String() string {
+	switch o {
+	case OutcomeOK:
+		return "ok"
+	case OutcomeBadRequest:
+		return "bad_request"
+	case OutcomeAuthExpired:
+		return "auth_expired"
+	case OutcomeOutOfCredits:
+		return "out_of_credits"
+	case OutcomeRateLimited:
+		return "rate_limited"
+	case OutcomeTransient:
+		return "transient"
+	case OutcomeNetwork:
+		return "network"
+	case OutcomeCanceled:
+		return "canceled"
+	}
+	return "unknown"
+}
+
+// Classify 根据上游响应码、响应体与错误对结果分类，status 为 0 表示没有收到响应
+func Classify(status int, body string, err error) Outcome {
+	if status == 0 {
+		if err != nil {
+			return OutcomeNetwork
+		}
+		return OutcomeOK
+	}
+	if status >= 200 && status < 300 {
+		return OutcomeOK
+	}
+
+	lower := strings.ToLower(body)
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden,
+		strings.Contains(lower, "not login"), strings.Contains(lower, "unauthorized"), strings.Contains(lower, "login required"):
+		return OutcomeAuthExpired
+	case status == http.StatusPaymentRequired,
+		strings.Contains(lower, "credit"), strings.Contains(lower, "quota"), strings.Contains(lower, "insufficient"):
+		return OutcomeOutOfCredits
+	case status == http.StatusTooManyRequests,
+		strings.Contains(lower, "rate limit"), strings.Contains(lower, "too many requests"):
+		return OutcomeRateLimited
+	case status >= 500:
+		return OutcomeTransient
+	}
+	return OutcomeBadRequest
+}
+
+// Transition 一次状态变更
+type Transition struct {
+	From   State     `json:"from"`
+	To     State     `json:"to"`
+	Reason string    `json:"reason"`
+	At     time.Time `json:"at"`
+}
+
+// Health 账号健康状态快照
+type Health struct {
+	State               State        `json:"state"`
+	Since               time.Time    `json:"since"`
+	CoolDownUntil       time.Time    `json:"cool_down_until,omitempty"`
+	ConsecutiveFailures int          `json:"consecutive_failures"`
+	LastCheckAt         time.Time    `json:"last_check_at,omitempty"`
+	Transitions         []Transition `json:"transitions"`
+}
+
+// health 账号的健康状态机，由 Account.mu 保护
+type health struct {
+	state         State
+	since         time.Time
+	coolDownUntil time.Time
+	failures      int
+	lastCheckAt   time.Time
+	transitions   []Transition
+}
+
+// setState 切换状态并记录日志，调用方需持有 a.mu
+func (a *Account) setState(to State, reason string) {
+	from := a.health.state
+	if from == "" {
+		from = StateHealthy
+	}
+	if from == to {
+		return
+	}
+	now := time.Now()
+	a.health.state = to
+	a.health.since = now
+	a.health.transitions = append(a.health.transitions, Transition{From: from, To: to, Reason: reason, At: now})
+	if len(a.health.transitions) > maxTransitions {
+		a.health.transitions = a.health.transitions[len(a.health.transitions)-maxTransitions:]
+	}
+	log.Printf("Account %s state: %s -> %s (%s)", a.ID, from, to, reason)
+}
+
+// resetHealth 重置为健康状态，保留状态变更记录
+func (a *Account) resetHealth(reason string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.health.failures = 0
+	a.health.coolDownUntil = time.Time{}
+	a.setState(StateHealthy, reason)
+}
+
+// Observe 根据一次上游调用（探测或真实请求）的结果推进状态机
+func (a *Account) Observe(outcome Outcome, reason string) {
+	if len(reason) > maxErrorBodyBytes {
+		reason = reason[:maxErrorBodyBytes]
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	switch outcome {
+	case OutcomeOK:
+		a.health.failures = 0
+		a.setState(StateHealthy, "request succeeded")
+	case OutcomeBadRequest, OutcomeCanceled:
+		// 请求错误与客户端取消不影响账号状态
+	case OutcomeAuthExpired:
+		a.setState(StateDead, outcome.String()+": "+reason)
+	case OutcomeOutOfCredits:
+		a.health.coolDownUntil = time.Now().Add(creditCoolDown)
+		a.setState(StateCoolingDown, outcome.String()+": "+reason)
+	case OutcomeRateLimited:
+		a.health.coolDownUntil = time.Now().Add(coolDown)
+		a.setState(StateCoolingDown, outcome.String()+": "+reason)
+	default:
+		a.health.failures++
+		if a.health.failures >= maxFailures {
+			a.health.coolDownUntil = time.Now().Add(coolDown)
+			a.setState(StateCoolingDown, outcome.String()+": "+reason)
+		} else {
+			a.setState(StateDegraded, outcome.String()+": "+reason)
+		}
+	}
+}
+
+// State 返回当前状态，冷却期已过的账号视为 degraded，等待下一次成功调用恢复
+func (a *Account) State() State {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.stateLocked()
+}
+
+func (a *Account) stateLocked() State {
+	switch {
+	case a.health.state == "":
+		return StateHealthy
+	case a.health.state == StateCoolingDown && time.Now().After(a.health.coolDownUntil):
+		return StateDegraded
+	}
+	return a.health.state
+}
+
+// Health 返回健康状态快照
+func (a *Account) Health() Health {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	h := Health{
+		State:               a.stateLocked(),
+		Since:               a.health.since,
+		ConsecutiveFailures: a.health.failures,
+		LastCheckAt:         a.health.lastCheckAt,
+		Transitions:         append([]Transition{}, a.health.transitions...),
+	}
+	if h.State == StateCoolingDown {
+		h.CoolDownUntil = a.health.coolDownUntil
+	}
+	return h
+}
+
+// ProbeFunc 探测账号状态，返回上游响应码（没有响应时为 0）、响应体与错误
+type ProbeFunc func(ctx context.Context, a *Account) (status int, body string, err error)
+
+// Check 探测一次账号并更新状态
+func (a *Account) Check(ctx context.Context, probe ProbeFunc) {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	status, body, err := probe(ctx, a)
+	reason := body
+	if reason == "" && err != nil {
+		reason = err.Error()
+	}
+	a.Observe(Classify(status, body, err), reason)
+
+	a.mu.Lock()
+	a.health.lastCheckAt = time.Now()
+	a.mu.Unlock()
+}
+
+// StartHealthCheck 在后台按 interval 定期并发探测全部账号，ctx 结束时停止
+func (p *Pool) StartHealthCheck(ctx context.Context, interval time.Duration, probe ProbeFunc) {
+	if interval <= 0 {
+		return
+	}
+	checkAll := func() {
+		var wg sync.WaitGroup
+		for _, a := range p.Accounts() {
+			if a.Disabled() {
+				continue
+			}
+			wg.Add(1)
+			go func(a *Account) {
+				defer wg.Done()
+				a.Check(ctx, probe)
+			}(a)
+		}
+		wg.Wait()
+	}
+
+	go func() {
+		checkAll()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				checkAll()
+			}
+		}
+	}()
+}
+
+// UpstreamError 使用某个账号调用 Monica 失败，携带失败分类供故障转移与错误响应使用
+type UpstreamError struct {
+	AccountID string
+	Outcome   Outcome
+	Status    int // 上游响应码，没有响应时为 0
+	Err       error
+}
+
+func (e *UpstreamError) Error() string {
+	return fmt.Sprintf("monica upstream error (%s): %v", e.Outcome, e.Err)
+}
+
+func (e *UpstreamError) Unwrap() error {
+	return e.Err
+}
+
+// Retryable 账号相关的失败可以换一个账号重试，请求本身的错误换账号也无济于事
+func (e *UpstreamError) Retryable() bool {
+	return e.Outcome != OutcomeOK && e.Outcome != OutcomeBadRequest && e.Outcome != OutcomeCanceled
+}
+
+// ObserveError 对一次失败的上游调用分类并推进状态机，返回包装后的错误。
+// 客户端断开或请求的 context 结束导致的失败不归咎于账号，不推进状态机，也不换账号重试
+func (a *Account) ObserveError(ctx context.Context, status int, err error) *UpstreamError {
+	if ctx.Err() != nil || errors.Is(err, context.Canceled) {
+		return &UpstreamError{AccountID: a.ID, Outcome: OutcomeCanceled, Status: status, Err: err}
+	}
+	outcome := Classify(status, err.Error(), err)
+	if outcome == OutcomeOK {
+		// 收到 2xx 但解析等环节出错，不归咎于账号
+		outcome = OutcomeBadRequest
+	}
+	a.Observe(outcome, err.Error())
+	return &UpstreamError{AccountID: a.ID, Outcome: outcome, Status: status, Err: err}
+}
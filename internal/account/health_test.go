@@ -0,0 +1,38 @@
+package account
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestObserveErrorIgnoresCanceledRequests(t *testing.T) {
+	a := NewAccount("a", "session_id=a", 1)
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	for i := 0; i < 10; i++ {
+		upErr := a.ObserveError(canceled, 0, fmt.Errorf("post failed: %w", context.Canceled))
+		if upErr.Outcome != OutcomeCanceled || upErr.Retryable() {
+			t.Fatalf("outcome = %s, retryable = %v, want canceled and not retryable", upErr.Outcome, upErr.Retryable())
+		}
+		a.Acquire()
+		a.Release(upErr)
+		a.ObserveError(context.Background(), 0, fmt.Errorf("read body: %w", context.Canceled))
+	}
+	if h := a.Health(); h.ConsecutiveFailures != 0 || h.State != StateHealthy {
+		t.Fatalf("health = %s with %d failures, want healthy with 0", h.State, h.ConsecutiveFailures)
+	}
+	if st := a.Stats(); st.Failures != 0 || st.Canceled != 10 {
+		t.Fatalf("stats = %+v, want 0 failures and 10 canceled", st)
+	}
+
+	upErr := a.ObserveError(context.Background(), 0, errors.New("connection reset by peer"))
+	if upErr.Outcome != OutcomeNetwork || !upErr.Retryable() {
+		t.Fatalf("outcome = %s, want retryable network error", upErr.Outcome)
+	}
+	if h := a.Health(); h.ConsecutiveFailures != 1 {
+		t.Fatalf("consecutive failures = %d, want 1", h.ConsecutiveFailures)
+	}
+}
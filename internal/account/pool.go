@@ -0,0 +1,392 @@
+package account
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"monica-proxy/internal/config"
+	"monica-proxy/internal/utils"
+)
+
+// Strategy 账号选择策略
+type Strategy string
+
+const (
+	StrategyRoundRobin    Strategy = "round_robin"
+	StrategyLeastInFlight Strategy = "least_inflight"
+	StrategyWeighted      Strategy = "weighted"
+	StrategyRandom        Strategy = "random"
+)
+
+var (
+	// ErrNoAccount 没有可用账号
+	ErrNoAccount = errors.New("no available monica account")
+	// ErrAccountNotFound 指定 ID 的账号不存在
+	ErrAccountNotFound = errors.New("monica account not found")
+	// ErrAccountExists 指定 ID 的账号已存在
+	ErrAccountExists = errors.New("monica account already exists")
+	// ErrReadOnlyAccount 来自环境变量的账号只能在运行时停用或启用，不能修改或删除
+	ErrReadOnlyAccount = errors.New("monica account is configured via environment variables and can only be disabled or enabled, not modified or deleted")
+	// ErrNoAccountStore 未配置可写回的账号来源，运行时的修改无法保存
+	ErrNoAccountStore = errors.New("neither MONICA_ACCOUNTS_FILE nor CREDSTORE_FILE is configured, account changes cannot be persisted")
+)
+
+// DefaultPool 全局账号池，启动时由 LoadPool 初始化
+var DefaultPool *Pool
+
+// Pool 账号池，按策略为每个请求选择一个账号
+type Pool struct {
+	strategy Strategy
+	next     atomic.Uint64 // round_robin 计数
+
+	mu       sync.RWMutex
+	accounts []*Account
+	backends map[Source]Backend // 管理接口的修改按账号来源写回
+	primary  Backend            // 新添加的账号写入的来源
+
+	sticky     sticky
+	expiryWarn time.Duration // cookie 过期前开始预警的时长
+
+	qmu   sync.Mutex // 保护 queue，加锁顺序为 qmu -> mu
+	queue queue
+}
+
+// NewPool 创建账号池，同一 ID 的账号只保留第一个
+func NewPool(strategy Strategy, accounts []*Account) (*Pool, error) {
+	switch strategy {
+	case "":
+		strategy = StrategyRoundRobin
+	case StrategyRoundRobin, StrategyLeastInFlight, StrategyWeighted, StrategyRandom:
+	default:
+		return nil, fmt.Errorf("unknown account strategy: %s", strategy)
+	}
+
+	p := &Pool{strategy: strategy}
+	seen := make(map[string]bool)
+	for _, a := range accounts {
+		if seen[a.ID] {
+			continue
+		}
+		seen[a.ID] = true
+		p.accounts = append(p.accounts, a)
+	}
+	return p, nil
+}
+
+// Strategy 返回账号池使用的选择策略
+func (p *Pool) Strategy() Strategy {
+	return p.strategy
+}
+
+// Accounts 返回全部账号
+func (p *Pool) Accounts() []*Account {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return append([]*Account(nil), p.accounts...)
+}
+
+// Get 按 ID 查找账号
+func (p *Pool) Get(id string) *Account {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	for _, a := range p.accounts {
+		if a.ID == id {
+			return a
+		}
+	}
+	return nil
+}
+
+// Pick 按策略选择一个账号，exclude 中的账号（如刚刚失败的账号，按 ID 比较）、失效与冷却中的账号以及达到并发上限的账号
+// 不参与选择，存在健康账号时不选择 degraded 账号。可用账号都达到并发上限时返回 errBusy
+func (p *Pool) Pick(exclude ...*Account) (*Account, error) {
+	candidates, busy := p.candidates(exclude)
+	if len(candidates) == 0 {
+		if busy {
+			return nil, errBusy
+		}
+		return nil, ErrNoAccount
+	}
+
+	switch p.strategy {
+	case StrategyLeastInFlight:
+		best := candidates[0]
+		for _, a := range candidates[1:] {
+			if a.InFlight() < best.InFlight() {
+				best = a
+			}
+		}
+		return best, nil
+	case StrategyWeighted:
+		total := 0
+		for _, a := range candidates {
+			total += a.Weight
+		}
+		n := rand.IntN(total)
+		for _, a := range candidates {
+			if n < a.Weight {
+				return a, nil
+			}
+			n -= a.Weight
+		}
+		return candidates[len(candidates)-1], nil
+	case StrategyRandom:
+		return candidates[rand.IntN(len(candidates))], nil
+	default:
+		return candidates[int(p.next.Add(1)-1)%len(candidates)], nil
+	}
+}
+
+// AccountUpdate 管理接口对账号的修改，为 nil 的字段保持不变
+type AccountUpdate struct {
+	Cookie         *string
+	Weight         *int
+	MaxConcurrency *int
+	Proxy          *string
+	Disabled       *bool
+}
+
+// disabledOnly 返回修改是否只涉及停用状态
+func (u AccountUpdate) disabledOnly() bool {
+	return u.Disabled != nil && u.Cookie == nil && u.Weight == nil && u.MaxConcurrency == nil && u.Proxy == nil
+}
+
+// Add 添加账号并写回账号来源
+func (p *Pool) Add(a *Account, disabled bool) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.primary == nil {
+		return ErrNoAccountStore
+	}
+	if p.indexLocked(a.ID) >= 0 {
+		return ErrAccountExists
+	}
+	if err := checkExpiry(a); err != nil {
+		return err
+	}
+	if _, err := utils.ParseProxy(a.Proxy); err != nil {
+		return err
+	}
+	a.Source = p.primary.Source()
+	a.SetDisabled(disabled)
+	p.accounts = append(p.accounts, a)
+	if err := p.saveLocked(a.Source); err != nil {
+		p.accounts = p.accounts[:len(p.accounts)-1]
+		return err
+	}
+	log.Printf("Account %s added", a.ID)
+	return nil
+}
+
+// Update 修改账号并写回账号来源，用修改后的 Account 替换旧的，正在进行的请求继续使用旧对象，
+// 并发数与调用统计共享；cookie 变化时健康状态重置
+func (p *Pool) Update(id string, update AccountUpdate) (*Account, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	i := p.indexLocked(id)
+	if i < 0 {
+		return nil, ErrAccountNotFound
+	}
+	old := p.accounts[i]
+	if old.Source == SourceEnv && update.disabledOnly() {
+		// 来自环境变量的账号没有可写回的来源，停用状态只保存在内存中，重启后恢复
+		old.SetDisabled(*update.Disabled)
+		log.Printf("Account %s updated (in memory)", id)
+		return old, nil
+	}
+	if err := p.writableLocked(old); err != nil {
+		return nil, err
+	}
+
+	updated := *old
+	if update.Cookie != nil {
+		updated.Cookie = *update.Cookie
+		updated.ExpiresAt, _ = CookieExpiry(updated.Cookie)
+		if err := checkExpiry(&updated); err != nil {
+			return nil, err
+		}
+	}
+	if update.Weight != nil {
+		updated.Weight = max(*update.Weight, 1)
+	}
+	if update.MaxConcurrency != nil {
+		updated.MaxConcurrency = max(*update.MaxConcurrency, 0)
+	}
+	if update.Proxy != nil {
+		if _, err := utils.ParseProxy(*update.Proxy); err != nil {
+			return nil, err
+		}
+		updated.Proxy = *update.Proxy
+	}
+	wasDisabled := old.Disabled()
+	if update.Disabled != nil {
+		updated.SetDisabled(*update.Disabled)
+	}
+
+	p.accounts[i] = &updated
+	if err := p.saveLocked(old.Source); err != nil {
+		p.accounts[i] = old
+		old.SetDisabled(wasDisabled)
+		return nil, err
+	}
+	if updated.Cookie != old.Cookie {
+		// 更换 cookie 后之前的健康状态不再适用
+		updated.resetHealth("cookie updated")
+	}
+	log.Printf("Account %s updated", id)
+	return &updated, nil
+}
+
+// Remove 删除账号并写回账号来源，正在使用该账号的请求不受影响
+func (p *Pool) Remove(id string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	i := p.indexLocked(id)
+	if i < 0 {
+		return ErrAccountNotFound
+	}
+	source := p.accounts[i].Source
+	if err := p.writableLocked(p.accounts[i]); err != nil {
+		return err
+	}
+
+	before := p.accounts
+	p.accounts = append(append([]*Account(nil), before[:i]...), before[i+1:]...)
+	if err := p.saveLocked(source); err != nil {
+		p.accounts = before
+		return err
+	}
+	log.Printf("Account %s removed", id)
+	return nil
+}
+
+// writableLocked 检查账号能否在运行时修改
+func (p *Pool) writableLocked(a *Account) error {
+	if a.Source == SourceEnv {
+		return ErrReadOnlyAccount
+	}
+	if p.backends[a.Source] == nil {
+		return ErrNoAccountStore
+	}
+	return nil
+}
+
+// saveLocked 将来自 source 的账号写回对应的来源
+func (p *Pool) saveLocked(source Source) error {
+	var records []Record
+	for _, a := range p.accounts {
+		if a.Source == source {
+			records = append(records, a.record())
+		}
+	}
+	return p.backends[source].Save(records)
+}
+
+func (p *Pool) indexLocked(id string) int {
+	for i, a := range p.accounts {
+		if a.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// candidates 返回可选择的账号，busy 表示存在仅因并发上限而被排除的账号
+func (p *Pool) candidates(exclude []*Account) (candidates []*Account, busy bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	var healthy, degraded []*Account
+	for _, a := range p.accounts {
+		excluded := false
+		for _, e := range exclude {
+			if e.ID == a.ID {
+				excluded = true
+				break
+			}
+		}
+		if excluded || a.Disabled() {
+			continue
+		}
+		state := a.State()
+		if state != StateHealthy && state != StateDegraded {
+			continue
+		}
+		if p.atCapacity(a) {
+			busy = true
+			continue
+		}
+		if state == StateHealthy {
+			healthy = append(healthy, a)
+		} else {
+			degraded = append(degraded, a)
+		}
+	}
+	if len(healthy) > 0 {
+		return healthy, busy
+	}
+	return degraded, busy
+}
+
+// LoadPool 根据配置创建全局账号池，账号来源依次为 MONICA_COOKIE、MONICA_COOKIES、账号文件与 stores
+// （如加密凭据库）。配置了可写回的来源时允许启动时没有账号，之后可以通过管理接口添加
+func LoadPool(cfg *config.Config, stores ...Backend) (*Pool, error) {
+	var accounts []*Account
+	envCookies := cfg.MonicaCookies
+	if cfg.MonicaCookie != "" {
+		envCookies = append([]string{cfg.MonicaCookie}, envCookies...)
+	}
+	for _, cookie := range envCookies {
+		a := NewAccount("", cookie, 1)
+		a.Source = SourceEnv
+		accounts = append(accounts, a)
+	}
+
+	var backends []Backend
+	if cfg.AccountsFile != "" {
+		backends = append(backends, &FileBackend{Path: cfg.AccountsFile})
+	}
+	backends = append(backends, stores...)
+	for _, b := range backends {
+		loaded, err := loadBackend(b)
+		if err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, loaded...)
+	}
+	if len(accounts) == 0 && len(backends) == 0 {
+		return nil, ErrNoAccount
+	}
+	// 已过期的 cookie 直接拒绝启动，而不是等到第一个请求失败
+	for _, a := range accounts {
+		if err := checkExpiry(a); err != nil {
+			return nil, err
+		}
+	}
+
+	pool, err := NewPool(Strategy(cfg.AccountStrategy), accounts)
+	if err != nil {
+		return nil, err
+	}
+	pool.sticky.ttl = cfg.StickyTTL
+	pool.expiryWarn = time.Duration(cfg.CookieExpiryWarnDays) * 24 * time.Hour
+	pool.queue = queue{
+		globalLimit:  cfg.MaxConcurrency,
+		accountLimit: cfg.AccountMaxConcurrency,
+		size:         cfg.QueueSize,
+		timeout:      cfg.QueueTimeout,
+	}
+	pool.backends = make(map[Source]Backend, len(backends))
+	for _, b := range backends {
+		pool.backends[b.Source()] = b
+		// 新添加的账号写入最后配置的来源，同时配置了账号文件与凭据库时写入凭据库
+		pool.primary = b
+	}
+	DefaultPool = pool
+	return pool, nil
+}
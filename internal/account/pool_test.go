@@ -0,0 +1,72 @@
+package account
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestUpdateEnvAccountDisabledInMemory(t *testing.T) {
+	a := NewAccount("env", "session_id=a", 1)
+	a.Source = SourceEnv
+	p, err := NewPool(StrategyRoundRobin, []*Account{a})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	disabled := true
+	updated, err := p.Update("env", AccountUpdate{Disabled: &disabled})
+	if err != nil {
+		t.Fatalf("disable env account: %v", err)
+	}
+	if !updated.Disabled() || !a.Disabled() {
+		t.Fatal("env account was not disabled")
+	}
+	disabled = false
+	if _, err := p.Update("env", AccountUpdate{Disabled: &disabled}); err != nil {
+		t.Fatalf("enable env account: %v", err)
+	}
+	if a.Disabled() {
+		t.Fatal("env account was not enabled")
+	}
+
+	// 其他字段仍然只读
+	weight := 2
+	if _, err := p.Update("env", AccountUpdate{Weight: &weight, Disabled: &disabled}); !errors.Is(err, ErrReadOnlyAccount) {
+		t.Fatalf("update weight err = %v, want ErrReadOnlyAccount", err)
+	}
+	if err := p.Remove("env"); !errors.Is(err, ErrReadOnlyAccount) {
+		t.Fatalf("remove err = %v, want ErrReadOnlyAccount", err)
+	}
+}
+
+func TestPickExcludesUpdatedAccount(t *testing.T) {
+	a := NewAccount("a", "session_id=a", 1)
+	b := NewAccount("b", "session_id=b", 1)
+	p, err := NewPool(StrategyRoundRobin, []*Account{a, b})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.backends = map[Source]Backend{a.Source: nopBackend{}}
+
+	// 请求失败后管理员修改了账号，池中的对象被替换，故障转移仍然不能再选到它
+	weight := 3
+	if _, err := p.Update("a", AccountUpdate{Weight: &weight}); err != nil {
+		t.Fatal(err)
+	}
+	for range 4 {
+		got, err := p.Pick(a)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.ID == "a" {
+			t.Fatal("picked the excluded account after it was updated")
+		}
+	}
+}
+
+// nopBackend 不保存任何内容的账号来源
+type nopBackend struct{}
+
+func (nopBackend) Source() Source              { return "" }
+func (nopBackend) Load() ([]Record, error)     { return nil, nil }
+func (nopBackend) Save(records []Record) error { return nil }
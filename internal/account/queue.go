@@ -0,0 +1,305 @@
+package account
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// errBusy 可用账号都达到并发上限，或全局并发已满
+var errBusy = errors.New("all monica accounts are busy")
+
+// QueueError 排队失败：队列已满或等待超时
+type QueueError struct {
+	Full       bool          // true 表示队列已满，false 表示等待超时
+	RetryAfter time.Duration // 建议客户端的重试间隔
+}
+
+func (e *QueueError) Error() string {
+	if e.Full {
+		return "too many concurrent requests, request queue is full"
+	}
+	return fmt.Sprintf("timed out waiting for an available monica account, retry after %s", e.RetryAfter)
+}
+
+// QueueStats 并发与排队情况
+type QueueStats struct {
+	InFlight     int            `json:"in_flight"`
+	GlobalLimit  int            `json:"global_limit"`
+	AccountLimit int            `json:"account_limit"`
+	Depth        int            `json:"depth"`
+	DepthByKey   map[string]int `json:"depth_by_key"`
+	Size         int            `json:"size"`
+	TimeoutMs    int64          `json:"timeout_ms"`
+	OldestWaitMs int64          `json:"oldest_wait_ms"`
+	Waited       int64          `json:"waited"`
+	AvgWaitMs    int64          `json:"avg_wait_ms"`
+	MaxWaitMs    int64          `json:"max_wait_ms"`
+	RejectedFull int64          `json:"rejected_full"`
+	TimedOut     int64          `json:"timed_out"`
+}
+
+// waiter 排队中的请求
+type waiter struct {
+	apiKey     string
+	conv       string
+	exclude    []*Account
+	enqueuedAt time.Time
+	ch         chan *Account // 分配到的账号，nil 表示已经没有可用账号
+}
+
+// queue 全局与账号并发限制及等待队列，由 Pool 持有。同一 API key 的请求先进先出，
+// 不同 API key 之间轮流分配，避免单个 key 的突发请求占满队列头部
+type queue struct {
+	globalLimit  int           // 全局并发上限，0 表示不限制
+	accountLimit int           // 账号默认并发上限，0 表示不限制
+	size         int           // 最多排队的请求数，0 表示不排队
+	timeout      time.Duration // 排队的最长等待时间，0 表示不超时
+
+	inFlight int
+	waiters  map[string][]*waiter // 按 API key 分组
+	keys     []string             // 有请求排队的 API key，按轮转顺序
+	next     int
+	depth    int
+
+	waited       int64
+	waitTotal    time.Duration
+	waitMax      time.Duration
+	rejectedFull int64
+	timedOut     int64
+}
+
+// atCapacity 账号是否达到并发上限
+func (p *Pool) atCapacity(a *Account) bool {
+	limit := a.MaxConcurrency
+	if limit == 0 {
+		limit = p.queue.accountLimit
+	}
+	return limit > 0 && a.InFlight() >= int64(limit)
+}
+
+// Acquire 为请求占用一个账号：有空闲账号且没有其他请求在排队时直接分配，否则按 API key 公平排队，
+// 等待超过队列超时时间返回 *QueueError。返回的账号使用完后必须调用 Release
+func (p *Pool) Acquire(ctx context.Context, apiKey, conv string, exclude ...*Account) (*Account, error) {
+	p.qmu.Lock()
+	q := &p.queue
+	if q.depth == 0 {
+		acc, err := p.tryAcquireLocked(conv, exclude)
+		if err != errBusy {
+			p.qmu.Unlock()
+			return acc, err
+		}
+	}
+
+	if q.depth >= q.size {
+		q.rejectedFull++
+		err := &QueueError{Full: true, RetryAfter: q.retryAfterLocked()}
+		p.qmu.Unlock()
+		return nil, err
+	}
+	w := &waiter{apiKey: apiKey, conv: conv, exclude: exclude, enqueuedAt: time.Now(), ch: make(chan *Account, 1)}
+	q.pushLocked(w)
+	// 已有请求在排队时新请求排在后面，按公平顺序分配
+	p.dispatchLocked()
+	p.qmu.Unlock()
+
+	var timeout <-chan time.Time
+	if q.timeout > 0 {
+		timer := time.NewTimer(q.timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	var err error
+	select {
+	case acc := <-w.ch:
+		return p.granted(w, acc)
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-timeout:
+		err = errBusy
+	}
+
+	p.qmu.Lock()
+	removed := q.removeLocked(w)
+	if removed && err == errBusy {
+		q.timedOut++
+		err = &QueueError{RetryAfter: q.retryAfterLocked()}
+	}
+	p.qmu.Unlock()
+	if !removed {
+		// 超时与分配同时发生，账号已经分配给该请求
+		acc, _ := p.granted(w, <-w.ch)
+		if acc != nil && ctx.Err() != nil {
+			p.Release(acc, ctx.Err())
+			return nil, ctx.Err()
+		}
+		if acc != nil {
+			return acc, nil
+		}
+		return nil, ErrNoAccount
+	}
+	return nil, err
+}
+
+// granted 记录等待时间并返回分配的账号
+func (p *Pool) granted(w *waiter, acc *Account) (*Account, error) {
+	wait := time.Since(w.enqueuedAt)
+	p.qmu.Lock()
+	q := &p.queue
+	q.waited++
+	q.waitTotal += wait
+	q.waitMax = max(q.waitMax, wait)
+	p.qmu.Unlock()
+	if acc == nil {
+		return nil, ErrNoAccount
+	}
+	return acc, nil
+}
+
+// Release 释放 Acquire 占用的账号，err 不为空时记录为失败，并把空出的并发分配给排队中的请求
+func (p *Pool) Release(a *Account, err error) {
+	a.Release(err)
+	p.qmu.Lock()
+	defer p.qmu.Unlock()
+	p.queue.inFlight--
+	p.dispatchLocked()
+}
+
+// tryAcquireLocked 在全局与账号并发未满时占用一个账号
+func (p *Pool) tryAcquireLocked(conv string, exclude []*Account) (*Account, error) {
+	q := &p.queue
+	if q.globalLimit > 0 && q.inFlight >= q.globalLimit {
+		// 全局并发已满，但没有任何可用账号时直接失败而不是排队
+		if _, err := p.Pick(exclude...); errors.Is(err, ErrNoAccount) {
+			return nil, err
+		}
+		return nil, errBusy
+	}
+	acc, err := p.PickFor(conv, exclude...)
+	if err != nil {
+		return nil, err
+	}
+	acc.Acquire()
+	q.inFlight++
+	return acc, nil
+}
+
+// dispatchLocked 按 API key 轮流把空闲的并发分配给各 key 队首的请求
+func (p *Pool) dispatchLocked() {
+	q := &p.queue
+	for q.depth > 0 {
+		progressed := false
+		for i := 0; i < len(q.keys); i++ {
+			idx := (q.next + i) % len(q.keys)
+			key := q.keys[idx]
+			w := q.waiters[key][0]
+			acc, err := p.tryAcquireLocked(w.conv, w.exclude)
+			if err == errBusy {
+				if q.globalLimit > 0 && q.inFlight >= q.globalLimit {
+					return
+				}
+				// 该请求可用的账号都忙，尝试下一个 key
+				continue
+			}
+			// 没有可用账号时 acc 为 nil，排队的请求直接失败
+			more := len(q.waiters[key]) > 1
+			q.removeLocked(w)
+			w.ch <- acc
+			switch {
+			case len(q.keys) == 0:
+				q.next = 0
+			case more:
+				q.next = (idx + 1) % len(q.keys)
+			default:
+				// 该 key 已从轮转中移除，原来的下一个 key 移到了 idx
+				q.next = idx % len(q.keys)
+			}
+			progressed = true
+			break
+		}
+		if !progressed {
+			return
+		}
+	}
+}
+
+func (q *queue) pushLocked(w *waiter) {
+	if q.waiters == nil {
+		q.waiters = make(map[string][]*waiter)
+	}
+	if len(q.waiters[w.apiKey]) == 0 {
+		q.keys = append(q.keys, w.apiKey)
+	}
+	q.waiters[w.apiKey] = append(q.waiters[w.apiKey], w)
+	q.depth++
+}
+
+// removeLocked 从队列中移除请求，请求已经被分配（不在队列中）时返回 false
+func (q *queue) removeLocked(w *waiter) bool {
+	list := q.waiters[w.apiKey]
+	for i, x := range list {
+		if x != w {
+			continue
+		}
+		list = append(list[:i], list[i+1:]...)
+		q.depth--
+		if len(list) > 0 {
+			q.waiters[w.apiKey] = list
+			return true
+		}
+		delete(q.waiters, w.apiKey)
+		for k, key := range q.keys {
+			if key == w.apiKey {
+				q.keys = append(q.keys[:k], q.keys[k+1:]...)
+				if q.next > k {
+					q.next--
+				}
+				break
+			}
+		}
+		if q.next >= len(q.keys) {
+			q.next = 0
+		}
+		return true
+	}
+	return false
+}
+
+// retryAfterLocked 以平均等待时间作为建议的重试间隔，至少 1 秒
+func (q *queue) retryAfterLocked() time.Duration {
+	retry := time.Second
+	if q.waited > 0 {
+		retry = max(retry, (q.waitTotal / time.Duration(q.waited)).Round(time.Second))
+	}
+	return retry
+}
+
+// QueueStats 返回并发与排队情况
+func (p *Pool) QueueStats() QueueStats {
+	p.qmu.Lock()
+	defer p.qmu.Unlock()
+	q := &p.queue
+	stats := QueueStats{
+		InFlight:     q.inFlight,
+		GlobalLimit:  q.globalLimit,
+		AccountLimit: q.accountLimit,
+		Depth:        q.depth,
+		DepthByKey:   make(map[string]int, len(q.waiters)),
+		Size:         q.size,
+		TimeoutMs:    q.timeout.Milliseconds(),
+		Waited:       q.waited,
+		MaxWaitMs:    q.waitMax.Milliseconds(),
+		RejectedFull: q.rejectedFull,
+		TimedOut:     q.timedOut,
+	}
+	if q.waited > 0 {
+		stats.AvgWaitMs = (q.waitTotal / time.Duration(q.waited)).Milliseconds()
+	}
+	now := time.Now()
+	for key, list := range q.waiters {
+		stats.DepthByKey[key] = len(list)
+		stats.OldestWaitMs = max(stats.OldestWaitMs, now.Sub(list[0].enqueuedAt).Milliseconds())
+	}
+	return stats
+}
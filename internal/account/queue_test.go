@@ -0,0 +1,54 @@
+package account
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAcquireWithoutQueueTimeoutWaits(t *testing.T) {
+	a := NewAccount("a", "session_id=a", 1)
+	a.MaxConcurrency = 1
+	p, err := NewPool(StrategyRoundRobin, []*Account{a})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.queue = queue{size: 1, timeout: 0}
+
+	held, err := p.Acquire(context.Background(), "key", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// QUEUE_TIMEOUT=0 时一直等待，不会立即超时
+	done := make(chan error, 1)
+	go func() {
+		acc, err := p.Acquire(context.Background(), "key", "")
+		if err == nil {
+			p.Release(acc, nil)
+		}
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		t.Fatalf("queued acquire returned early: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	p.Release(held, nil)
+	if err := <-done; err != nil {
+		t.Fatalf("queued acquire: %v", err)
+	}
+
+	// 仍然随客户端取消而退出
+	held, err = p.Acquire(context.Background(), "key", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Release(held, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := p.Acquire(ctx, "key", ""); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want context.DeadlineExceeded", err)
+	}
+}
@@ -0,0 +1,116 @@
+package account
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// maxStickyEntries 会话绑定条目数超过该值时清理过期条目
+const maxStickyEntries = 10000
+
+// stickyEntry 会话与账号的绑定
+type stickyEntry struct {
+	accountID string
+	expiresAt time.Time
+}
+
+// sticky 会话亲和：同一会话的后续请求优先使用同一账号，便于复用账号下已上传的文件与 Monica 侧的状态
+type sticky struct {
+	ttl     time.Duration
+	mu      sync.Mutex
+	entries map[string]stickyEntry
+}
+
+func (s *sticky) get(key string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[key]
+	if !ok {
+		return ""
+	}
+	if time.Now().After(e.expiresAt) {
+		delete(s.entries, key)
+		return ""
+	}
+	return e.accountID
+}
+
+// pin 绑定会话与账号，每次命中都会顺延过期时间
+func (s *sticky) pin(key, accountID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.entries == nil {
+		s.entries = make(map[string]stickyEntry)
+	}
+	now := time.Now()
+	if len(s.entries) >= maxStickyEntries {
+		for k, e := range s.entries {
+			if now.After(e.expiresAt) {
+				delete(s.entries, k)
+			}
+		}
+	}
+	s.entries[key] = stickyEntry{accountID: accountID, expiresAt: now.Add(s.ttl)}
+}
+
+func (s *sticky) len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.entries)
+}
+
+// PickFor 为会话选择账号：已绑定的账号仍可用（未停用、未失效或冷却、未达到并发上限、不在 exclude 中）时继续使用，
+// 否则按策略重新选择并改为绑定新账号。key 为空或未开启会话亲和时等同于 Pick
+func (p *Pool) PickFor(key string, exclude ...*Account) (*Account, error) {
+	if key == "" || p.sticky.ttl <= 0 {
+		return p.Pick(exclude...)
+	}
+
+	if id := p.sticky.get(key); id != "" {
+		if a := p.Get(id); a != nil && p.available(a, exclude) {
+			p.sticky.pin(key, a.ID)
+			return a, nil
+		}
+	}
+
+	a, err := p.Pick(exclude...)
+	if err != nil {
+		return nil, err
+	}
+	p.sticky.pin(key, a.ID)
+	return a, nil
+}
+
+// available 账号能否被选择，绑定的账号处于 degraded 状态时仍继续使用，避免会话频繁切换账号。
+// 达到并发上限的账号与 candidates 一样不可选择
+func (p *Pool) available(a *Account, exclude []*Account) bool {
+	for _, e := range exclude {
+		if e.ID == a.ID {
+			return false
+		}
+	}
+	if a.Disabled() || p.atCapacity(a) {
+		return false
+	}
+	state := a.State()
+	return state == StateHealthy || state == StateDegraded
+}
+
+// StickyConversations 返回当前绑定了账号的会话数（包含尚未清理的过期条目）
+func (p *Pool) StickyConversations() int {
+	return p.sticky.len()
+}
+
+type conversationKey struct{}
+
+// WithConversation 将客户端指定的会话标识（如 X-Conversation-Id）放入 context
+func WithConversation(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, conversationKey{}, key)
+}
+
+// ConversationFromContext 返回 context 中的会话标识，不存在时返回空字符串
+func ConversationFromContext(ctx context.Context) string {
+	key, _ := ctx.Value(conversationKey{}).(string)
+	return key
+}
@@ -0,0 +1,77 @@
+package account
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func newStickyPool(t *testing.T, accounts ...*Account) *Pool {
+	t.Helper()
+	p, err := NewPool(StrategyRoundRobin, accounts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.sticky.ttl = time.Minute
+	p.queue = queue{size: 0, timeout: 50 * time.Millisecond}
+	return p
+}
+
+func TestPickForSkipsPinnedAccountAtCapacity(t *testing.T) {
+	a := NewAccount("a", "session_id=a", 1)
+	b := NewAccount("b", "session_id=b", 1)
+	a.MaxConcurrency = 1
+	b.MaxConcurrency = 1
+	p := newStickyPool(t, a, b)
+	ctx := context.Background()
+
+	first, err := p.Acquire(ctx, "key", "conv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 绑定的账号已满，同一会话改用另一个账号而不是超过并发上限
+	second, err := p.Acquire(ctx, "key", "conv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second == first {
+		t.Fatalf("pinned account %s was reused beyond its concurrency limit", first.ID)
+	}
+	if first.InFlight() != 1 || second.InFlight() != 1 {
+		t.Fatalf("in flight = %d, %d, want 1, 1", first.InFlight(), second.InFlight())
+	}
+
+	// 两个账号都满时拒绝，不再分配绑定的账号
+	acc, err := p.Acquire(ctx, "key", "conv")
+	var qe *QueueError
+	if !errors.As(err, &qe) {
+		t.Fatalf("acquired %v, err = %v, want *QueueError", acc, err)
+	}
+
+	p.Release(first, nil)
+	p.Release(second, nil)
+}
+
+func TestPickForKeepsPinnedAccountBelowCapacity(t *testing.T) {
+	a := NewAccount("a", "session_id=a", 1)
+	b := NewAccount("b", "session_id=b", 1)
+	a.MaxConcurrency = 2
+	b.MaxConcurrency = 2
+	p := newStickyPool(t, a, b)
+	ctx := context.Background()
+
+	first, err := p.Acquire(ctx, "key", "conv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := p.Acquire(ctx, "key", "conv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second != first {
+		t.Fatalf("conversation moved from %s to %s while the pinned account had capacity", first.ID, second.ID)
+	}
+	p.Release(first, nil)
+	p.Release(second, nil)
+}
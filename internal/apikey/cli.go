@@ -0,0 +1,214 @@
+package apikey
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"monica-proxy/internal/usage"
+)
+
+const cliUsage = `用法: monica-proxy keys <命令> [选项]
+
+命令:
+  list                                   列出 API 密钥（只显示前缀）
+  add -name NAME [-owner OWNER] [-scopes chat,images,admin] [-expires 2025-12-31|720h] [-key KEY]
+      [-allow PATTERNS] [-deny PATTERNS] [-default-model MODEL] [-rpm N] [-tpm N]
+                                         添加 API 密钥，省略 -key 时随机生成，明文只显示一次
+  policy -name NAME|ID [-allow PATTERNS] [-deny PATTERNS] [-default-model MODEL]
+                                         替换密钥的模型策略，全部省略时取消限制
+  limit -name NAME|ID [-rpm N] [-tpm N]  修改密钥每分钟的请求数与 token 上限，0 表示使用全局默认值
+  quota -name NAME|ID [-group GROUP] [-daily N] [-monthly N]
+                                         设置密钥对模型组（省略时为全部模型）的 token 预算，都为 0 时恢复默认配额
+  remove -name NAME|ID                   删除 API 密钥
+  disable -name NAME|ID                  停用 API 密钥
+  enable -name NAME|ID                   启用 API 密钥
+
+配置了 CREDSTORE_FILE 时密钥保存在加密凭据库中，否则保存在 API_KEYS_FILE。`
+
+// RunCLI 执行 keys 子命令，管理 backend 中的 API 密钥，quotas 用于校验配额引用的模型组
+func RunCLI(backend Backend, quotas *usage.QuotaConfig, args []string) error {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "help" {
+		fmt.Println(cliUsage)
+		return nil
+	}
+	if backend == nil {
+		return ErrNoKeyStore
+	}
+	cmd, args := args[0], args[1:]
+
+	fs := flag.NewFlagSet("keys "+cmd, flag.ContinueOnError)
+	name := fs.String("name", "", "API 密钥名称，remove / disable / enable 也可以使用密钥 ID")
+	owner := fs.String("owner", "", "密钥所有者")
+	scopes := fs.String("scopes", "", "权限范围，逗号分隔: chat, images, admin，默认 chat,images")
+	expires := fs.String("expires", "", "过期时间，日期 (2006-01-02)、RFC3339 或有效期 (720h)")
+	token := fs.String("key", "", "API 密钥明文")
+	allow := fs.String("allow", "", "允许的模型，逗号分隔，支持通配符如 gpt-4o*，省略时允许全部模型")
+	deny := fs.String("deny", "", "禁止的模型，逗号分隔，支持通配符，优先于 -allow")
+	defaultModel := fs.String("default-model", "", "请求被禁止的模型时改用的模型，省略时拒绝请求")
+	rpm := fs.Int("rpm", 0, "每分钟请求数上限，0 表示使用 RATE_LIMIT_RPM")
+	tpm := fs.Int("tpm", 0, "每分钟 token 上限，0 表示使用 RATE_LIMIT_TPM")
+	group := fs.String("group", "", "QUOTA_FILE 中定义的模型组，省略时为全部模型")
+	daily := fs.Int64("daily", 0, "每日 token 预算")
+	monthly := fs.Int64("monthly", 0, "每月 token 预算")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	store := NewStore(backend)
+	if err := store.Load(); err != nil {
+		return err
+	}
+
+	switch cmd {
+	case "list":
+		keys := store.List()
+		fmt.Printf("API keys (%d):\n", len(keys))
+		now := time.Now()
+		for _, k := range keys {
+			status := "enabled"
+			switch {
+			case k.Disabled:
+				status = "disabled"
+			case k.Expired(now):
+				status = "expired"
+			}
+			expiresAt := "never"
+			if !k.ExpiresAt.IsZero() {
+				expiresAt = k.ExpiresAt.Format(time.RFC3339)
+			}
+			fmt.Printf("  %s\t%s\t%s...\towner=%s\tscopes=%s\t%s\tcreated=%s\texpires=%s\n",
+				k.ID, k.Name, k.Prefix, k.Owner, joinScopes(k.Scopes), status, k.CreatedAt.Format(time.RFC3339), expiresAt)
+			if k.RPM > 0 || k.TPM > 0 {
+				fmt.Printf("    rpm=%d\ttpm=%d\n", k.RPM, k.TPM)
+			}
+			for _, q := range k.Quotas {
+				fmt.Printf("    quota group=%s\tdaily=%d\tmonthly=%d\n", q.Group, q.Daily, q.Monthly)
+			}
+			if k.Restricted() || k.DefaultModel != "" {
+				fmt.Printf("    allow=%s\tdeny=%s\tdefault_model=%s\n",
+					strings.Join(k.AllowModels, ","), strings.Join(k.DenyModels, ","), k.DefaultModel)
+			}
+		}
+		return nil
+
+	case "add":
+		parsed, err := ParseScopes(*scopes)
+		if err != nil {
+			return err
+		}
+		expiresAt, err := ParseExpiry(*expires, time.Now())
+		if err != nil {
+			return err
+		}
+		policy, err := parsePolicy(*allow, *deny, *defaultModel)
+		if err != nil {
+			return err
+		}
+		plain, k, err := store.Create(*name, *owner, *token, parsed, expiresAt, policy, *rpm, *tpm)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("API key %s (%s) added, scopes=%s\n", k.Name, k.ID, joinScopes(k.Scopes))
+		fmt.Printf("Key (shown only once): %s\n", plain)
+		return nil
+
+	case "policy":
+		if *name == "" {
+			return errors.New("-name is required")
+		}
+		policy, err := parsePolicy(*allow, *deny, *defaultModel)
+		if err != nil {
+			return err
+		}
+		if err := store.SetPolicy(*name, policy); err != nil {
+			return err
+		}
+		fmt.Printf("API key %s: policy updated\n", *name)
+		return nil
+
+	case "limit":
+		if *name == "" {
+			return errors.New("-name is required")
+		}
+		if err := store.SetLimits(*name, *rpm, *tpm); err != nil {
+			return err
+		}
+		fmt.Printf("API key %s: rate limits updated\n", *name)
+		return nil
+
+	case "quota":
+		if *name == "" {
+			return errors.New("-name is required")
+		}
+		quota := usage.Quota{Group: *group, Daily: *daily, Monthly: *monthly}
+		if err := quotas.Validate([]usage.Quota{quota}); err != nil {
+			return err
+		}
+		if err := store.SetQuota(*name, quota); err != nil {
+			return err
+		}
+		fmt.Printf("API key %s: quota updated\n", *name)
+		return nil
+
+	case "remove", "disable", "enable":
+		if *name == "" {
+			return errors.New("-name is required")
+		}
+		var err error
+		switch cmd {
+		case "remove":
+			err = store.Remove(*name)
+		case "disable":
+			err = store.SetDisabled(*name, true)
+		case "enable":
+			err = store.SetDisabled(*name, false)
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Printf("API key %s: %s done\n", *name, cmd)
+		return nil
+	}
+	return fmt.Errorf("unknown keys command: %s\n\n%s", cmd, cliUsage)
+}
+
+// ParseExpiry 解析过期时间：日期、RFC3339 时间或相对 now 的有效期，空字符串表示不过期
+func ParseExpiry(s string, now time.Time) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil && d > 0 {
+		return now.Add(d), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid expiry: %s", s)
+}
+
+func parsePolicy(allow, deny, defaultModel string) (Policy, error) {
+	var policy Policy
+	var err error
+	if policy.AllowModels, err = ParsePatterns(allow); err != nil {
+		return policy, err
+	}
+	if policy.DenyModels, err = ParsePatterns(deny); err != nil {
+		return policy, err
+	}
+	policy.DefaultModel = strings.TrimSpace(defaultModel)
+	return policy, nil
+}
+
+func joinScopes(scopes []Scope) string {
+	s := make([]string, len(scopes))
+	for i, scope := range scopes {
+		s[i] = string(scope)
+	}
+	return strings.Join(s, ",")
+}
@@ -0,0 +1,156 @@
+package apikey
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"monica-proxy/internal/usage"
+)
+
+// Scope API 密钥的权限范围
+type Scope string
+
+const (
+	ScopeChat   Scope = "chat"   // 对话、补全、Responses、Gemini、Ollama 等文本接口
+	ScopeImages Scope = "images" // 图片生成接口
+	ScopeAdmin  Scope = "admin"  // 账号管理接口
+)
+
+// AllScopes 全部权限范围
+var AllScopes = []Scope{ScopeChat, ScopeImages, ScopeAdmin}
+
+// DefaultScopes 创建密钥时未指定权限范围使用的默认值
+var DefaultScopes = []Scope{ScopeChat, ScopeImages}
+
+// ParseScopes 解析以逗号分隔的权限范围，如 "chat,images"
+func ParseScopes(s string) ([]Scope, error) {
+	var scopes []Scope
+	for _, item := range strings.Split(s, ",") {
+		scope := Scope(strings.ToLower(strings.TrimSpace(item)))
+		if scope == "" {
+			continue
+		}
+		if !slices.Contains(AllScopes, scope) {
+			return nil, fmt.Errorf("unknown api key scope: %s", scope)
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes, nil
+}
+
+// Key 一个 API 密钥。只保存加盐哈希，明文只在创建时返回一次
+type Key struct {
+	ID        string        `json:"id"`
+	Name      string        `json:"name"`
+	Owner     string        `json:"owner,omitempty"`
+	Scopes    []Scope       `json:"scopes"`
+	Prefix    string        `json:"prefix,omitempty"` // 明文的前几位，仅用于辨认密钥
+	Salt      string        `json:"salt"`
+	Hash      string        `json:"hash"` // hex(sha256(salt || key))
+	CreatedAt time.Time     `json:"created_at"`
+	ExpiresAt time.Time     `json:"expires_at,omitempty"` // 零值表示不过期
+	Disabled  bool          `json:"disabled,omitempty"`
+	Policy                  // 允许使用的模型
+	RPM       int           `json:"rpm,omitempty"`    // 每分钟请求数上限，为 0 时使用 RATE_LIMIT_RPM
+	TPM       int           `json:"tpm,omitempty"`    // 每分钟 token 上限，为 0 时使用 RATE_LIMIT_TPM
+	Quotas    []usage.Quota `json:"quotas,omitempty"` // 按模型组覆盖 QUOTA_FILE 中的默认配额
+
+	// Plaintext 旧版本凭据库保存的明文密钥，加载时转换为哈希后清空
+	Plaintext string `json:"key,omitempty"`
+}
+
+// prefixLen 记录的明文前缀长度，"sk-" 加 4 位随机字符
+const prefixLen = 7
+
+// Generate 使用安全随机数生成 API 密钥
+func Generate() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "sk-" + hex.EncodeToString(b), nil
+}
+
+// NewKey 根据明文密钥创建 Key，生成随机 ID 与盐值
+func NewKey(name, token string, scopes []Scope) (*Key, error) {
+	id, err := randomHex(6)
+	if err != nil {
+		return nil, err
+	}
+	k := &Key{ID: "key_" + id, Name: name, Scopes: scopes, CreatedAt: time.Now()}
+	if err := k.setSecret(token); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// setSecret 为明文密钥生成新的盐值与哈希
+func (k *Key) setSecret(token string) error {
+	salt, err := randomHex(16)
+	if err != nil {
+		return err
+	}
+	k.Salt = salt
+	k.Hash = hashToken(salt, token)
+	k.Prefix = ""
+	// 太短的密钥不记录前缀，避免泄露过多内容
+	if len(token) >= 4*prefixLen {
+		k.Prefix = token[:prefixLen]
+	}
+	return nil
+}
+
+// Match 以常量时间比较明文密钥与保存的哈希
+func (k *Key) Match(token string) bool {
+	expected, err := hex.DecodeString(k.Hash)
+	if err != nil || len(expected) != sha256.Size {
+		return false
+	}
+	actual, _ := hex.DecodeString(hashToken(k.Salt, token))
+	return subtle.ConstantTimeCompare(actual, expected) == 1
+}
+
+// HasScope 返回密钥是否拥有指定的权限范围
+func (k *Key) HasScope(scope Scope) bool {
+	return slices.Contains(k.Scopes, scope)
+}
+
+// Expired 返回密钥在 now 时是否已经过期
+func (k *Key) Expired(now time.Time) bool {
+	return !k.ExpiresAt.IsZero() && !now.Before(k.ExpiresAt)
+}
+
+func hashToken(salt, token string) string {
+	sum := sha256.Sum256([]byte(salt + token))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+type contextKey struct{}
+
+// WithKey 将本次请求认证通过的密钥放入 context，供排队公平性等下游逻辑读取
+func WithKey(ctx context.Context, k *Key) context.Context {
+	return context.WithValue(ctx, contextKey{}, k)
+}
+
+// FromContext 返回 context 中的密钥，未经过认证时返回 nil
+func FromContext(ctx context.Context) *Key {
+	k, _ := ctx.Value(contextKey{}).(*Key)
+	return k
+}
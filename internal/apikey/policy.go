@@ -0,0 +1,81 @@
+package apikey
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// ErrModelNotAllowed 密钥的模型策略不允许使用请求的模型
+var ErrModelNotAllowed = errors.New("model is not allowed for this api key")
+
+// Policy 密钥可以使用的模型。模型名支持 glob 通配符，如 "gpt-4o*"、"claude-*"，不区分大小写
+type Policy struct {
+	AllowModels  []string `json:"allow_models,omitempty"`  // 为空时允许全部模型
+	DenyModels   []string `json:"deny_models,omitempty"`   // 优先于 AllowModels
+	DefaultModel string   `json:"default_model,omitempty"` // 请求被禁止的模型时改用该模型，为空时拒绝请求
+}
+
+// ParsePatterns 解析以逗号分隔的模型通配符并校验语法
+func ParsePatterns(s string) ([]string, error) {
+	var patterns []string
+	for _, item := range strings.Split(s, ",") {
+		pattern := strings.ToLower(strings.TrimSpace(item))
+		if pattern == "" {
+			continue
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid model pattern %q: %v", pattern, err)
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, nil
+}
+
+// Validate 校验通配符语法，默认模型必须被策略允许
+func (p Policy) Validate() error {
+	for _, pattern := range append(append([]string{}, p.AllowModels...), p.DenyModels...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid model pattern %q: %v", pattern, err)
+		}
+	}
+	if p.DefaultModel != "" && !p.AllowsModel(p.DefaultModel) {
+		return fmt.Errorf("default model %s is not allowed by the policy", p.DefaultModel)
+	}
+	return nil
+}
+
+// AllowsModel 返回策略是否允许使用 model
+func (p Policy) AllowsModel(model string) bool {
+	model = strings.ToLower(model)
+	if matchAny(p.DenyModels, model) {
+		return false
+	}
+	return len(p.AllowModels) == 0 || matchAny(p.AllowModels, model)
+}
+
+// ResolveModel 返回实际使用的模型：允许时原样返回，被禁止时替换为默认模型，没有默认模型时返回 ErrModelNotAllowed
+func (p Policy) ResolveModel(model string) (string, error) {
+	if p.AllowsModel(model) {
+		return model, nil
+	}
+	if p.DefaultModel != "" && p.AllowsModel(p.DefaultModel) {
+		return p.DefaultModel, nil
+	}
+	return "", fmt.Errorf("%w: %s", ErrModelNotAllowed, model)
+}
+
+// Restricted 返回策略是否限制了模型
+func (p Policy) Restricted() bool {
+	return len(p.AllowModels) > 0 || len(p.DenyModels) > 0
+}
+
+func matchAny(patterns []string, model string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(strings.ToLower(pattern), model); ok {
+			return true
+		}
+	}
+	return false
+}
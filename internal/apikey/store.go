@@ -0,0 +1,403 @@
+package apikey
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"monica-proxy/internal/usage"
+	"monica-proxy/internal/utils"
+)
+
+var (
+	ErrInvalidKey  = errors.New("invalid api key")
+	ErrKeyDisabled = errors.New("api key is disabled")
+	ErrKeyExpired  = errors.New("api key has expired")
+	ErrKeyNotFound = errors.New("api key not found")
+	ErrKeyExists   = errors.New("api key already exists")
+	ErrNoKeyStore  = errors.New("api key store is not configured, set CREDSTORE_FILE or API_KEYS_FILE")
+)
+
+// DefaultStore 全局 API 密钥库，启动时创建
+var DefaultStore *Store
+
+// WatchInterval 检查密钥文件是否修改的间隔
+const WatchInterval = 30 * time.Second
+
+// Backend API 密钥的持久化来源
+type Backend interface {
+	Load() ([]Key, error)
+	Save(keys []Key) error
+}
+
+// FileBackend JSON 格式的密钥文件，只保存加盐哈希
+type FileBackend struct {
+	Path string
+}
+
+// Load 读取密钥文件，文件不存在时视为没有密钥
+func (f *FileBackend) Load() ([]Key, error) {
+	data, err := os.ReadFile(f.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read api keys file failed: %v", err)
+	}
+	var keys []Key
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("parse api keys file failed: %v", err)
+	}
+	return keys, nil
+}
+
+// Save 写回密钥文件
+func (f *FileBackend) Save(keys []Key) error {
+	if keys == nil {
+		keys = []Key{}
+	}
+	data, err := json.MarshalIndent(keys, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := utils.WriteFileAtomic(f.Path, data); err != nil {
+		return fmt.Errorf("write api keys file failed: %v", err)
+	}
+	return nil
+}
+
+// Store API 密钥库：内置密钥来自 BEARER_TOKEN / ADMIN_TOKEN，其余密钥来自 backend
+type Store struct {
+	mu      sync.RWMutex
+	builtin []*Key
+	keys    []*Key
+	backend Backend
+}
+
+// NewStore 创建密钥库，backend 为空时只有内置密钥
+func NewStore(backend Backend) *Store {
+	return &Store{backend: backend}
+}
+
+// AddBuiltin 添加来自配置的内置密钥，id 同时作为名称，token 为空时忽略
+func (s *Store) AddBuiltin(id, token string, scopes ...Scope) error {
+	if token == "" {
+		return nil
+	}
+	k := &Key{ID: id, Name: id, Scopes: scopes, CreatedAt: time.Now()}
+	if err := k.setSecret(token); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.builtin = append(s.builtin, k)
+	return nil
+}
+
+// Load 从 backend 读取密钥并整体替换，启动与重新加载时调用，读取或解析失败时保留当前的密钥。
+// 旧版本保存的明文密钥转换为哈希并写回
+func (s *Store) Load() error {
+	if s.backend == nil {
+		return nil
+	}
+	records, err := s.backend.Load()
+	if err != nil {
+		return err
+	}
+
+	migrated := false
+	keys := make([]*Key, 0, len(records))
+	for i := range records {
+		k := records[i]
+		if k.Plaintext != "" {
+			if k.Hash == "" {
+				if err := k.setSecret(k.Plaintext); err != nil {
+					return err
+				}
+			}
+			k.Plaintext = ""
+			migrated = true
+		}
+		if k.ID == "" {
+			id, err := randomHex(6)
+			if err != nil {
+				return err
+			}
+			k.ID = "key_" + id
+			migrated = true
+		}
+		if k.Scopes == nil {
+			k.Scopes = DefaultScopes
+			migrated = true
+		}
+		keys = append(keys, &k)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = keys
+	if migrated {
+		return s.saveLocked()
+	}
+	return nil
+}
+
+// Watch 在后台定期检查密钥文件（API_KEYS_FILE 或凭据库），修改时间或大小变化后重新加载，
+// 使 keys disable、keys remove 等命令无需重启即可生效
+func (s *Store) Watch(ctx context.Context, path string, interval time.Duration) {
+	var modTime time.Time
+	var size int64
+	if info, err := os.Stat(path); err == nil {
+		modTime, size = info.ModTime(), info.Size()
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			info, err := os.Stat(path)
+			if err != nil {
+				log.Printf("check api keys file failed: %v", err)
+				continue
+			}
+			if info.ModTime().Equal(modTime) && info.Size() == size {
+				continue
+			}
+			modTime, size = info.ModTime(), info.Size()
+			if err := s.Load(); err != nil {
+				log.Printf("reload api keys failed, keeping previous keys: %v", err)
+				continue
+			}
+			log.Printf("Reloaded api keys %s: %d keys", path, s.Len())
+		}
+	}()
+}
+
+// Len 返回可用于认证的密钥数量，包含内置密钥
+func (s *Store) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.builtin) + len(s.keys)
+}
+
+// Authenticate 校验明文密钥，返回对应的密钥。每个密钥都以常量时间比较哈希
+func (s *Store) Authenticate(token string) (*Key, error) {
+	if token == "" {
+		return nil, ErrInvalidKey
+	}
+	s.mu.RLock()
+	var matched *Key
+	for _, list := range [][]*Key{s.builtin, s.keys} {
+		for _, k := range list {
+			if k.Match(token) && matched == nil {
+				// 返回副本，之后停用或删除密钥不影响正在处理的请求
+				copied := *k
+				matched = &copied
+			}
+		}
+	}
+	s.mu.RUnlock()
+
+	switch {
+	case matched == nil:
+		return nil, ErrInvalidKey
+	case matched.Disabled:
+		return nil, ErrKeyDisabled
+	case matched.Expired(time.Now()):
+		return nil, ErrKeyExpired
+	}
+	return matched, nil
+}
+
+// List 返回 backend 中的全部密钥，不包含内置密钥
+func (s *Store) List() []Key {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	keys := make([]Key, 0, len(s.keys))
+	for _, k := range s.keys {
+		keys = append(keys, *k)
+	}
+	return keys
+}
+
+// Create 创建密钥并写回 backend，token 为空时随机生成。返回的明文只有这一次可以看到
+func (s *Store) Create(name, owner, token string, scopes []Scope, expiresAt time.Time, policy Policy, rpm, tpm int) (string, Key, error) {
+	if s.backend == nil {
+		return "", Key{}, ErrNoKeyStore
+	}
+	if name == "" {
+		return "", Key{}, errors.New("api key name is required")
+	}
+	if err := policy.Validate(); err != nil {
+		return "", Key{}, err
+	}
+	if rpm < 0 || tpm < 0 {
+		return "", Key{}, errors.New("rate limits must not be negative")
+	}
+	if len(scopes) == 0 {
+		scopes = DefaultScopes
+	}
+	if token == "" {
+		var err error
+		if token, err = Generate(); err != nil {
+			return "", Key{}, err
+		}
+	}
+	k, err := NewKey(name, token, scopes)
+	if err != nil {
+		return "", Key{}, err
+	}
+	k.Owner = owner
+	k.ExpiresAt = expiresAt
+	k.Policy = policy
+	k.RPM, k.TPM = rpm, tpm
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, list := range [][]*Key{s.builtin, s.keys} {
+		for _, existing := range list {
+			if existing.Name == name {
+				return "", Key{}, ErrKeyExists
+			}
+			if existing.Match(token) {
+				return "", Key{}, fmt.Errorf("%w: same key as %s", ErrKeyExists, existing.Name)
+			}
+		}
+	}
+	s.keys = append(s.keys, k)
+	if err := s.saveLocked(); err != nil {
+		s.keys = s.keys[:len(s.keys)-1]
+		return "", Key{}, err
+	}
+	return token, *k, nil
+}
+
+// SetDisabled 停用或启用密钥，ref 为密钥 ID 或名称
+func (s *Store) SetDisabled(ref string, disabled bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k, _ := s.findLocked(ref)
+	if k == nil {
+		return ErrKeyNotFound
+	}
+	old := k.Disabled
+	k.Disabled = disabled
+	if err := s.saveLocked(); err != nil {
+		k.Disabled = old
+		return err
+	}
+	return nil
+}
+
+// SetPolicy 替换密钥的模型策略，ref 为密钥 ID 或名称
+func (s *Store) SetPolicy(ref string, policy Policy) error {
+	if err := policy.Validate(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k, _ := s.findLocked(ref)
+	if k == nil {
+		return ErrKeyNotFound
+	}
+	old := k.Policy
+	k.Policy = policy
+	if err := s.saveLocked(); err != nil {
+		k.Policy = old
+		return err
+	}
+	return nil
+}
+
+// SetLimits 修改密钥的速率限制，为 0 时使用全局默认值
+func (s *Store) SetLimits(ref string, rpm, tpm int) error {
+	if rpm < 0 || tpm < 0 {
+		return errors.New("rate limits must not be negative")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k, _ := s.findLocked(ref)
+	if k == nil {
+		return ErrKeyNotFound
+	}
+	oldRPM, oldTPM := k.RPM, k.TPM
+	k.RPM, k.TPM = rpm, tpm
+	if err := s.saveLocked(); err != nil {
+		k.RPM, k.TPM = oldRPM, oldTPM
+		return err
+	}
+	return nil
+}
+
+// SetQuota 设置密钥对某个模型组的配额，覆盖默认配额；daily 与 monthly 都为 0 时删除该模型组的配额，恢复默认值
+func (s *Store) SetQuota(ref string, quota usage.Quota) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k, _ := s.findLocked(ref)
+	if k == nil {
+		return ErrKeyNotFound
+	}
+	old := k.Quotas
+	quotas := make([]usage.Quota, 0, len(old)+1)
+	for _, q := range old {
+		if q.Group != quota.Group {
+			quotas = append(quotas, q)
+		}
+	}
+	if quota.Daily > 0 || quota.Monthly > 0 {
+		quotas = append(quotas, quota)
+	}
+	k.Quotas = quotas
+	if err := s.saveLocked(); err != nil {
+		k.Quotas = old
+		return err
+	}
+	return nil
+}
+
+// Remove 删除密钥，ref 为密钥 ID 或名称
+func (s *Store) Remove(ref string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k, i := s.findLocked(ref)
+	if k == nil {
+		return ErrKeyNotFound
+	}
+	old := s.keys
+	s.keys = append(s.keys[:i:i], s.keys[i+1:]...)
+	if err := s.saveLocked(); err != nil {
+		s.keys = old
+		return err
+	}
+	return nil
+}
+
+// findLocked 按 ID 或名称查找 backend 中的密钥，内置密钥不能修改
+func (s *Store) findLocked(ref string) (*Key, int) {
+	for i, k := range s.keys {
+		if k.ID == ref || k.Name == ref {
+			return k, i
+		}
+	}
+	return nil, -1
+}
+
+func (s *Store) saveLocked() error {
+	if s.backend == nil {
+		return ErrNoKeyStore
+	}
+	keys := make([]Key, 0, len(s.keys))
+	for _, k := range s.keys {
+		keys = append(keys, *k)
+	}
+	return s.backend.Save(keys)
+}
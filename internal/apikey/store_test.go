@@ -0,0 +1,159 @@
+package apikey
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newFileStore(t *testing.T) (*Store, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "keys.json")
+	return NewStore(&FileBackend{Path: path}), path
+}
+
+func TestAuthenticate(t *testing.T) {
+	s, _ := newFileStore(t)
+	active, _, err := s.Create("active", "", "", nil, time.Time{}, Policy{}, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	disabled, _, err := s.Create("disabled", "", "", nil, time.Time{}, Policy{}, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetDisabled("disabled", true); err != nil {
+		t.Fatal(err)
+	}
+	expired, _, err := s.Create("expired", "", "", nil, time.Now().Add(-time.Minute), Policy{}, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		err   error
+	}{
+		{"active", active, nil},
+		{"disabled", disabled, ErrKeyDisabled},
+		{"expired", expired, ErrKeyExpired},
+		{"unknown", active + "x", ErrInvalidKey},
+		{"empty", "", ErrInvalidKey},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k, err := s.Authenticate(tt.token)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+			if err == nil && k.Name != tt.name {
+				t.Fatalf("authenticated as %s, want %s", k.Name, tt.name)
+			}
+		})
+	}
+
+	// 重新启用后可以使用
+	if err := s.SetDisabled("disabled", false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Authenticate(disabled); err != nil {
+		t.Fatalf("re-enabled key: %v", err)
+	}
+}
+
+func TestLoadMigratesPlaintextKeys(t *testing.T) {
+	s, path := newFileStore(t)
+	const token = "sk-legacy-plaintext-token"
+	legacy := `[{"name":"legacy","key":"` + token + `"}]`
+	if err := os.WriteFile(path, []byte(legacy), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Load(); err != nil {
+		t.Fatal(err)
+	}
+	k, err := s.Authenticate(token)
+	if err != nil {
+		t.Fatalf("authenticate migrated key: %v", err)
+	}
+	if !strings.HasPrefix(k.ID, "key_") || len(k.Scopes) == 0 {
+		t.Fatalf("migrated key id %q scopes %v", k.ID, k.Scopes)
+	}
+
+	// 写回的文件只保存加盐哈希
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), token) {
+		t.Fatal("plaintext key still present in the key file")
+	}
+	var saved []Key
+	if err := json.Unmarshal(data, &saved); err != nil {
+		t.Fatal(err)
+	}
+	if len(saved) != 1 || saved[0].Hash == "" || saved[0].Salt == "" || saved[0].Plaintext != "" || saved[0].ID != k.ID {
+		t.Fatalf("saved keys = %+v", saved)
+	}
+
+	// 再次加载迁移后的文件仍然可以认证
+	reloaded := NewStore(&FileBackend{Path: path})
+	if err := reloaded.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reloaded.Authenticate(token); err != nil {
+		t.Fatalf("authenticate after reload: %v", err)
+	}
+}
+
+func TestWatchReloadsKeys(t *testing.T) {
+	s, path := newFileStore(t)
+	token, _, err := s.Create("ci", "", "", nil, time.Time{}, Policy{}, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s.Watch(ctx, path, 10*time.Millisecond)
+
+	// 其他进程（keys disable）修改文件后自动生效
+	other := NewStore(&FileBackend{Path: path})
+	if err := other.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if err := other.SetDisabled("ci", true); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool {
+		_, err := s.Authenticate(token)
+		return errors.Is(err, ErrKeyDisabled)
+	})
+
+	// 新文件无法解析时保留之前的密钥
+	if err := os.WriteFile(path, []byte("{not json"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Load(); err == nil {
+		t.Fatal("loading a broken key file succeeded")
+	}
+	if _, err := s.Authenticate(token); !errors.Is(err, ErrKeyDisabled) {
+		t.Fatalf("after broken reload err = %v, want ErrKeyDisabled", err)
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met before deadline")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
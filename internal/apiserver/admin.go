@@ -0,0 +1,185 @@
+package apiserver
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"monica-proxy/internal/account"
+	"monica-proxy/internal/utils"
+)
+
+// accountView 管理接口返回的账号信息，不包含 cookie
+type accountView struct {
+	ID             string         `json:"id"`
+	Weight         int            `json:"weight"`
+	MaxConcurrency int            `json:"max_concurrency"`
+	Proxy          string         `json:"proxy,omitempty"`
+	Source         account.Source `json:"source"`
+	Disabled       bool           `json:"disabled"`
+	Expiry         account.Expiry `json:"expiry"`
+	InFlight       int64          `json:"in_flight"`
+	Health         account.Health `json:"health"`
+	Stats          account.Stats  `json:"stats"`
+}
+
+func newAccountView(a *account.Account) accountView {
+	return accountView{
+		ID:             a.ID,
+		Weight:         a.Weight,
+		MaxConcurrency: a.MaxConcurrency,
+		Proxy:          utils.RedactProxy(a.Proxy),
+		Source:         a.Source,
+		Disabled:       a.Disabled(),
+		Expiry:         account.DefaultPool.ExpiryOf(a),
+		InFlight:       a.InFlight(),
+		Health:         a.Health(),
+		Stats:          a.Stats(),
+	}
+}
+
+// adminAccountRequest 添加或修改账号的请求体，修改时省略的字段保持不变
+type adminAccountRequest struct {
+	ID             string  `json:"id"`
+	Cookie         *string `json:"cookie"`
+	Weight         *int    `json:"weight"`
+	MaxConcurrency *int    `json:"max_concurrency"`
+	Proxy          *string `json:"proxy"`
+	Disabled       *bool   `json:"disabled"`
+}
+
+// registerAdminRoutes 注册账号管理接口
+func registerAdminRoutes(g *echo.Group) {
+	g.GET("/accounts", handleListAccounts)
+	g.POST("/accounts", handleAddAccount)
+	// 账号健康状态
+	g.GET("/accounts/health", handleListAccounts)
+	g.GET("/accounts/:id", handleGetAccount)
+	g.PATCH("/accounts/:id", handleUpdateAccount)
+	g.DELETE("/accounts/:id", handleDeleteAccount)
+	g.POST("/accounts/:id/disable", handleSetAccountDisabled(true))
+	g.POST("/accounts/:id/enable", handleSetAccountDisabled(false))
+	// 并发与排队情况
+	g.GET("/queue", handleQueueStats)
+}
+
+// adminError 将账号池返回的错误转换为 OpenAI 风格错误
+func adminError(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, account.ErrAccountNotFound):
+		return openAIError(c, http.StatusNotFound, "invalid_request_error", err.Error())
+	case errors.Is(err, utils.ErrInvalidProxy):
+		return openAIParamError(c, http.StatusBadRequest, "proxy", "", err.Error())
+	case errors.Is(err, account.ErrCookieExpired):
+		return openAIParamError(c, http.StatusBadRequest, "cookie", "cookie_expired", err.Error())
+	case errors.Is(err, account.ErrAccountExists), errors.Is(err, account.ErrReadOnlyAccount), errors.Is(err, account.ErrNoAccountStore):
+		return openAIError(c, http.StatusConflict, "invalid_request_error", err.Error())
+	}
+	return openAIError(c, http.StatusInternalServerError, "server_error", err.Error())
+}
+
+// handleListAccounts 返回账号池中全部账号的状态、最近的状态变更与调用统计
+func handleListAccounts(c echo.Context) error {
+	pool := account.DefaultPool
+	accounts := make([]accountView, 0)
+	expiring := make([]string, 0)
+	for _, a := range pool.Accounts() {
+		view := newAccountView(a)
+		if view.Expiry.Warning {
+			expiring = append(expiring, a.ID)
+		}
+		accounts = append(accounts, view)
+	}
+	return c.JSON(http.StatusOK, map[string]any{
+		"strategy":             pool.Strategy(),
+		"expiring":             expiring,
+		"sticky_conversations": pool.StickyConversations(),
+		"queue":                pool.QueueStats(),
+		"accounts":             accounts,
+	})
+}
+
+// handleGetAccount 返回单个账号
+func handleGetAccount(c echo.Context) error {
+	a := account.DefaultPool.Get(c.Param("id"))
+	if a == nil {
+		return adminError(c, account.ErrAccountNotFound)
+	}
+	return c.JSON(http.StatusOK, newAccountView(a))
+}
+
+// handleAddAccount 添加账号，id 省略时根据 cookie 生成
+func handleAddAccount(c echo.Context) error {
+	var req adminAccountRequest
+	if err := c.Bind(&req); err != nil {
+		return openAIError(c, http.StatusBadRequest, "invalid_request_error", "Invalid request payload")
+	}
+	if req.Cookie == nil || *req.Cookie == "" {
+		return openAIParamError(c, http.StatusBadRequest, "cookie", "", "cookie is required")
+	}
+	weight := 1
+	if req.Weight != nil {
+		weight = *req.Weight
+	}
+
+	a := account.NewAccount(req.ID, *req.Cookie, weight)
+	if req.MaxConcurrency != nil {
+		a.MaxConcurrency = max(*req.MaxConcurrency, 0)
+	}
+	if req.Proxy != nil {
+		a.Proxy = *req.Proxy
+	}
+	if err := account.DefaultPool.Add(a, req.Disabled != nil && *req.Disabled); err != nil {
+		return adminError(c, err)
+	}
+	return c.JSON(http.StatusCreated, newAccountView(a))
+}
+
+// handleUpdateAccount 修改账号的 cookie、权重或停用状态
+func handleUpdateAccount(c echo.Context) error {
+	var req adminAccountRequest
+	if err := c.Bind(&req); err != nil {
+		return openAIError(c, http.StatusBadRequest, "invalid_request_error", "Invalid request payload")
+	}
+	if req.Cookie != nil && *req.Cookie == "" {
+		return openAIParamError(c, http.StatusBadRequest, "cookie", "", "cookie must not be empty")
+	}
+
+	a, err := account.DefaultPool.Update(c.Param("id"), account.AccountUpdate{
+		Cookie:         req.Cookie,
+		Weight:         req.Weight,
+		MaxConcurrency: req.MaxConcurrency,
+		Proxy:          req.Proxy,
+		Disabled:       req.Disabled,
+	})
+	if err != nil {
+		return adminError(c, err)
+	}
+	return c.JSON(http.StatusOK, newAccountView(a))
+}
+
+// handleSetAccountDisabled 停用或启用账号
+func handleSetAccountDisabled(disabled bool) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		a, err := account.DefaultPool.Update(c.Param("id"), account.AccountUpdate{Disabled: &disabled})
+		if err != nil {
+			return adminError(c, err)
+		}
+		return c.JSON(http.StatusOK, newAccountView(a))
+	}
+}
+
+// handleDeleteAccount 删除账号
+func handleDeleteAccount(c echo.Context) error {
+	id := c.Param("id")
+	if err := account.DefaultPool.Remove(id); err != nil {
+		return adminError(c, err)
+	}
+	return c.JSON(http.StatusOK, map[string]any{"id": id, "deleted": true})
+}
+
+// handleQueueStats 返回全局并发、排队深度与等待时间
+func handleQueueStats(c echo.Context) error {
+	return c.JSON(http.StatusOK, account.DefaultPool.QueueStats())
+}
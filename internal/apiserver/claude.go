@@ -0,0 +1,74 @@
+package apiserver
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"monica-proxy/internal/monica"
+	"monica-proxy/internal/types"
+)
+
+// claudeError 返回 Anthropic 风格的错误信封
+func claudeError(c echo.Context, status int, errType, message string) error {
+	return c.JSON(status, types.ClaudeErrorResponse{
+		Type:  "error",
+		Error: types.ClaudeError{Type: errType, Message: message},
+	})
+}
+
+// handleClaudeMessages 处理 Anthropic Messages API 格式的请求
+func handleClaudeMessages(c echo.Context) error {
+	var req types.ClaudeRequest
+	if err := c.Bind(&req); err != nil {
+		return claudeError(c, http.StatusBadRequest, "invalid_request_error", "Invalid request payload")
+	}
+
+	var err error
+	if req.Model, err = resolveModel(c, req.Model); err != nil {
+		return claudeError(c, http.StatusForbidden, "permission_error", err.Error())
+	}
+	if !types.IsModelSupported(req.Model) {
+		return claudeError(c, http.StatusNotFound, "not_found_error", "Model not supported")
+	}
+
+	if len(req.Messages) == 0 {
+		return claudeError(c, http.StatusBadRequest, "invalid_request_error", "No messages found")
+	}
+
+	chatReq, err := types.ClaudeToChatGPT(req)
+	if err != nil {
+		return claudeError(c, http.StatusBadRequest, "invalid_request_error", err.Error())
+	}
+
+	body, err := openMonicaStream(c.Request().Context(), chatReq)
+	if err != nil {
+		status, _ := upstreamStatus(c, err)
+		errType := "api_error"
+		switch status {
+		case http.StatusBadRequest:
+			errType = "invalid_request_error"
+		case http.StatusNotFound:
+			errType = "not_found_error"
+		case http.StatusTooManyRequests:
+			errType = "rate_limit_error"
+		}
+		return claudeError(c, status, errType, err.Error())
+	}
+	defer body.Close()
+
+	if req.Stream {
+		c.Response().Header().Set(echo.HeaderContentType, "text/event-stream")
+		c.Response().Header().Set("Cache-Control", "no-cache")
+		c.Response().Header().Set("Transfer-Encoding", "chunked")
+		c.Response().WriteHeader(http.StatusOK)
+
+		return monica.StreamMonicaSSEToClaude(c.Request().Context(), req, chatReq, c.Response().Writer, body)
+	}
+
+	response, err := monica.ProcessMonicaResponseToClaude(c.Request().Context(), req, chatReq, body)
+	if err != nil {
+		return claudeError(c, http.StatusInternalServerError, "api_error", err.Error())
+	}
+	return c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,74 @@
+package apiserver
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sashabaranov/go-openai"
+
+	"monica-proxy/internal/config"
+	"monica-proxy/internal/monica"
+	"monica-proxy/internal/types"
+)
+
+// handleCompletions 处理传统 /v1/completions 文本补全请求，每个 prompt 对应一个独立的 Monica 会话
+func handleCompletions(c echo.Context) error {
+	var req openai.CompletionRequest
+	if err := c.Bind(&req); err != nil {
+		return openAIError(c, http.StatusBadRequest, "invalid_request_error", "Invalid request payload")
+	}
+
+	var err error
+	if req.Model, err = resolveModel(c, req.Model); err != nil {
+		return openAIParamError(c, http.StatusForbidden, "model", modelNotAllowedCode, err.Error())
+	}
+	if !types.IsModelSupported(req.Model) {
+		return openAIError(c, http.StatusBadRequest, "invalid_request_error", "Model not supported")
+	}
+
+	prompts, err := types.CompletionPrompts(req)
+	if err != nil {
+		return openAIError(c, http.StatusBadRequest, "invalid_request_error", err.Error())
+	}
+	if len(prompts) == 0 {
+		return openAIError(c, http.StatusBadRequest, "invalid_request_error", "No prompt found")
+	}
+	// 每个 prompt 占用一个 Monica 会话，与 chat 的 n 使用同一上限
+	if len(prompts) > config.MonicaConfig.MaxChoices {
+		return openAIParamError(c, http.StatusBadRequest, "prompt", "",
+			fmt.Sprintf("prompt must contain at most %d entries", config.MonicaConfig.MaxChoices))
+	}
+
+	chatReqs := make([]openai.ChatCompletionRequest, len(prompts))
+	for i, prompt := range prompts {
+		chatReqs[i] = types.CompletionToChatGPT(req, prompt)
+	}
+
+	bodies, err := openMonicaStreams(c.Request().Context(), chatReqs)
+	if err != nil {
+		return upstreamError(c, err)
+	}
+	defer closeAll(bodies)
+
+	readers := make([]io.Reader, len(bodies))
+	for i, body := range bodies {
+		readers[i] = body
+	}
+
+	if req.Stream {
+		c.Response().Header().Set(echo.HeaderContentType, "text/event-stream")
+		c.Response().Header().Set("Cache-Control", "no-cache")
+		c.Response().Header().Set("Transfer-Encoding", "chunked")
+		c.Response().WriteHeader(http.StatusOK)
+
+		return monica.StreamMonicaSSEToCompletion(c.Request().Context(), req, prompts, chatReqs, c.Response().Writer, readers)
+	}
+
+	response, err := monica.ProcessMonicaResponseToCompletion(c.Request().Context(), req, prompts, chatReqs, readers)
+	if err != nil {
+		return openAIError(c, http.StatusInternalServerError, "server_error", err.Error())
+	}
+	return c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,117 @@
+package apiserver
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sashabaranov/go-openai"
+
+	"monica-proxy/internal/account"
+	"monica-proxy/internal/middleware"
+	"monica-proxy/internal/ratelimit"
+	"monica-proxy/internal/types"
+	"monica-proxy/internal/usage"
+)
+
+// openAIError 返回 OpenAI 风格的错误信封
+func openAIError(c echo.Context, status int, errType, message string) error {
+	return c.JSON(status, openai.ErrorResponse{
+		Error: &openai.APIError{
+			Type:    errType,
+			Message: message,
+		},
+	})
+}
+
+// openAIParamError 返回带 param 与 code 的 OpenAI 风格错误
+func openAIParamError(c echo.Context, status int, param, code, message string) error {
+	apiErr := &openai.APIError{
+		Type:    "invalid_request_error",
+		Message: message,
+		Code:    code,
+	}
+	if param != "" {
+		apiErr.Param = &param
+	}
+	return c.JSON(status, openai.ErrorResponse{Error: apiErr})
+}
+
+// capabilityError 将模型能力校验失败转换为 OpenAI 风格错误，其他错误按 400 处理
+func capabilityError(c echo.Context, err error) error {
+	var capErr *types.CapabilityError
+	if !errors.As(err, &capErr) {
+		return openAIError(c, http.StatusBadRequest, "invalid_request_error", err.Error())
+	}
+	status := http.StatusBadRequest
+	if capErr.Code == "model_not_found" {
+		status = http.StatusNotFound
+	}
+	return openAIParamError(c, status, capErr.Param, capErr.Code, capErr.Message)
+}
+
+// upstreamStatus 根据上游失败分类返回对客户端的响应码与 OpenAI 风格的错误类型，
+// 排队失败时设置 Retry-After
+func upstreamStatus(c echo.Context, err error) (int, string) {
+	var capErr *types.CapabilityError
+	if errors.As(err, &capErr) {
+		if capErr.Code == "model_not_found" {
+			return http.StatusNotFound, "invalid_request_error"
+		}
+		return http.StatusBadRequest, "invalid_request_error"
+	}
+	if errors.Is(err, account.ErrNoAccount) {
+		return http.StatusServiceUnavailable, "server_error"
+	}
+	var limitErr *ratelimit.Error
+	if errors.As(err, &limitErr) {
+		c.Response().Header().Set("Retry-After", strconv.Itoa(limitErr.RetryAfterSeconds()))
+		return http.StatusTooManyRequests, "rate_limit_error"
+	}
+	var quotaErr *usage.QuotaError
+	if errors.As(err, &quotaErr) {
+		return http.StatusTooManyRequests, "insufficient_quota"
+	}
+	var queueErr *account.QueueError
+	if errors.As(err, &queueErr) {
+		c.Response().Header().Set("Retry-After", strconv.Itoa(int(queueErr.RetryAfter.Seconds())))
+		if queueErr.Full {
+			return http.StatusTooManyRequests, "rate_limit_error"
+		}
+		return http.StatusServiceUnavailable, "server_error"
+	}
+	var upErr *account.UpstreamError
+	if !errors.As(err, &upErr) {
+		return http.StatusInternalServerError, "server_error"
+	}
+	switch upErr.Outcome {
+	case account.OutcomeRateLimited:
+		return http.StatusTooManyRequests, "rate_limit_error"
+	case account.OutcomeOutOfCredits:
+		return http.StatusTooManyRequests, "insufficient_quota"
+	case account.OutcomeAuthExpired:
+		return http.StatusServiceUnavailable, "server_error"
+	}
+	return http.StatusBadGateway, "server_error"
+}
+
+// upstreamError 将建立上游连接的失败转换为 OpenAI 风格错误
+func upstreamError(c echo.Context, err error) error {
+	var capErr *types.CapabilityError
+	if errors.As(err, &capErr) {
+		return capabilityError(c, err)
+	}
+	var limitErr *ratelimit.Error
+	if errors.As(err, &limitErr) {
+		return middleware.RateLimitError(c, err)
+	}
+	status, errType := upstreamStatus(c, err)
+	var quotaErr *usage.QuotaError
+	if errors.As(err, &quotaErr) {
+		return c.JSON(status, openai.ErrorResponse{
+			Error: &openai.APIError{Type: errType, Code: "insufficient_quota", Message: err.Error()},
+		})
+	}
+	return openAIError(c, status, errType, err.Error())
+}
@@ -0,0 +1,89 @@
+package apiserver
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+
+	"monica-proxy/internal/monica"
+	"monica-proxy/internal/types"
+)
+
+// geminiError 返回 Gemini 风格的错误信封
+func geminiError(c echo.Context, status int, message string) error {
+	errStatus := "INTERNAL"
+	switch status {
+	case http.StatusBadRequest:
+		errStatus = "INVALID_ARGUMENT"
+	case http.StatusForbidden:
+		errStatus = "PERMISSION_DENIED"
+	case http.StatusNotFound:
+		errStatus = "NOT_FOUND"
+	case http.StatusTooManyRequests:
+		errStatus = "RESOURCE_EXHAUSTED"
+	case http.StatusServiceUnavailable:
+		errStatus = "UNAVAILABLE"
+	}
+	return c.JSON(status, types.GeminiErrorResponse{
+		Error: types.GeminiError{Code: status, Message: message, Status: errStatus},
+	})
+}
+
+// handleGemini 处理 /v1beta/models/{model}:generateContent 与 :streamGenerateContent 请求
+func handleGemini(c echo.Context) error {
+	model, action, found := strings.Cut(c.Param("model"), ":")
+	if !found || (action != "generateContent" && action != "streamGenerateContent") {
+		return geminiError(c, http.StatusNotFound, "Unsupported method")
+	}
+
+	var req types.GeminiRequest
+	if err := c.Bind(&req); err != nil {
+		return geminiError(c, http.StatusBadRequest, "Invalid request payload")
+	}
+
+	model, err := resolveModel(c, model)
+	if err != nil {
+		return geminiError(c, http.StatusForbidden, err.Error())
+	}
+	if !types.IsModelSupported(model) {
+		return geminiError(c, http.StatusNotFound, "Model not supported")
+	}
+
+	if len(req.Contents) == 0 {
+		return geminiError(c, http.StatusBadRequest, "No contents found")
+	}
+
+	chatReq, err := types.GeminiToChatGPT(model, req)
+	if err != nil {
+		return geminiError(c, http.StatusBadRequest, err.Error())
+	}
+	chatReq.Stream = action == "streamGenerateContent"
+
+	body, err := openMonicaStream(c.Request().Context(), chatReq)
+	if err != nil {
+		status, _ := upstreamStatus(c, err)
+		return geminiError(c, status, err.Error())
+	}
+	defer body.Close()
+
+	if chatReq.Stream {
+		sse := c.QueryParam("alt") == "sse"
+		if sse {
+			c.Response().Header().Set(echo.HeaderContentType, "text/event-stream")
+			c.Response().Header().Set("Cache-Control", "no-cache")
+		} else {
+			c.Response().Header().Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		}
+		c.Response().Header().Set("Transfer-Encoding", "chunked")
+		c.Response().WriteHeader(http.StatusOK)
+
+		return monica.StreamMonicaSSEToGemini(c.Request().Context(), model, req, chatReq, c.Response().Writer, body, sse)
+	}
+
+	response, err := monica.ProcessMonicaResponseToGemini(c.Request().Context(), model, req, chatReq, body)
+	if err != nil {
+		return geminiError(c, http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,131 @@
+package apiserver
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	lop "github.com/samber/lo/parallel"
+	"github.com/sashabaranov/go-openai"
+
+	"monica-proxy/internal/monica"
+	"monica-proxy/internal/types"
+	"monica-proxy/internal/utils"
+)
+
+// maxImageDownloadSize b64_json 下载生成图片的大小上限
+const maxImageDownloadSize = 20 * 1024 * 1024
+
+// errImageDownload 下载生成的图片失败，属于上游错误
+var errImageDownload = errors.New("download image failed")
+
+// handleImageGenerations 处理 /v1/images/generations 请求，每张图片对应一个独立的绘图会话
+func handleImageGenerations(c echo.Context) error {
+	var req openai.ImageRequest
+	if err := c.Bind(&req); err != nil {
+		return openAIError(c, http.StatusBadRequest, "invalid_request_error", "Invalid request payload")
+	}
+
+	if req.Model == "" {
+		req.Model = types.DefaultImageModel
+	}
+	var err error
+	if req.Model, err = resolveModel(c, req.Model); err != nil {
+		return openAIParamError(c, http.StatusForbidden, "model", modelNotAllowedCode, err.Error())
+	}
+	if model, exists := types.GetModel(req.Model); !exists || !model.Capabilities.ImageGeneration {
+		return openAIError(c, http.StatusBadRequest, "invalid_request_error", "Model does not support image generation")
+	}
+	if req.Prompt == "" {
+		return openAIError(c, http.StatusBadRequest, "invalid_request_error", "No prompt found")
+	}
+	if req.N <= 0 {
+		req.N = 1
+	}
+	if req.N > types.MaxImageN {
+		return openAIError(c, http.StatusBadRequest, "invalid_request_error", fmt.Sprintf("n must be between 1 and %d", types.MaxImageN))
+	}
+	if req.Size != "" && !types.SupportedImageSizes[req.Size] {
+		return openAIError(c, http.StatusBadRequest, "invalid_request_error", fmt.Sprintf("Unsupported size: %s", req.Size))
+	}
+	if req.ResponseFormat == "" {
+		req.ResponseFormat = openai.CreateImageResponseFormatURL
+	}
+	if req.ResponseFormat != openai.CreateImageResponseFormatURL && req.ResponseFormat != openai.CreateImageResponseFormatB64JSON {
+		return openAIError(c, http.StatusBadRequest, "invalid_request_error", fmt.Sprintf("Unsupported response_format: %s", req.ResponseFormat))
+	}
+
+	chatReq := types.ImageToChatGPT(req)
+	chatReqs := make([]openai.ChatCompletionRequest, req.N)
+	for i := range chatReqs {
+		chatReqs[i] = chatReq
+	}
+
+	ctx := c.Request().Context()
+	bodies, err := openMonicaStreams(ctx, chatReqs)
+	if err != nil {
+		return upstreamError(c, err)
+	}
+	defer closeAll(bodies)
+
+	type result struct {
+		data []openai.ImageResponseDataInner
+		err  error
+	}
+	results := lop.Map(bodies, func(body io.ReadCloser, _ int) result {
+		urls, text, err := monica.CollectMonicaImages(ctx, body)
+		if err != nil {
+			return result{err: err}
+		}
+		var data []openai.ImageResponseDataInner
+		for _, url := range urls {
+			item := openai.ImageResponseDataInner{RevisedPrompt: text}
+			if req.ResponseFormat == openai.CreateImageResponseFormatB64JSON {
+				if item.B64JSON, err = downloadImageBase64(ctx, url); err != nil {
+					return result{err: err}
+				}
+			} else {
+				item.URL = url
+			}
+			data = append(data, item)
+		}
+		return result{data: data}
+	})
+
+	response := openai.ImageResponse{Created: time.Now().Unix()}
+	for _, res := range results {
+		if res.err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(res.err, errImageDownload) {
+				status = http.StatusBadGateway
+			}
+			return openAIError(c, status, "server_error", res.err.Error())
+		}
+		response.Data = append(response.Data, res.data...)
+	}
+	if len(response.Data) == 0 {
+		return openAIError(c, http.StatusBadGateway, "server_error", "No image generated")
+	}
+	return c.JSON(http.StatusOK, response)
+}
+
+// downloadImageBase64 下载图片并编码为 base64，用于 response_format=b64_json。
+// 非 2xx 响应（如 CDN 返回的错误页）与超过大小上限的响应都视为下载失败
+func downloadImageBase64(ctx context.Context, url string) (string, error) {
+	resp, err := utils.DefaultClient("").R().
+		SetContext(ctx).
+		SetResponseBodyLimit(maxImageDownloadSize).
+		Get(url)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", errImageDownload, err)
+	}
+	if !resp.IsSuccess() {
+		return "", fmt.Errorf("%w: status %d", errImageDownload, resp.StatusCode())
+	}
+	return base64.StdEncoding.EncodeToString(resp.Body()), nil
+}
@@ -0,0 +1,35 @@
+package apiserver
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDownloadImageBase64(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ok.png":
+			w.Write([]byte("png"))
+		case "/large.png":
+			w.Write([]byte(strings.Repeat("x", maxImageDownloadSize+1)))
+		default:
+			http.Error(w, "<html>not found</html>", http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	ctx := context.Background()
+
+	got, err := downloadImageBase64(ctx, srv.URL+"/ok.png")
+	if err != nil || got != "cG5n" {
+		t.Fatalf("downloadImageBase64(ok) = %q, %v", got, err)
+	}
+	for _, path := range []string{"/missing.png", "/large.png"} {
+		if _, err := downloadImageBase64(ctx, srv.URL+path); !errors.Is(err, errImageDownload) {
+			t.Errorf("downloadImageBase64(%s) err = %v, want errImageDownload", path, err)
+		}
+	}
+}
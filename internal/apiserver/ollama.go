@@ -0,0 +1,142 @@
+package apiserver
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sashabaranov/go-openai"
+
+	"monica-proxy/internal/monica"
+	"monica-proxy/internal/types"
+)
+
+// ollamaVersion /api/version 返回的版本号，部分客户端据此判断接口能力
+const ollamaVersion = "0.9.0"
+
+// handleOllamaVersion 返回兼容的 Ollama 版本
+func handleOllamaVersion(c echo.Context) error {
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"version": ollamaVersion,
+	})
+}
+
+// handleOllamaTags 以 Ollama /api/tags 格式返回支持的模型列表
+func handleOllamaTags(c echo.Context) error {
+	return c.JSON(http.StatusOK, types.OllamaModels(visibleModels(c)))
+}
+
+// handleOllamaShow 返回模型元数据
+func handleOllamaShow(c echo.Context) error {
+	var req types.OllamaShowRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error": "Invalid request payload",
+		})
+	}
+	if req.Model == "" {
+		req.Model = req.Name
+	}
+
+	model := types.OllamaModelName(req.Model)
+	if !types.IsModelSupported(model) || !modelVisible(c, model) {
+		return c.JSON(http.StatusNotFound, map[string]interface{}{
+			"error": "Model not supported",
+		})
+	}
+
+	return c.JSON(http.StatusOK, types.OllamaModelShow(model))
+}
+
+// handleOllamaChat 处理 Ollama /api/chat 请求
+func handleOllamaChat(c echo.Context) error {
+	var req types.OllamaChatRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error": "Invalid request payload",
+		})
+	}
+	if len(req.Messages) == 0 {
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error": "No messages found",
+		})
+	}
+
+	chatReq, err := types.OllamaChatToChatGPT(req)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+	return serveOllama(c, req.Model, true, req.Stream, req.Think, chatReq)
+}
+
+// handleOllamaGenerate 处理 Ollama /api/generate 请求
+func handleOllamaGenerate(c echo.Context) error {
+	var req types.OllamaGenerateRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error": "Invalid request payload",
+		})
+	}
+	if req.Prompt == "" && len(req.Images) == 0 {
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error": "No prompt found",
+		})
+	}
+
+	chatReq, err := types.OllamaGenerateToChatGPT(req)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+	return serveOllama(c, req.Model, false, req.Stream, req.Think, chatReq)
+}
+
+// serveOllama 请求 Monica 并按 Ollama 格式返回，stream 未指定时默认流式（NDJSON）
+func serveOllama(c echo.Context, model string, chat bool, stream, think *bool, chatReq openai.ChatCompletionRequest) error {
+	resolved, err := resolveModel(c, chatReq.Model)
+	if err != nil {
+		return c.JSON(http.StatusForbidden, map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+	if resolved != chatReq.Model {
+		chatReq.Model = resolved
+		model = resolved
+	}
+	if !types.IsModelSupported(chatReq.Model) {
+		return c.JSON(http.StatusNotFound, map[string]interface{}{
+			"error": "Model not supported",
+		})
+	}
+	chatReq.Stream = stream == nil || *stream
+	// think 未指定时保留思考内容，显式关闭时丢弃
+	withThinking := think == nil || *think
+
+	body, err := openMonicaStream(c.Request().Context(), chatReq)
+	if err != nil {
+		status, _ := upstreamStatus(c, err)
+		return c.JSON(status, map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+	defer body.Close()
+
+	if chatReq.Stream {
+		c.Response().Header().Set(echo.HeaderContentType, "application/x-ndjson")
+		c.Response().Header().Set("Cache-Control", "no-cache")
+		c.Response().Header().Set("Transfer-Encoding", "chunked")
+		c.Response().WriteHeader(http.StatusOK)
+
+		return monica.StreamMonicaSSEToOllama(c.Request().Context(), model, chat, withThinking, chatReq, c.Response().Writer, body)
+	}
+
+	response, err := monica.ProcessMonicaResponseToOllama(c.Request().Context(), model, chat, withThinking, chatReq, body)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+	return c.JSON(http.StatusOK, response)
+}
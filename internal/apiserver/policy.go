@@ -0,0 +1,50 @@
+package apiserver
+
+import (
+	"github.com/labstack/echo/v4"
+
+	"monica-proxy/internal/middleware"
+	"monica-proxy/internal/types"
+	"monica-proxy/internal/usage"
+)
+
+// modelNotAllowedCode 模型被密钥策略禁止时的错误码
+const modelNotAllowedCode = "model_not_allowed"
+
+// resolveModel 按密钥的模型策略检查请求的模型：允许时原样返回，被禁止时替换为策略的默认模型，
+// 没有默认模型时返回 apikey.ErrModelNotAllowed。实际使用的模型同时记入本次请求的用量
+func resolveModel(c echo.Context, model string) (string, error) {
+	entry := usage.FromContext(c.Request().Context())
+	entry.SetModel(model)
+	key := middleware.CurrentKey(c)
+	if key == nil {
+		return model, nil
+	}
+	resolved, err := key.ResolveModel(model)
+	if err == nil {
+		entry.SetModel(resolved)
+	}
+	return resolved, err
+}
+
+// modelVisible 返回模型是否出现在调用方的模型列表中
+func modelVisible(c echo.Context, model string) bool {
+	key := middleware.CurrentKey(c)
+	return key == nil || key.AllowsModel(model)
+}
+
+// visibleModels 返回调用方可以使用的模型列表
+func visibleModels(c echo.Context) types.OpenAIModelList {
+	models := types.GetSupportedModels()
+	key := middleware.CurrentKey(c)
+	if key == nil || !key.Restricted() {
+		return models
+	}
+	filtered := types.OpenAIModelList{Object: models.Object, Data: make([]types.OpenAIModel, 0, len(models.Data))}
+	for _, m := range models.Data {
+		if key.AllowsModel(m.ID) {
+			filtered.Data = append(filtered.Data, m)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,123 @@
+package apiserver
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	lop "github.com/samber/lo/parallel"
+	"github.com/sashabaranov/go-openai"
+
+	"monica-proxy/internal/config"
+	"monica-proxy/internal/monica"
+	"monica-proxy/internal/types"
+	"monica-proxy/internal/utils"
+)
+
+const maxFormatRepairs = 2 // 输出不符合 response_format 时最多修正的次数
+
+// maxStructuredChoices 带 response_format 时 n 的上限。每次修正都是一次独立的上游请求，
+// 与普通请求一样计入配额、速率限制并占用账号，因此按最坏情况 n*(maxFormatRepairs+1) 次请求
+// 不超过 MAX_CHOICES 收紧上限，至少为 1
+func maxStructuredChoices() int {
+	return max(config.MonicaConfig.MaxChoices/(maxFormatRepairs+1), 1)
+}
+
+// structuredOutput 一次结构化输出的结果
+type structuredOutput struct {
+	reasoning string
+	content   string // 校验通过时为规范化后的 JSON，否则为模型原始输出
+	err       error  // 最后一次校验失败的原因
+}
+
+// collectStructuredOutput 获取符合 response_format 的输出：校验失败时把错误原因交给模型修正，
+// 最多重试 maxFormatRepairs 次，每次修正单独计费。启用工具调用模拟且模型调用了工具时不做校验
+func collectStructuredOutput(ctx context.Context, req openai.ChatCompletionRequest, format *types.JSONFormat, tools *types.ToolEmulation, onIdle func() error) (structuredOutput, error) {
+	attempt := req
+	var out structuredOutput
+	for i := 0; i <= maxFormatRepairs; i++ {
+		body, err := openMonicaStream(ctx, attempt)
+		if err != nil {
+			return out, err
+		}
+		reasoning, content, err := monica.CollectMonicaResponseWithIdle(ctx, body, onIdle)
+		body.Close()
+		if err != nil {
+			return out, err
+		}
+
+		out = structuredOutput{reasoning: reasoning, content: content}
+		if tools != nil {
+			if _, calls := tools.ParseToolCalls(content); len(calls) > 0 {
+				return out, nil
+			}
+		}
+		if out.content, out.err = format.Validate(content); out.err == nil {
+			return out, nil
+		}
+		out.content = content
+		attempt.Messages = format.RepairMessages(attempt.Messages, content, out.err)
+	}
+	return out, nil
+}
+
+// serveStructuredOutput 处理带 response_format 的对话请求，n 个 choice 并发生成。输出需要完整校验，
+// 流式请求也会先缓冲，缓冲期间发送心跳，全部校验通过后一次性下发
+func serveStructuredOutput(c echo.Context, req openai.ChatCompletionRequest, format *types.JSONFormat, tools *types.ToolEmulation, n int) error {
+	ctx := c.Request().Context()
+	fingerprint := utils.RandStringUsingMathRand(10)
+
+	var onIdle func() error
+	if req.Stream {
+		c.Response().Header().Set(echo.HeaderContentType, "text/event-stream")
+		c.Response().Header().Set("Cache-Control", "no-cache")
+		c.Response().Header().Set("Transfer-Encoding", "chunked")
+		c.Response().WriteHeader(http.StatusOK)
+		onIdle = monica.KeepAlive(c.Response().Writer)
+	}
+
+	type result struct {
+		out structuredOutput
+		err error
+	}
+	results := lop.Times(n, func(_ int) result {
+		out, err := collectStructuredOutput(ctx, req, format, tools, onIdle)
+		return result{out: out, err: err}
+	})
+
+	responses := make([]openai.ChatCompletionResponse, 0, n)
+	for _, res := range results {
+		var apiErr *openai.APIError
+		status := http.StatusInternalServerError
+		switch {
+		case res.err != nil:
+			var errType string
+			status, errType = upstreamStatus(c, res.err)
+			apiErr = &openai.APIError{Type: errType, Message: res.err.Error()}
+			var capErr *types.CapabilityError
+			if errors.As(res.err, &capErr) {
+				apiErr.Code, apiErr.Param = capErr.Code, &capErr.Param
+			}
+		case res.out.err != nil:
+			status = http.StatusBadGateway
+			apiErr = &openai.APIError{Type: "server_error", Code: "response_format_validation_failed", Message: res.out.err.Error()}
+		}
+		if apiErr != nil {
+			if req.Stream {
+				return monica.SendStreamError(c.Response().Writer, apiErr)
+			}
+			return c.JSON(status, openai.ErrorResponse{Error: apiErr})
+		}
+		responses = append(responses, monica.NewChatCompletion(req, res.out.reasoning, res.out.content, fingerprint))
+	}
+
+	response := monica.MergeChatCompletions(responses)
+	if tools != nil {
+		monica.ApplyToolCalls(&response, tools)
+	}
+	if req.Stream {
+		return monica.StreamChatCompletion(c.Response().Writer, response)
+	}
+	return c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,67 @@
+package apiserver
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"monica-proxy/internal/middleware"
+	"monica-proxy/internal/monica"
+	"monica-proxy/internal/types"
+)
+
+// handleResponses 处理 OpenAI Responses API 格式的请求
+func handleResponses(c echo.Context) error {
+	var req types.ResponsesRequest
+	if err := c.Bind(&req); err != nil {
+		return openAIError(c, http.StatusBadRequest, "invalid_request_error", "Invalid request payload")
+	}
+
+	var err error
+	if req.Model, err = resolveModel(c, req.Model); err != nil {
+		return openAIParamError(c, http.StatusForbidden, "model", modelNotAllowedCode, err.Error())
+	}
+	if !types.IsModelSupported(req.Model) {
+		return openAIError(c, http.StatusBadRequest, "invalid_request_error", "Model not supported")
+	}
+
+	if len(req.Input) == 0 {
+		return openAIError(c, http.StatusBadRequest, "invalid_request_error", "No input found")
+	}
+
+	// 历史对话只对保存它的密钥可见
+	owner := middleware.APIKeyFromContext(c.Request().Context())
+	chatReq, history, err := types.ResponsesToChatGPT(owner, req)
+	if err != nil {
+		return openAIError(c, http.StatusBadRequest, "invalid_request_error", err.Error())
+	}
+
+	body, err := openMonicaStream(c.Request().Context(), chatReq)
+	if err != nil {
+		return upstreamError(c, err)
+	}
+	defer body.Close()
+
+	store := req.Store == nil || *req.Store
+	if req.Stream {
+		c.Response().Header().Set(echo.HeaderContentType, "text/event-stream")
+		c.Response().Header().Set("Cache-Control", "no-cache")
+		c.Response().Header().Set("Transfer-Encoding", "chunked")
+		c.Response().WriteHeader(http.StatusOK)
+
+		response, output, err := monica.StreamMonicaSSEToResponses(c.Request().Context(), req, chatReq, c.Response().Writer, body)
+		if err == nil && store {
+			types.SaveResponseHistory(owner, response.ID, history, output)
+		}
+		return err
+	}
+
+	response, output, err := monica.ProcessMonicaResponseToResponses(c.Request().Context(), req, chatReq, body)
+	if err != nil {
+		return openAIError(c, http.StatusInternalServerError, "server_error", err.Error())
+	}
+	if store {
+		types.SaveResponseHistory(owner, response.ID, history, output)
+	}
+	return c.JSON(http.StatusOK, response)
+}
@@ -1,6 +1,10 @@
 package apiserver
 
 import (
+	"fmt"
+	"io"
+	"monica-proxy/internal/apikey"
+	"monica-proxy/internal/config"
 	"monica-proxy/internal/middleware"
 	"monica-proxy/internal/monica"
 	"monica-proxy/internal/types"
@@ -13,57 +17,108 @@ import (
 
 // RegisterRoutes 注册 Echo 路由
 func RegisterRoutes(e *echo.Echo) {
-	// 添加Bearer Token认证中间件
+	// API 密钥认证，各接口再按权限范围校验
 	e.Use(middleware.BearerAuth())
+	// 按 API 密钥限制每分钟请求数与 token 数
+	e.Use(middleware.RateLimit())
+	// 会话亲和：读取客户端指定的会话标识
+	e.Use(withConversation)
+	// 调用模型的接口按权限范围校验并记录用量
+	chat := []echo.MiddlewareFunc{middleware.RequireScope(apikey.ScopeChat), recordUsage}
+	images := []echo.MiddlewareFunc{middleware.RequireScope(apikey.ScopeImages), recordUsage}
 
 	// ChatGPT 风格的请求转发到 /v1/chat/completions
-	e.POST("/v1/chat/completions", handleChatCompletion)
+	e.POST("/v1/chat/completions", handleChatCompletion, chat...)
+	// Anthropic 风格的请求转发到 /v1/messages
+	e.POST("/v1/messages", handleClaudeMessages, chat...)
+	// OpenAI Responses API
+	e.POST("/v1/responses", handleResponses, chat...)
+	// 传统文本补全
+	e.POST("/v1/completions", handleCompletions, chat...)
+	// 图片生成
+	e.POST("/v1/images/generations", handleImageGenerations, images...)
+	// Gemini 风格的 generateContent / streamGenerateContent
+	e.POST("/v1beta/models/:model", handleGemini, chat...)
 	// 获取支持的模型列表
 	e.GET("/v1/models", handleListModels)
+	// 获取单个模型的信息
+	e.GET("/v1/models/:id", handleGetModel)
+	// 用量报表，admin 密钥查看全部密钥，其他密钥只能查看自己
+	e.GET("/v1/usage", handleUsage)
+
+	// Ollama 风格的接口
+	e.GET("/api/version", handleOllamaVersion)
+	e.GET("/api/tags", handleOllamaTags)
+	e.POST("/api/show", handleOllamaShow)
+	e.POST("/api/chat", handleOllamaChat, chat...)
+	e.POST("/api/generate", handleOllamaGenerate, chat...)
+
+	// 账号管理接口，需要 admin 权限
+	registerAdminRoutes(e.Group("/admin", middleware.RequireScope(apikey.ScopeAdmin)))
 }
 
 func handleChatCompletion(c echo.Context) error {
-	var req openai.ChatCompletionRequest
+	var chatReq types.ChatCompletionRequest
+
+	err := c.Bind(&chatReq)
+	if err != nil {
+		return openAIError(c, http.StatusBadRequest, "invalid_request_error", "Invalid request payload")
+	}
 
-	if err := c.Bind(&req); err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]interface{}{
-			"error": "Invalid request payload",
-		})
+	if len(chatReq.Messages) == 0 {
+		return openAIParamError(c, http.StatusBadRequest, "messages", "", "No messages found")
 	}
 
-	if !types.IsModelSupported(req.Model) {
-		return c.JSON(http.StatusBadRequest, map[string]interface{}{
-			"error": "Model not supported",
-		})
+	// 按密钥的模型策略检查模型，被禁止时替换为默认模型
+	if chatReq.Model, err = resolveModel(c, chatReq.Model); err != nil {
+		return openAIParamError(c, http.StatusForbidden, "model", modelNotAllowedCode, err.Error())
 	}
 
-	if len(req.Messages) == 0 {
-		return c.JSON(http.StatusBadRequest, map[string]interface{}{
-			"error": "No messages found",
-		})
+	// 结构化输出：将 response_format 转换为提示词，输出在返回前校验
+	format, err := types.ResponseFormatToChatGPT(&chatReq)
+	if err != nil {
+		return openAIParamError(c, http.StatusBadRequest, "response_format", "", err.Error())
 	}
+	req := chatReq.ChatCompletionRequest
 
-	monicaReq, err := types.ChatGPTToMonica(req)
-	// 将monicaReq转换为JSON格式并打印
-	//jsonBytes, err := json.MarshalIndent(monicaReq, "", "    ")
-	//if err != nil {
-	//	log.Printf("JSON marshal error: %v", err)
-	//} else {
-	//	log.Printf("monicaReq: \n%s", string(jsonBytes))
-	//}
+	// 工具调用模拟：将工具定义与调用历史改写进提示词
+	tools, err := types.ToolsToChatGPT(&req)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]interface{}{
-			"error": err.Error(),
-		})
+		return openAIParamError(c, http.StatusBadRequest, "tool_choice", "", err.Error())
+	}
+
+	// n > 1 时每个 choice 使用独立的 Monica 会话
+	n := req.N
+	if n <= 0 {
+		n = 1
+	}
+	if n > config.MonicaConfig.MaxChoices {
+		return openAIParamError(c, http.StatusBadRequest, "n", "",
+			fmt.Sprintf("n must be between 1 and %d", config.MonicaConfig.MaxChoices))
+	}
+
+	if format != nil {
+		if limit := maxStructuredChoices(); n > limit {
+			return openAIParamError(c, http.StatusBadRequest, "n", "",
+				fmt.Sprintf("n must be between 1 and %d when response_format is set", limit))
+		}
+		return serveStructuredOutput(c, req, format, tools, n)
 	}
 
-	stream, err := monica.SendMonicaRequest(c.Request().Context(), monicaReq)
+	chatReqs := make([]openai.ChatCompletionRequest, n)
+	for i := range chatReqs {
+		chatReqs[i] = req
+	}
+	bodies, err := openMonicaStreams(c.Request().Context(), chatReqs)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]interface{}{
-			"error": err.Error(),
-		})
+		return upstreamError(c, err)
+	}
+	defer closeAll(bodies)
+
+	readers := make([]io.Reader, len(bodies))
+	for i, body := range bodies {
+		readers[i] = body
 	}
-	defer stream.RawBody().Close()
 
 	// 根据请求的 stream 参数决定使用哪种处理方式
 	fingerprint := utils.RandStringUsingMathRand(10)
@@ -74,21 +129,34 @@ func handleChatCompletion(c echo.Context) error {
 		c.Response().Header().Set("Transfer-Encoding", "chunked")
 		c.Response().WriteHeader(http.StatusOK)
 
-		return monica.StreamMonicaSSEToClient(c.Request().Context(), req, c.Response().Writer, stream.RawBody(), fingerprint)
+		if tools != nil || n > 1 {
+			return monica.StreamMonicaSSEToChoices(c.Request().Context(), req, tools, c.Response().Writer, readers, fingerprint)
+		}
+		return monica.StreamMonicaSSEToClient(c.Request().Context(), req, c.Response().Writer, readers[0], fingerprint)
 	} else {
 		// 非流式处理
-		response, err := monica.ProcessMonicaResponse(c.Request().Context(), req, stream.RawBody(), fingerprint)
+		response, err := monica.ProcessMonicaResponses(c.Request().Context(), req, readers, fingerprint)
 		if err != nil {
-			return c.JSON(http.StatusInternalServerError, map[string]interface{}{
-				"error": err.Error(),
-			})
+			return openAIError(c, http.StatusInternalServerError, "server_error", err.Error())
+		}
+		if tools != nil {
+			monica.ApplyToolCalls(&response, tools)
 		}
 		return c.JSON(http.StatusOK, response)
 	}
 }
 
-// handleListModels 返回支持的模型列表
+// handleListModels 返回调用方的密钥可以使用的模型列表
 func handleListModels(c echo.Context) error {
-	models := types.GetSupportedModels()
-	return c.JSON(http.StatusOK, models)
+	return c.JSON(http.StatusOK, visibleModels(c))
+}
+
+// handleGetModel 返回单个模型的信息，包含能力扩展字段
+func handleGetModel(c echo.Context) error {
+	model, exists := types.GetModel(c.Param("id"))
+	if !exists || !modelVisible(c, model.ID) {
+		return openAIParamError(c, http.StatusNotFound, "model", "model_not_found",
+			fmt.Sprintf("The model `%s` does not exist", c.Param("id")))
+	}
+	return c.JSON(http.StatusOK, model)
 }
@@ -0,0 +1,193 @@
+package apiserver
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"sync"
+
+	"github.com/labstack/echo/v4"
+	lop "github.com/samber/lo/parallel"
+	"github.com/sashabaranov/go-openai"
+
+	"monica-proxy/internal/account"
+	"monica-proxy/internal/apikey"
+	"monica-proxy/internal/config"
+	"monica-proxy/internal/middleware"
+	"monica-proxy/internal/monica"
+	"monica-proxy/internal/ratelimit"
+	"monica-proxy/internal/types"
+	"monica-proxy/internal/usage"
+	"monica-proxy/internal/utils"
+)
+
+// openMonicaStream 从账号池选择账号，将 OpenAI 格式的请求转换为 Monica 请求并建立上游 SSE 连接，
+// 各协议的 handler 统一经由这里访问 Monica，调用方负责关闭返回的 body，关闭时释放账号。
+// 连接建立前（尚未向客户端写出任何内容）遇到账号相关的失败时，换一个账号重新转换请求并重试，
+// 图片等文件需要在新账号下重新上传，因为 file_uid 只在上传的账号下有效
+func openMonicaStream(ctx context.Context, req openai.ChatCompletionRequest) (io.ReadCloser, error) {
+	// 按模型能力校验并调整请求，各协议转换后的请求都经过这里
+	if err := types.AdaptChatRequest(&req); err != nil {
+		return nil, err
+	}
+
+	// 同一会话优先使用同一账号，客户端通过 X-Conversation-Id 指定的会话标识优先
+	key := account.ConversationFromContext(ctx)
+	if key == "" {
+		key = types.ConversationKey(req)
+	}
+
+	// 检查并预留 token 预算，再按提示词 token 准入速率限制，故障转移不重复计算
+	promptTokens := utils.CalculatePromptTokens(req)
+	if k := apikey.FromContext(ctx); k != nil {
+		if err := usage.DefaultLedger.Check(usage.FromContext(ctx), k.ID, req.Model, k.Quotas, promptTokens); err != nil {
+			return nil, err
+		}
+	}
+	meter := ratelimit.FromContext(ctx)
+	if err := meter.Charge(promptTokens); err != nil {
+		return nil, err
+	}
+	body, err := openWithFailover(ctx, key, req)
+	if err != nil {
+		// 没有建立上游连接，退还准入时扣除的 token 额度
+		meter.Refund(promptTokens)
+		return nil, err
+	}
+	return body, nil
+}
+
+// openWithFailover 占用账号并建立上游连接，账号相关的失败换一个账号重试
+func openWithFailover(ctx context.Context, key string, req openai.ChatCompletionRequest) (io.ReadCloser, error) {
+	var tried []*account.Account
+	var lastErr error
+	for attempt := 0; attempt < config.MonicaConfig.FailoverAttempts; attempt++ {
+		acc, err := account.DefaultPool.Acquire(ctx, middleware.APIKeyFromContext(ctx), key, tried...)
+		if err != nil {
+			if lastErr != nil {
+				return nil, lastErr
+			}
+			return nil, err
+		}
+		tried = append(tried, acc)
+
+		body, err := openMonicaStreamWith(ctx, acc, req)
+		if err == nil {
+			return body, nil
+		}
+		lastErr = err
+
+		var upErr *account.UpstreamError
+		if !errors.As(err, &upErr) || !upErr.Retryable() || ctx.Err() != nil {
+			return nil, err
+		}
+		log.Printf("Monica request failed on account %s (%s), failing over to another account", acc.ID, upErr.Outcome)
+	}
+	return nil, lastErr
+}
+
+// openMonicaStreamWith 使用已占用的账号建立上游 SSE 连接，失败时释放账号
+func openMonicaStreamWith(ctx context.Context, acc *account.Account, req openai.ChatCompletionRequest) (io.ReadCloser, error) {
+	ctx = account.WithAccount(ctx, acc)
+
+	monicaReq, err := types.ChatGPTToMonica(ctx, req)
+	if err != nil {
+		account.DefaultPool.Release(acc, err)
+		return nil, err
+	}
+
+	stream, err := monica.SendMonicaRequest(ctx, monicaReq)
+	if err != nil {
+		account.DefaultPool.Release(acc, err)
+		return nil, err
+	}
+	return &accountBody{
+		ReadCloser: stream.RawBody(),
+		account:    acc,
+		req:        req,
+		meter:      ratelimit.FromContext(ctx),
+		entry:      usage.FromContext(ctx),
+		completion: &monica.CompletionMeter{},
+	}, nil
+}
+
+// conversationHeader 客户端指定会话标识的 header
+const conversationHeader = "X-Conversation-Id"
+
+// withConversation 将 X-Conversation-Id 放入请求的 context，供选择账号时使用
+func withConversation(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if key := c.Request().Header.Get(conversationHeader); key != "" {
+			ctx := account.WithConversation(c.Request().Context(), "header:"+key)
+			c.SetRequest(c.Request().WithContext(ctx))
+		}
+		return next(c)
+	}
+}
+
+// accountBody 上游响应 body，关闭时释放占用的账号，按实际输出的 token 结算速率限制并记录用量
+type accountBody struct {
+	io.ReadCloser
+	account    *account.Account
+	req        openai.ChatCompletionRequest
+	meter      *ratelimit.Meter
+	entry      *usage.Entry
+	completion *monica.CompletionMeter
+	once       sync.Once
+}
+
+func (b *accountBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		b.completion.Write(p[:n])
+	}
+	return n, err
+}
+
+func (b *accountBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() {
+		account.DefaultPool.Release(b.account, nil)
+		used := utils.CalculateUsage(b.req, b.completion.Text())
+		b.meter.Settle(used.CompletionTokens)
+		b.entry.AddUpstream(b.account.ID, used.PromptTokens, used.CompletionTokens)
+	})
+	return err
+}
+
+// openMonicaStreams 并发建立多条独立的上游连接（多 prompt、n > 1 等场景），任一失败时关闭其余连接
+func openMonicaStreams(ctx context.Context, reqs []openai.ChatCompletionRequest) ([]io.ReadCloser, error) {
+	type result struct {
+		body io.ReadCloser
+		err  error
+	}
+	results := lop.Map(reqs, func(req openai.ChatCompletionRequest, _ int) result {
+		body, err := openMonicaStream(ctx, req)
+		return result{body: body, err: err}
+	})
+
+	bodies := make([]io.ReadCloser, 0, len(results))
+	var firstErr error
+	for _, res := range results {
+		if res.err != nil {
+			if firstErr == nil {
+				firstErr = res.err
+			}
+			continue
+		}
+		bodies = append(bodies, res.body)
+	}
+	if firstErr != nil {
+		closeAll(bodies)
+		return nil, firstErr
+	}
+	return bodies, nil
+}
+
+// closeAll 关闭全部上游连接
+func closeAll(bodies []io.ReadCloser) {
+	for _, body := range bodies {
+		body.Close()
+	}
+}
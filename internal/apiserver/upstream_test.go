@@ -0,0 +1,37 @@
+package apiserver
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sashabaranov/go-openai"
+
+	"monica-proxy/internal/types"
+)
+
+func TestOpenMonicaStreamChecksCapabilities(t *testing.T) {
+	req := openai.ChatCompletionRequest{
+		Model: "openai-o-3-mini",
+		Messages: []openai.ChatCompletionMessage{{
+			Role: openai.ChatMessageRoleUser,
+			MultiContent: []openai.ChatMessagePart{
+				{Type: openai.ChatMessagePartTypeText, Text: "what is this?"},
+				{Type: openai.ChatMessagePartTypeImageURL, ImageURL: &openai.ChatMessageImageURL{URL: "https://example.com/a.png"}},
+			},
+		}},
+	}
+	_, err := openMonicaStream(context.Background(), req)
+	var capErr *types.CapabilityError
+	if !errors.As(err, &capErr) || capErr.Code != "image_input_not_supported" {
+		t.Fatalf("err = %v, want image_input_not_supported", err)
+	}
+
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodPost, "/", nil), httptest.NewRecorder())
+	if status, errType := upstreamStatus(c, err); status != http.StatusBadRequest || errType != "invalid_request_error" {
+		t.Fatalf("upstreamStatus = %d, %s, want 400 invalid_request_error", status, errType)
+	}
+}
@@ -0,0 +1,141 @@
+package apiserver
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"monica-proxy/internal/apikey"
+	"monica-proxy/internal/middleware"
+	"monica-proxy/internal/usage"
+)
+
+// defaultUsageDays 用量报表未指定 start 时统计的天数，包含今天
+const defaultUsageDays = 7
+
+// recordUsage 记录调用模型的接口的用量：请求结束时把密钥、模型、token 数、耗时与状态码写入用量账本，
+// 并释放配额检查时预留的 token
+func recordUsage(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		key := middleware.CurrentKey(c)
+		if key == nil {
+			return next(c)
+		}
+		entry := usage.NewEntry(key.ID, c.Path())
+		c.SetRequest(c.Request().WithContext(usage.WithEntry(c.Request().Context(), entry)))
+		defer usage.DefaultLedger.Release(entry)
+
+		err := next(c)
+		status := c.Response().Status
+		if err != nil {
+			status = http.StatusInternalServerError
+			var httpErr *echo.HTTPError
+			if errors.As(err, &httpErr) {
+				status = httpErr.Code
+			}
+		}
+		usage.DefaultLedger.Append(entry.Finish(status))
+		return err
+	}
+}
+
+// usageReport /v1/usage 的 JSON 响应
+type usageReport struct {
+	Object  string      `json:"object"`
+	Start   time.Time   `json:"start"`
+	End     time.Time   `json:"end"`
+	KeyID   string      `json:"key_id,omitempty"`
+	GroupBy []string    `json:"group_by"`
+	Bucket  string      `json:"bucket,omitempty"`
+	Data    []usage.Row `json:"data"`
+}
+
+// handleUsage 返回用量报表。admin 密钥可以查看全部密钥并用 key_id 过滤，其他密钥只能查看自己的用量
+//
+// 查询参数：start、end 为日期（2006-01-02，end 包含当天）或 RFC3339 时间，默认最近 7 天；
+// group_by 为 key、model、account 的逗号分隔组合；bucket 为 hour 或 day；format 为 json 或 csv
+func handleUsage(c echo.Context) error {
+	q := usage.Query{KeyID: c.QueryParam("key_id")}
+	if key := middleware.CurrentKey(c); key != nil && !key.HasScope(apikey.ScopeAdmin) {
+		if q.KeyID != "" && q.KeyID != key.ID {
+			return openAIParamError(c, http.StatusForbidden, "key_id", "",
+				"Only admin keys can view the usage of other keys")
+		}
+		q.KeyID = key.ID
+	}
+
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	q.Start = today.AddDate(0, 0, 1-defaultUsageDays)
+	q.End = now
+	var err error
+	if s := c.QueryParam("start"); s != "" {
+		if q.Start, err = parseUsageTime(s, false); err != nil {
+			return openAIParamError(c, http.StatusBadRequest, "start", "", err.Error())
+		}
+	}
+	if s := c.QueryParam("end"); s != "" {
+		if q.End, err = parseUsageTime(s, true); err != nil {
+			return openAIParamError(c, http.StatusBadRequest, "end", "", err.Error())
+		}
+	}
+	if !q.Start.Before(q.End) {
+		return openAIParamError(c, http.StatusBadRequest, "end", "", "end must be after start")
+	}
+
+	if q.GroupBy, err = usage.ParseGroupBy(c.QueryParam("group_by")); err != nil {
+		return openAIParamError(c, http.StatusBadRequest, "group_by", "", err.Error())
+	}
+	switch q.Bucket = strings.ToLower(c.QueryParam("bucket")); q.Bucket {
+	case "", "hour", "day":
+	default:
+		return openAIParamError(c, http.StatusBadRequest, "bucket", "", "bucket must be hour or day")
+	}
+	format := strings.ToLower(c.QueryParam("format"))
+	if format != "" && format != "json" && format != "csv" {
+		return openAIParamError(c, http.StatusBadRequest, "format", "", "format must be json or csv")
+	}
+
+	rows, err := usage.DefaultLedger.Report(q)
+	if err != nil {
+		return openAIError(c, http.StatusInternalServerError, "server_error", err.Error())
+	}
+
+	if format == "csv" {
+		c.Response().Header().Set(echo.HeaderContentType, "text/csv; charset=utf-8")
+		c.Response().Header().Set(echo.HeaderContentDisposition, `attachment; filename="usage.csv"`)
+		c.Response().WriteHeader(http.StatusOK)
+		return usage.WriteCSV(c.Response(), rows)
+	}
+	if q.GroupBy == nil {
+		q.GroupBy = []string{}
+	}
+	return c.JSON(http.StatusOK, usageReport{
+		Object:  "usage.report",
+		Start:   q.Start,
+		End:     q.End,
+		KeyID:   q.KeyID,
+		GroupBy: q.GroupBy,
+		Bucket:  q.Bucket,
+		Data:    rows,
+	})
+}
+
+// parseUsageTime 解析报表的起止时间，日期按服务器时区解析，作为结束时间时包含当天
+func parseUsageTime(s string, end bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", s, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q, expected 2006-01-02 or RFC3339", s)
+	}
+	if end {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
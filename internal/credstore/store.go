@@ -0,0 +1,289 @@
+package credstore
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"monica-proxy/internal/account"
+	"monica-proxy/internal/apikey"
+	"monica-proxy/internal/config"
+	"monica-proxy/internal/utils"
+)
+
+const (
+	// KeySize 主密钥长度，AES-256
+	KeySize = 32
+	version = 1
+)
+
+// additionalData 绑定到密文的附加数据，防止其他用途的 AES-GCM 密文被当作凭据库读取
+var additionalData = []byte("monica-proxy credstore v1")
+
+// ErrNoKey 未配置主密钥
+var ErrNoKey = errors.New("credential store master key is not configured, set CREDSTORE_KEY or CREDSTORE_KEY_FILE")
+
+// Data 凭据库的明文内容
+type Data struct {
+	Accounts []account.Record `json:"accounts"`
+	APIKeys  []apikey.Key     `json:"api_keys"` // 只保存加盐哈希
+}
+
+// envelope 凭据库文件格式，nonce 与密文均为 base64
+type envelope struct {
+	Version    int    `json:"version"`
+	Nonce      string `json:"nonce"`
+	Ciphertext string `json:"ciphertext"`
+}
+
+// Store 使用 AES-GCM 加密的凭据库文件，保存 Monica cookie 与代理 API 密钥
+type Store struct {
+	path string
+	key  []byte
+	mu   sync.Mutex
+}
+
+// New 创建凭据库，key 为 32 字节主密钥
+func New(path string, key []byte) (*Store, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("credential store master key must be %d bytes, got %d", KeySize, len(key))
+	}
+	return &Store{path: path, key: key}, nil
+}
+
+// Open 按配置中的凭据库路径与主密钥打开凭据库
+func Open(cfg *config.Config) (*Store, error) {
+	key, err := LoadKey(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return New(cfg.CredStoreFile, key)
+}
+
+// GenerateKey 生成随机主密钥
+func GenerateKey() ([]byte, error) {
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// EncodeKey 将主密钥编码为 base64，用于 CREDSTORE_KEY 或密钥文件
+func EncodeKey(key []byte) string {
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+// DecodeKey 解码 base64 格式的主密钥
+func DecodeKey(s string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("decode credential store master key failed: %v", err)
+	}
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("credential store master key must be %d bytes, got %d", KeySize, len(key))
+	}
+	return key, nil
+}
+
+// LoadKey 读取主密钥，CREDSTORE_KEY 优先于 CREDSTORE_KEY_FILE
+func LoadKey(cfg *config.Config) ([]byte, error) {
+	if cfg.CredStoreKey != "" {
+		return DecodeKey(cfg.CredStoreKey)
+	}
+	if cfg.CredStoreKeyFile != "" {
+		data, err := os.ReadFile(cfg.CredStoreKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("read credential store key file failed: %v", err)
+		}
+		return DecodeKey(string(data))
+	}
+	return nil, ErrNoKey
+}
+
+// Load 解密并读取凭据库，文件不存在时返回空内容
+func (s *Store) Load() (*Data, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.loadLocked()
+}
+
+// Save 加密并写入凭据库
+func (s *Store) Save(data *Data) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.saveLocked(data, s.key)
+}
+
+// Update 在同一把锁内读取、修改并写回凭据库
+func (s *Store) Update(fn func(data *Data) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, err := s.loadLocked()
+	if err != nil {
+		return err
+	}
+	if err := fn(data); err != nil {
+		return err
+	}
+	return s.saveLocked(data, s.key)
+}
+
+// Rekey 使用新的主密钥重新加密凭据库
+func (s *Store) Rekey(newKey []byte) error {
+	if len(newKey) != KeySize {
+		return fmt.Errorf("credential store master key must be %d bytes, got %d", KeySize, len(newKey))
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, err := s.loadLocked()
+	if err != nil {
+		return err
+	}
+	if err := s.saveLocked(data, newKey); err != nil {
+		return err
+	}
+	s.key = newKey
+	return nil
+}
+
+func (s *Store) loadLocked() (*Data, error) {
+	raw, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &Data{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read credential store failed: %v", err)
+	}
+
+	var env envelope
+	if err := json.Unmarshal(raw, &env); err != nil {
+		return nil, fmt.Errorf("parse credential store failed: %v", err)
+	}
+	if env.Version != version {
+		return nil, fmt.Errorf("unsupported credential store version: %d", env.Version)
+	}
+	nonce, err := base64.StdEncoding.DecodeString(env.Nonce)
+	if err != nil {
+		return nil, fmt.Errorf("parse credential store failed: %v", err)
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(env.Ciphertext)
+	if err != nil {
+		return nil, fmt.Errorf("parse credential store failed: %v", err)
+	}
+
+	gcm, err := newGCM(s.key)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != gcm.NonceSize() {
+		return nil, fmt.Errorf("parse credential store failed: invalid nonce")
+	}
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, additionalData)
+	if err != nil {
+		return nil, errors.New("decrypt credential store failed: wrong master key or corrupted file")
+	}
+
+	var data Data
+	if err := json.Unmarshal(plaintext, &data); err != nil {
+		return nil, fmt.Errorf("parse credential store failed: %v", err)
+	}
+	return &data, nil
+}
+
+func (s *Store) saveLocked(data *Data, key []byte) error {
+	plaintext, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+
+	raw, err := json.MarshalIndent(envelope{
+		Version:    version,
+		Nonce:      base64.StdEncoding.EncodeToString(nonce),
+		Ciphertext: base64.StdEncoding.EncodeToString(gcm.Seal(nil, nonce, plaintext, additionalData)),
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := utils.WriteFileAtomic(s.path, raw); err != nil {
+		return fmt.Errorf("write credential store failed: %v", err)
+	}
+	return nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// accountBackend 将凭据库中的账号接入账号池，管理接口的修改写回凭据库，API 密钥保持不变
+type accountBackend struct {
+	store *Store
+}
+
+// Accounts 返回凭据库的账号来源
+func (s *Store) Accounts() account.Backend {
+	return &accountBackend{store: s}
+}
+
+func (b *accountBackend) Source() account.Source {
+	return account.SourceStore
+}
+
+func (b *accountBackend) Load() ([]account.Record, error) {
+	data, err := b.store.Load()
+	if err != nil {
+		return nil, err
+	}
+	return data.Accounts, nil
+}
+
+func (b *accountBackend) Save(records []account.Record) error {
+	return b.store.Update(func(data *Data) error {
+		data.Accounts = records
+		return nil
+	})
+}
+
+// keyBackend 将凭据库中的 API 密钥接入密钥库，修改写回凭据库，账号保持不变
+type keyBackend struct {
+	store *Store
+}
+
+// APIKeys 返回凭据库的 API 密钥来源
+func (s *Store) APIKeys() apikey.Backend {
+	return &keyBackend{store: s}
+}
+
+func (b *keyBackend) Load() ([]apikey.Key, error) {
+	data, err := b.store.Load()
+	if err != nil {
+		return nil, err
+	}
+	return data.APIKeys, nil
+}
+
+func (b *keyBackend) Save(keys []apikey.Key) error {
+	return b.store.Update(func(data *Data) error {
+		data.APIKeys = keys
+		return nil
+	})
+}
@@ -0,0 +1,215 @@
+package jwtauth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"sync"
+	"time"
+)
+
+// minRSABits 接受的 RSA 公钥最小长度
+const minRSABits = 2048
+
+// WatchInterval 检查 JWKS 文件是否修改的间隔
+const WatchInterval = 30 * time.Second
+
+// jwk JWKS 中的一个公钥，只支持 RSA 与 P-256 椭圆曲线
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// publicKey 解析后的公钥，alg 为 RS256 或 ES256
+type publicKey struct {
+	kid string
+	alg string
+	key crypto.PublicKey
+}
+
+// KeySet JWKS 文件中的公钥。Reload 失败时保留之前加载的公钥
+type KeySet struct {
+	path string
+
+	mu      sync.RWMutex
+	keys    []publicKey
+	modTime time.Time
+	size    int64
+}
+
+// LoadKeySet 读取 JWKS 文件
+func LoadKeySet(path string) (*KeySet, error) {
+	s := &KeySet{path: path}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Path 返回 JWKS 文件路径
+func (s *KeySet) Path() string {
+	return s.path
+}
+
+// Len 返回可用的公钥数量
+func (s *KeySet) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.keys)
+}
+
+// Reload 重新读取 JWKS 文件，跳过不支持的密钥类型与用途不是签名的公钥
+func (s *KeySet) Reload() error {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return fmt.Errorf("read jwks file failed: %v", err)
+	}
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return fmt.Errorf("read jwks file failed: %v", err)
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return fmt.Errorf("parse jwks file failed: %v", err)
+	}
+
+	keys := make([]publicKey, 0, len(set.Keys))
+	for i, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.parse()
+		if err != nil {
+			return fmt.Errorf("parse jwks key %d (kid %q) failed: %v", i, k.Kid, err)
+		}
+		if key != nil {
+			keys = append(keys, *key)
+		}
+	}
+
+	s.mu.Lock()
+	s.keys = keys
+	s.modTime = info.ModTime()
+	s.size = info.Size()
+	s.mu.Unlock()
+	return nil
+}
+
+// reloadIfChanged 文件的修改时间或大小变化时重新加载
+func (s *KeySet) reloadIfChanged() {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		log.Printf("check jwks file failed: %v", err)
+		return
+	}
+	s.mu.RLock()
+	changed := !info.ModTime().Equal(s.modTime) || info.Size() != s.size
+	s.mu.RUnlock()
+	if !changed {
+		return
+	}
+	if err := s.Reload(); err != nil {
+		log.Printf("reload jwks failed, keeping previous keys: %v", err)
+		return
+	}
+	log.Printf("Reloaded jwks %s: %d keys", s.path, s.Len())
+}
+
+// Watch 在后台定期检查 JWKS 文件，修改后自动重新加载
+func (s *KeySet) Watch(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.reloadIfChanged()
+			}
+		}
+	}()
+}
+
+// find 返回可以校验指定算法签名的公钥，kid 为空时返回该算法的全部公钥
+func (s *KeySet) find(kid, alg string) []crypto.PublicKey {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var keys []crypto.PublicKey
+	for _, k := range s.keys {
+		if k.alg == alg && (kid == "" || k.kid == kid) {
+			keys = append(keys, k.key)
+		}
+	}
+	return keys
+}
+
+// parse 解析公钥，不支持的密钥类型返回 nil
+func (k jwk) parse() (*publicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		if k.Alg != "" && k.Alg != "RS256" {
+			return nil, nil
+		}
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid n: %v", err)
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil || !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("invalid e")
+		}
+		if n.BitLen() < minRSABits {
+			return nil, fmt.Errorf("rsa key must be at least %d bits", minRSABits)
+		}
+		return &publicKey{kid: k.Kid, alg: "RS256", key: &rsa.PublicKey{N: n, E: int(e.Int64())}}, nil
+	case "EC":
+		if k.Crv != "P-256" || (k.Alg != "" && k.Alg != "ES256") {
+			return nil, nil
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != 32 {
+			return nil, fmt.Errorf("invalid x")
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil || len(y) != 32 {
+			return nil, fmt.Errorf("invalid y")
+		}
+		// 通过 ecdh 校验点在曲线上
+		if _, err := ecdh.P256().NewPublicKey(append(append([]byte{4}, x...), y...)); err != nil {
+			return nil, fmt.Errorf("invalid ec point: %v", err)
+		}
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		return &publicKey{kid: k.Kid, alg: "ES256", key: key}, nil
+	}
+	return nil, nil
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == 0 {
+		return nil, fmt.Errorf("empty value")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,98 @@
+package jwtauth
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+
+	"monica-proxy/internal/apikey"
+	"monica-proxy/internal/usage"
+)
+
+// Rule 把 JWT 的调用方或所属组映射到与 API 密钥相同的权限范围、模型策略、速率限制与配额。
+// Subject 与 Group 都为空时匹配全部令牌
+type Rule struct {
+	Subject       string         `json:"subject,omitempty"` // 匹配的调用方标识
+	Group         string         `json:"group,omitempty"`   // 匹配的组，调用方属于该组即可
+	Scopes        []apikey.Scope `json:"scopes,omitempty"`  // 为空时使用 chat、images
+	apikey.Policy                // 允许使用的模型
+	RPM           int            `json:"rpm,omitempty"`
+	TPM           int            `json:"tpm,omitempty"`
+	Quotas        []usage.Quota  `json:"quotas,omitempty"`
+}
+
+// PolicyFile JWT 策略文件，按顺序使用第一条匹配的规则
+//
+//	{
+//	  "rules": [
+//	    {"group": "proxy-admins", "scopes": ["chat", "images", "admin"]},
+//	    {"group": "ml", "allow_models": ["gpt-4o*", "claude-*"], "rpm": 60},
+//	    {"scopes": ["chat"], "allow_models": ["gpt-4o-mini"]}
+//	  ]
+//	}
+type PolicyFile struct {
+	Rules []Rule `json:"rules"`
+}
+
+// defaultRules 未配置策略文件时所有令牌使用默认权限范围，不限制模型
+var defaultRules = []Rule{{}}
+
+// LoadRules 读取 JWT 策略文件，file 为空时返回默认规则
+func LoadRules(file string, quotas *usage.QuotaConfig) ([]Rule, error) {
+	if file == "" {
+		return defaultRules, nil
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("read jwt policy file failed: %v", err)
+	}
+	var pf PolicyFile
+	if err := json.Unmarshal(data, &pf); err != nil {
+		return nil, fmt.Errorf("parse jwt policy file failed: %v", err)
+	}
+	for i, r := range pf.Rules {
+		for _, scope := range r.Scopes {
+			if !slices.Contains(apikey.AllScopes, scope) {
+				return nil, fmt.Errorf("jwt policy rule %d: unknown api key scope: %s", i, scope)
+			}
+		}
+		if err := r.Policy.Validate(); err != nil {
+			return nil, fmt.Errorf("jwt policy rule %d: %v", i, err)
+		}
+		if r.RPM < 0 || r.TPM < 0 {
+			return nil, fmt.Errorf("jwt policy rule %d: rate limits must not be negative", i)
+		}
+		if err := quotas.Validate(r.Quotas); err != nil {
+			return nil, fmt.Errorf("jwt policy rule %d: %v", i, err)
+		}
+	}
+	return pf.Rules, nil
+}
+
+// matches 返回规则是否匹配调用方
+func (r *Rule) matches(c *Claims) bool {
+	if r.Subject != "" && r.Subject != c.Subject {
+		return false
+	}
+	return r.Group == "" || slices.Contains(c.Groups, r.Group)
+}
+
+// key 按规则为调用方生成密钥，ID 为 "jwt:" 加调用方标识，用于限流、用量与配额，令牌过期时密钥同时过期
+func (r *Rule) key(c *Claims) *apikey.Key {
+	scopes := r.Scopes
+	if len(scopes) == 0 {
+		scopes = apikey.DefaultScopes
+	}
+	return &apikey.Key{
+		ID:        "jwt:" + c.Subject,
+		Name:      c.Subject,
+		Owner:     c.Subject,
+		Scopes:    scopes,
+		ExpiresAt: c.ExpiresAt,
+		Policy:    r.Policy,
+		RPM:       r.RPM,
+		TPM:       r.TPM,
+		Quotas:    r.Quotas,
+	}
+}
@@ -0,0 +1,280 @@
+package jwtauth
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+
+	"monica-proxy/internal/apikey"
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid jwt")
+	ErrTokenExpired = errors.New("jwt has expired")
+	ErrNoPolicy     = errors.New("no jwt policy matches the token")
+)
+
+// Options JWT 校验参数，Secret 与 Keys 至少配置一个
+type Options struct {
+	Secret       []byte   // HS256 共享密钥
+	Keys         *KeySet  // RS256 / ES256 公钥
+	Issuer       string   // 要求的 iss，为空时不校验
+	Audience     []string // 接受的 aud，令牌的 aud 包含其中之一即可，为空时不校验
+	SubjectClaim string   // 作为调用方标识的声明，支持 "a.b" 形式的嵌套声明
+	GroupsClaim  string   // 调用方所属组的声明，值为字符串数组或以空格分隔的字符串
+	Leeway       time.Duration
+	Rules        []Rule
+}
+
+// minSecretLen HS256 共享密钥的最小长度，与 SHA-256 输出长度相同
+const minSecretLen = 32
+
+// Validator 校验 JWT 并按策略规则映射为 API 密钥
+type Validator struct {
+	opts Options
+	now  func() time.Time
+}
+
+// Default 全局 JWT 校验器，未启用 JWT 认证时为 nil
+var Default *Validator
+
+// New 创建校验器
+func New(opts Options) (*Validator, error) {
+	if len(opts.Secret) == 0 && opts.Keys == nil {
+		return nil, errors.New("jwt secret or jwks file is required")
+	}
+	if len(opts.Secret) > 0 && len(opts.Secret) < minSecretLen {
+		return nil, fmt.Errorf("jwt secret must be at least %d bytes", minSecretLen)
+	}
+	if opts.SubjectClaim == "" {
+		opts.SubjectClaim = "sub"
+	}
+	if opts.GroupsClaim == "" {
+		opts.GroupsClaim = "groups"
+	}
+	if opts.Rules == nil {
+		opts.Rules = defaultRules
+	}
+	return &Validator{opts: opts, now: time.Now}, nil
+}
+
+// LooksLikeJWT 返回令牌是否为 JWS 紧凑格式，用于与静态 API 密钥区分
+func LooksLikeJWT(token string) bool {
+	return strings.HasPrefix(token, "eyJ") && strings.Count(token, ".") == 2
+}
+
+// Claims 校验通过的 JWT 中用于映射策略的声明
+type Claims struct {
+	Subject   string
+	Groups    []string
+	ExpiresAt time.Time
+}
+
+// header JWS 头部
+type header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// Authenticate 校验 JWT，返回第一条匹配的策略规则生成的密钥
+func (v *Validator) Authenticate(token string) (*apikey.Key, error) {
+	claims, err := v.Verify(token)
+	if err != nil {
+		return nil, err
+	}
+	for i := range v.opts.Rules {
+		if rule := &v.opts.Rules[i]; rule.matches(claims) {
+			return rule.key(claims), nil
+		}
+	}
+	return nil, fmt.Errorf("%w: subject %s", ErrNoPolicy, claims.Subject)
+}
+
+// Verify 校验签名与 iss、aud、exp、nbf，返回调用方标识与所属组
+func (v *Validator) Verify(token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed token", ErrInvalidToken)
+	}
+	var h header
+	if err := decodeSegment(parts[0], &h); err != nil {
+		return nil, fmt.Errorf("%w: invalid header", ErrInvalidToken)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid signature encoding", ErrInvalidToken)
+	}
+	if err := v.verifySignature(h, parts[0]+"."+parts[1], sig); err != nil {
+		return nil, err
+	}
+
+	var payload map[string]any
+	if err := decodeSegment(parts[1], &payload); err != nil {
+		return nil, fmt.Errorf("%w: invalid payload", ErrInvalidToken)
+	}
+	return v.checkClaims(payload)
+}
+
+// verifySignature 按头部的 alg 校验签名，不接受 none 以及与密钥类型不符的算法
+func (v *Validator) verifySignature(h header, input string, sig []byte) error {
+	digest := sha256.Sum256([]byte(input))
+	switch h.Alg {
+	case "HS256":
+		if len(v.opts.Secret) == 0 {
+			break
+		}
+		mac := hmac.New(sha256.New, v.opts.Secret)
+		mac.Write([]byte(input))
+		if hmac.Equal(mac.Sum(nil), sig) {
+			return nil
+		}
+		return fmt.Errorf("%w: signature mismatch", ErrInvalidToken)
+	case "RS256", "ES256":
+		if v.opts.Keys == nil {
+			break
+		}
+		keys := v.opts.Keys.find(h.Kid, h.Alg)
+		if len(keys) == 0 {
+			return fmt.Errorf("%w: no %s key found for kid %q", ErrInvalidToken, h.Alg, h.Kid)
+		}
+		for _, key := range keys {
+			if verifyWithKey(h.Alg, key, digest[:], sig) {
+				return nil
+			}
+		}
+		return fmt.Errorf("%w: signature mismatch", ErrInvalidToken)
+	}
+	return fmt.Errorf("%w: unsupported alg %q", ErrInvalidToken, h.Alg)
+}
+
+func verifyWithKey(alg string, key any, digest, sig []byte) bool {
+	switch alg {
+	case "RS256":
+		pub, ok := key.(*rsa.PublicKey)
+		return ok && rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest, sig) == nil
+	case "ES256":
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok || len(sig) != 64 {
+			return false
+		}
+		r := new(big.Int).SetBytes(sig[:32])
+		s := new(big.Int).SetBytes(sig[32:])
+		return ecdsa.Verify(pub, digest, r, s)
+	}
+	return false
+}
+
+// checkClaims 校验标准声明并提取调用方标识与所属组
+func (v *Validator) checkClaims(payload map[string]any) (*Claims, error) {
+	now := v.now()
+	exp, ok := numericDate(payload["exp"])
+	if !ok {
+		return nil, fmt.Errorf("%w: missing exp", ErrInvalidToken)
+	}
+	if !now.Before(exp.Add(v.opts.Leeway)) {
+		return nil, ErrTokenExpired
+	}
+	if raw, present := payload["nbf"]; present {
+		nbf, ok := numericDate(raw)
+		if !ok {
+			return nil, fmt.Errorf("%w: invalid nbf", ErrInvalidToken)
+		}
+		if now.Add(v.opts.Leeway).Before(nbf) {
+			return nil, fmt.Errorf("%w: token is not valid yet", ErrInvalidToken)
+		}
+	}
+	if v.opts.Issuer != "" {
+		if iss, _ := payload["iss"].(string); iss != v.opts.Issuer {
+			return nil, fmt.Errorf("%w: unexpected iss %q", ErrInvalidToken, iss)
+		}
+	}
+	if len(v.opts.Audience) > 0 {
+		aud := stringList(payload["aud"])
+		if s, ok := payload["aud"].(string); ok {
+			aud = []string{s}
+		}
+		if !slices.ContainsFunc(aud, func(a string) bool { return slices.Contains(v.opts.Audience, a) }) {
+			return nil, fmt.Errorf("%w: unexpected aud %q", ErrInvalidToken, aud)
+		}
+	}
+
+	subject, _ := lookupClaim(payload, v.opts.SubjectClaim).(string)
+	if subject == "" {
+		return nil, fmt.Errorf("%w: missing %s claim", ErrInvalidToken, v.opts.SubjectClaim)
+	}
+	return &Claims{
+		Subject:   subject,
+		Groups:    stringList(lookupClaim(payload, v.opts.GroupsClaim)),
+		ExpiresAt: exp,
+	}, nil
+}
+
+// lookupClaim 按 "a.b" 形式的路径读取嵌套声明，如 Keycloak 的 realm_access.roles
+func lookupClaim(payload map[string]any, name string) any {
+	if v, ok := payload[name]; ok {
+		return v
+	}
+	var cur any = payload
+	for _, part := range strings.Split(name, ".") {
+		m, ok := cur.(map[string]any)
+		if !ok {
+			return nil
+		}
+		cur = m[part]
+	}
+	return cur
+}
+
+// numericDate 解析 NumericDate（自 1970 年起的秒数，可以带小数）
+func numericDate(v any) (time.Time, bool) {
+	n, ok := v.(json.Number)
+	if !ok {
+		return time.Time{}, false
+	}
+	f, err := n.Float64()
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		return time.Time{}, false
+	}
+	sec, frac := math.Modf(f)
+	return time.Unix(int64(sec), int64(frac*1e9)), true
+}
+
+// stringList 将字符串数组或以空格分隔的字符串转换为列表，其他类型返回 nil
+func stringList(v any) []string {
+	switch v := v.(type) {
+	case string:
+		return strings.Fields(v)
+	case []any:
+		list := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	}
+	return nil
+}
+
+// decodeSegment 解码 base64url 编码的 JSON，数字保留为 json.Number
+func decodeSegment(seg string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
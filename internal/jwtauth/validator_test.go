@@ -0,0 +1,236 @@
+package jwtauth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var testSecret = []byte("0123456789abcdef0123456789abcdef")
+
+// testKeys 测试用的 RSA 与 EC 私钥，公钥写入 JWKS 文件
+type testKeys struct {
+	rsa   *rsa.PrivateKey
+	ec    *ecdsa.PrivateKey
+	other *rsa.PrivateKey // 不在 JWKS 中的密钥
+	set   *KeySet
+}
+
+func newTestKeys(t *testing.T) *testKeys {
+	t.Helper()
+	k := &testKeys{}
+	var err error
+	if k.rsa, err = rsa.GenerateKey(rand.Reader, 2048); err != nil {
+		t.Fatal(err)
+	}
+	if k.other, err = rsa.GenerateKey(rand.Reader, 2048); err != nil {
+		t.Fatal(err)
+	}
+	if k.ec, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader); err != nil {
+		t.Fatal(err)
+	}
+	b64 := base64.RawURLEncoding.EncodeToString
+	jwks := map[string]any{"keys": []map[string]string{
+		{"kty": "RSA", "kid": "rsa", "use": "sig", "alg": "RS256",
+			"n": b64(k.rsa.N.Bytes()), "e": b64(big.NewInt(int64(k.rsa.E)).Bytes())},
+		{"kty": "EC", "kid": "ec", "crv": "P-256",
+			"x": b64(k.ec.X.FillBytes(make([]byte, 32))), "y": b64(k.ec.Y.FillBytes(make([]byte, 32)))},
+	}}
+	data, _ := json.Marshal(jwks)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if k.set, err = LoadKeySet(path); err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+// sign 生成 JWT，key 为 []byte（HS256）、*rsa.PrivateKey（RS256）、*ecdsa.PrivateKey（ES256）或 nil（不签名）
+func sign(t *testing.T, h map[string]any, claims map[string]any, key any) string {
+	t.Helper()
+	hb, _ := json.Marshal(h)
+	cb, _ := json.Marshal(claims)
+	input := base64.RawURLEncoding.EncodeToString(hb) + "." + base64.RawURLEncoding.EncodeToString(cb)
+	digest := sha256.Sum256([]byte(input))
+	var sig []byte
+	switch key := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(input))
+		sig = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		var err error
+		if sig, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:]); err != nil {
+			t.Fatal(err)
+		}
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+	return input + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestVerify(t *testing.T) {
+	keys := newTestKeys(t)
+	now := time.Unix(1700000000, 0)
+	v, err := New(Options{
+		Secret:   testSecret,
+		Keys:     keys.set,
+		Issuer:   "https://idp.example.com",
+		Audience: []string{"monica-proxy"},
+		Leeway:   time.Minute,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	v.now = func() time.Time { return now }
+
+	claims := func(overrides map[string]any) map[string]any {
+		c := map[string]any{
+			"sub": "alice",
+			"iss": "https://idp.example.com",
+			"aud": "monica-proxy",
+			"exp": now.Add(time.Hour).Unix(),
+		}
+		for k, v := range overrides {
+			if v == nil {
+				delete(c, k)
+			} else {
+				c[k] = v
+			}
+		}
+		return c
+	}
+	rs := map[string]any{"alg": "RS256", "kid": "rsa"}
+	pub, _ := x509.MarshalPKIXPublicKey(&keys.rsa.PublicKey)
+
+	tests := []struct {
+		name  string
+		token string
+		err   error // nil 表示校验通过
+	}{
+		{"hs256", sign(t, map[string]any{"alg": "HS256"}, claims(nil), testSecret), nil},
+		{"rs256", sign(t, rs, claims(nil), keys.rsa), nil},
+		{"es256", sign(t, map[string]any{"alg": "ES256", "kid": "ec"}, claims(nil), keys.ec), nil},
+		{"rs256 without kid", sign(t, map[string]any{"alg": "RS256"}, claims(nil), keys.rsa), nil},
+		{"aud list", sign(t, rs, claims(map[string]any{"aud": []string{"other", "monica-proxy"}}), keys.rsa), nil},
+		{"expired within leeway", sign(t, rs, claims(map[string]any{"exp": now.Add(-30 * time.Second).Unix()}), keys.rsa), nil},
+
+		{"alg none", sign(t, map[string]any{"alg": "none"}, claims(nil), nil), ErrInvalidToken},
+		{"alg none uppercase", sign(t, map[string]any{"alg": "NONE"}, claims(nil), nil), ErrInvalidToken},
+		{"rs256 header with hmac signature", sign(t, rs, claims(nil), testSecret), ErrInvalidToken},
+		{"hs256 signed with rsa public key", sign(t, map[string]any{"alg": "HS256"}, claims(nil), pub), ErrInvalidToken},
+		{"hs256 wrong secret", sign(t, map[string]any{"alg": "HS256"}, claims(nil), []byte("fedcba9876543210fedcba9876543210")), ErrInvalidToken},
+		{"rs256 wrong key", sign(t, rs, claims(nil), keys.other), ErrInvalidToken},
+		{"rs256 unknown kid", sign(t, map[string]any{"alg": "RS256", "kid": "missing"}, claims(nil), keys.rsa), ErrInvalidToken},
+		{"es256 key used as rs256", sign(t, map[string]any{"alg": "RS256", "kid": "ec"}, claims(nil), keys.rsa), ErrInvalidToken},
+		{"expired", sign(t, rs, claims(map[string]any{"exp": now.Add(-2 * time.Minute).Unix()}), keys.rsa), ErrTokenExpired},
+		{"missing exp", sign(t, rs, claims(map[string]any{"exp": nil}), keys.rsa), ErrInvalidToken},
+		{"not yet valid", sign(t, rs, claims(map[string]any{"nbf": now.Add(2 * time.Minute).Unix()}), keys.rsa), ErrInvalidToken},
+		{"wrong aud", sign(t, rs, claims(map[string]any{"aud": "other"}), keys.rsa), ErrInvalidToken},
+		{"aud with spaces", sign(t, rs, claims(map[string]any{"aud": "other monica-proxy"}), keys.rsa), ErrInvalidToken},
+		{"missing aud", sign(t, rs, claims(map[string]any{"aud": nil}), keys.rsa), ErrInvalidToken},
+		{"wrong iss", sign(t, rs, claims(map[string]any{"iss": "https://evil.example.com"}), keys.rsa), ErrInvalidToken},
+		{"missing sub", sign(t, rs, claims(map[string]any{"sub": nil}), keys.rsa), ErrInvalidToken},
+		{"malformed", "eyJhbGciOiJIUzI1NiJ9.e30", ErrInvalidToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := v.Verify(tt.token)
+			if tt.err == nil {
+				if err != nil {
+					t.Fatalf("verify: %v", err)
+				}
+				if c.Subject != "alice" {
+					t.Fatalf("subject = %q, want alice", c.Subject)
+				}
+				return
+			}
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestVerifyRejectsAlgWithoutConfiguredKey(t *testing.T) {
+	keys := newTestKeys(t)
+	exp := time.Now().Add(time.Hour).Unix()
+
+	// 只配置 JWKS 时不接受 HS256，即使以公钥作为 HMAC 密钥
+	v, err := New(Options{Keys: keys.set})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, _ := x509.MarshalPKIXPublicKey(&keys.rsa.PublicKey)
+	token := sign(t, map[string]any{"alg": "HS256", "kid": "rsa"}, map[string]any{"sub": "alice", "exp": exp}, pub)
+	if _, err := v.Verify(token); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("hs256 with jwks only: err = %v, want ErrInvalidToken", err)
+	}
+
+	// 只配置共享密钥时不接受 RS256
+	v, err = New(Options{Secret: testSecret})
+	if err != nil {
+		t.Fatal(err)
+	}
+	token = sign(t, map[string]any{"alg": "RS256"}, map[string]any{"sub": "alice", "exp": exp}, keys.rsa)
+	if _, err := v.Verify(token); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("rs256 with secret only: err = %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestNewRejectsShortSecret(t *testing.T) {
+	if _, err := New(Options{Secret: []byte("short")}); err == nil {
+		t.Fatal("short hs256 secret was accepted")
+	}
+	if _, err := New(Options{}); err == nil {
+		t.Fatal("validator without secret or keys was accepted")
+	}
+}
+
+func TestAuthenticateMapsPolicy(t *testing.T) {
+	v, err := New(Options{
+		Secret: testSecret,
+		Rules: []Rule{
+			{Group: "admins", RPM: 100},
+			{Subject: "bob", TPM: 10},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := time.Now().Add(time.Hour).Unix()
+	hs := map[string]any{"alg": "HS256"}
+
+	k, err := v.Authenticate(sign(t, hs, map[string]any{"sub": "alice", "groups": []string{"admins"}, "exp": exp}, testSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k.ID != "jwt:alice" || k.RPM != 100 || len(k.Scopes) == 0 {
+		t.Fatalf("alice key = %+v", k)
+	}
+	if k, err = v.Authenticate(sign(t, hs, map[string]any{"sub": "bob", "exp": exp}, testSecret)); err != nil || k.TPM != 10 {
+		t.Fatalf("bob key = %+v, err = %v", k, err)
+	}
+	if _, err := v.Authenticate(sign(t, hs, map[string]any{"sub": "carol", "exp": exp}, testSecret)); !errors.Is(err, ErrNoPolicy) {
+		t.Fatalf("carol err = %v, want ErrNoPolicy", err)
+	}
+}
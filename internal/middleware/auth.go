@@ -1,36 +1,103 @@
 package middleware
 
 import (
+	"context"
+	"errors"
 	"log"
-	"monica-proxy/internal/config"
+	"monica-proxy/internal/apikey"
+	"monica-proxy/internal/jwtauth"
 	"net/http"
 	"strings"
 
 	"github.com/labstack/echo/v4"
 )
 
-// BearerAuth 创建一个Bearer Token认证中间件
+// KeyContextKey 认证通过的 *apikey.Key 在 echo.Context 中的键
+const KeyContextKey = "api_key"
+
+// BearerAuth 创建 API 密钥认证中间件，校验通过后把密钥放入 echo.Context 与请求的 context。
+// 启用 JWT 认证时，JWT 格式的令牌按策略规则映射为密钥，其余令牌仍按静态 API 密钥校验
 func BearerAuth() echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
-			// 获取Authorization header
-			auth := c.Request().Header.Get("Authorization")
+			// 提取token
+			token := extractToken(c)
+			if token == "" {
+				return echo.NewHTTPError(http.StatusUnauthorized, "missing api key")
+			}
 
-			// 检查header格式
-			if auth == "" || !strings.HasPrefix(auth, "Bearer ") {
-				return echo.NewHTTPError(http.StatusUnauthorized, "invalid authorization header")
+			// 验证token，日志中不输出令牌本身
+			var key *apikey.Key
+			var err error
+			if jwtauth.Default != nil && jwtauth.LooksLikeJWT(token) {
+				key, err = jwtauth.Default.Authenticate(token)
+			} else {
+				key, err = apikey.DefaultStore.Authenticate(token)
+			}
+			if err != nil {
+				log.Printf("rejected api key from %s: %v", c.RealIP(), err)
+				// 令牌有效但没有匹配的策略规则
+				if errors.Is(err, jwtauth.ErrNoPolicy) {
+					return echo.NewHTTPError(http.StatusForbidden, err.Error())
+				}
+				return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
 			}
 
-			// 提取token
-			token := strings.TrimPrefix(auth, "Bearer ")
+			c.Set(KeyContextKey, key)
+			c.SetRequest(c.Request().WithContext(apikey.WithKey(c.Request().Context(), key)))
+			return next(c)
+		}
+	}
+}
 
-			// 验证token
-			if token != config.MonicaConfig.BearerToken || token == "" {
-				log.Printf("invalid token: %s", token)
-				return echo.NewHTTPError(http.StatusUnauthorized, "invalid token")
+// RequireScope 要求认证通过的密钥拥有指定的权限范围，需要在 BearerAuth 之后使用
+func RequireScope(scope apikey.Scope) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			key := CurrentKey(c)
+			if key == nil {
+				return echo.NewHTTPError(http.StatusUnauthorized, "missing api key")
+			}
+			if !key.HasScope(scope) {
+				return echo.NewHTTPError(http.StatusForbidden, "api key does not have the "+string(scope)+" scope")
 			}
-
 			return next(c)
 		}
 	}
 }
+
+// CurrentKey 返回本次请求认证通过的密钥，未经过认证时返回 nil
+func CurrentKey(c echo.Context) *apikey.Key {
+	key, _ := c.Get(KeyContextKey).(*apikey.Key)
+	return key
+}
+
+// APIKeyFromContext 返回本次请求使用的 API 密钥 ID，用于排队公平性与日志，未经过认证时返回空字符串
+func APIKeyFromContext(ctx context.Context) string {
+	if key := apikey.FromContext(ctx); key != nil {
+		return key.ID
+	}
+	return ""
+}
+
+// geminiPathPrefix Gemini 风格接口的路径前缀，只有这些接口接受 key 查询参数
+const geminiPathPrefix = "/v1beta/"
+
+// extractToken 依次从 Authorization Bearer、x-api-key、x-goog-api-key header 与 key 查询参数中获取令牌，
+// x-api-key 用于兼容 Anthropic 风格的客户端，后两者用于兼容 Gemini 风格的客户端。
+// 查询参数容易出现在日志与代理记录中，只在 Gemini 风格的接口上接受
+func extractToken(c echo.Context) string {
+	if auth := c.Request().Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+	if key := c.Request().Header.Get("x-api-key"); key != "" {
+		return key
+	}
+	if key := c.Request().Header.Get("x-goog-api-key"); key != "" {
+		return key
+	}
+	if strings.HasPrefix(c.Request().URL.Path, geminiPathPrefix) {
+		return c.QueryParam("key")
+	}
+	return ""
+}
@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestExtractTokenQueryKeyOnlyOnGemini(t *testing.T) {
+	e := echo.New()
+	tests := []struct {
+		target string
+		want   string
+	}{
+		{"/v1beta/models/gemini-pro:generateContent?key=sk-secret", "sk-secret"},
+		{"/v1/chat/completions?key=sk-secret", ""},
+		{"/v1/usage?key=sk-secret", ""},
+		{"/admin/accounts?key=sk-secret", ""},
+	}
+	for _, tt := range tests {
+		c := e.NewContext(httptest.NewRequest("GET", tt.target, nil), httptest.NewRecorder())
+		if got := extractToken(c); got != tt.want {
+			t.Errorf("extractToken(%s) = %q, want %q", tt.target, got, tt.want)
+		}
+	}
+}
+
+func TestRedactURI(t *testing.T) {
+	e := echo.New()
+	tests := []struct {
+		target string
+		want   string
+	}{
+		{"/v1beta/models/gemini-pro:streamGenerateContent?alt=sse&key=sk-secret", "/v1beta/models/gemini-pro:streamGenerateContent?alt=sse&key=REDACTED"},
+		{"/v1/usage?format=csv", "/v1/usage?format=csv"},
+	}
+	for _, tt := range tests {
+		c := e.NewContext(httptest.NewRequest("GET", tt.target, nil), httptest.NewRecorder())
+		if got := redactURI(c); got != tt.want {
+			t.Errorf("redactURI(%s) = %q, want %q", tt.target, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	echomw "github.com/labstack/echo/v4/middleware"
+)
+
+// redactedQueryParams 访问日志中隐藏取值的查询参数，Gemini 风格的客户端通过 key 传递 API 密钥
+var redactedQueryParams = []string{"key"}
+
+// Logger 创建访问日志中间件，格式与 echo 默认的日志相同，但 uri 中的 API 密钥会被隐藏
+func Logger() echo.MiddlewareFunc {
+	cfg := echomw.DefaultLoggerConfig
+	cfg.Format = strings.Replace(cfg.Format, `"uri":"${uri}"`, `"uri":"${custom}"`, 1)
+	cfg.CustomTagFunc = func(c echo.Context, buf *bytes.Buffer) (int, error) {
+		uri, _ := json.Marshal(redactURI(c))
+		// 去掉两端的引号，外层格式已经带引号
+		return buf.Write(uri[1 : len(uri)-1])
+	}
+	return echomw.LoggerWithConfig(cfg)
+}
+
+// redactURI 返回隐藏了敏感查询参数的请求 URI
+func redactURI(c echo.Context) string {
+	u := *c.Request().URL
+	query := u.Query()
+	redacted := false
+	for _, name := range redactedQueryParams {
+		if query.Has(name) {
+			query.Set(name, "REDACTED")
+			redacted = true
+		}
+	}
+	if !redacted {
+		return c.Request().RequestURI
+	}
+	u.RawQuery = query.Encode()
+	return u.RequestURI()
+}
@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"errors"
+	"monica-proxy/internal/config"
+	"monica-proxy/internal/ratelimit"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sashabaranov/go-openai"
+)
+
+// RateLimit 按 API 密钥限制每分钟请求数与 token 数，需要在 BearerAuth 之后使用。
+// 有限制的密钥在每个响应中带上 x-ratelimit-* header，超出限制时返回 OpenAI 风格的 429
+func RateLimit() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			key := CurrentKey(c)
+			if key == nil {
+				return next(c)
+			}
+			limits := ratelimit.Limits{RPM: key.RPM, TPM: key.TPM}
+			if limits.RPM == 0 {
+				limits.RPM = config.MonicaConfig.RateLimitRPM
+			}
+			if limits.TPM == 0 {
+				limits.TPM = config.MonicaConfig.RateLimitTPM
+			}
+
+			meter, err := ratelimit.Default.Admit(key.ID, limits)
+			// 在写出响应头前填入剩余额度，包含本次请求已经扣除的 token
+			c.Response().Before(func() {
+				meter.SetHeaders(c.Response().Header())
+			})
+			if err != nil {
+				return RateLimitError(c, err)
+			}
+			if meter != nil {
+				c.SetRequest(c.Request().WithContext(ratelimit.WithMeter(c.Request().Context(), meter)))
+			}
+			return next(c)
+		}
+	}
+}
+
+// RateLimitError 返回 OpenAI 风格的 429 错误，err 不是 *ratelimit.Error 时原样返回
+func RateLimitError(c echo.Context, err error) error {
+	var limitErr *ratelimit.Error
+	if !errors.As(err, &limitErr) {
+		return err
+	}
+	c.Response().Header().Set("Retry-After", strconv.Itoa(limitErr.RetryAfterSeconds()))
+	return c.JSON(http.StatusTooManyRequests, openai.ErrorResponse{
+		Error: &openai.APIError{
+			Type:    limitErr.Kind,
+			Code:    "rate_limit_exceeded",
+			Message: limitErr.Error(),
+		},
+	})
+}
@@ -0,0 +1,276 @@
+package monica
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	lop "github.com/samber/lo/parallel"
+	"github.com/sashabaranov/go-openai"
+
+	"monica-proxy/internal/types"
+	"monica-proxy/internal/utils"
+)
+
+// NewChatCompletion 使用已经收集完整的输出构造 Chat Completions 非流式响应，思考内容放在 reasoning_content 中
+func NewChatCompletion(req openai.ChatCompletionRequest, reasoning, content, fp string) openai.ChatCompletionResponse {
+	resp := createMessage(utils.RandStringUsingMathRand(29), time.Now().Unix(), req, utils.CalculateUsage(req, reasoning+content), content, fp)
+	resp.Choices[0].Message.ReasoningContent = reasoning
+	return resp
+}
+
+// KeepAlive 返回向 SSE 客户端发送心跳注释的回调，用于在缓冲上游输出期间保持连接，可以被多个协程同时调用
+func KeepAlive(w io.Writer) func() error {
+	writer := bufio.NewWriterSize(w, initialBufferSize)
+	var mu sync.Mutex
+	return func() error {
+		mu.Lock()
+		defer mu.Unlock()
+		return sendHeartbeat(writer, w)
+	}
+}
+
+// StreamChatCompletion 将已经生成完整的响应按 Chat Completions 流式格式下发：
+// 每个 choice 依次下发思考内容、正文、工具调用与结束 chunk，最后一个 chunk 携带用量
+func StreamChatCompletion(w io.Writer, resp openai.ChatCompletionResponse) error {
+	writer := bufio.NewWriterSize(w, initialBufferSize)
+	chunk := func(index int, delta openai.ChatCompletionStreamChoiceDelta, finishReason openai.FinishReason) openai.ChatCompletionStreamResponse {
+		delta.Role = openai.ChatMessageRoleAssistant
+		return openai.ChatCompletionStreamResponse{
+			ID:                resp.ID,
+			Object:            sseObject,
+			Created:           resp.Created,
+			Model:             resp.Model,
+			SystemFingerprint: resp.SystemFingerprint,
+			Choices: []openai.ChatCompletionStreamChoice{{
+				Index:        index,
+				Delta:        delta,
+				FinishReason: finishReason,
+			}},
+		}
+	}
+
+	for i, choice := range resp.Choices {
+		msg := choice.Message
+		if msg.ReasoningContent != "" {
+			if err := sendMessage(writer, w, chunk(choice.Index, openai.ChatCompletionStreamChoiceDelta{ReasoningContent: msg.ReasoningContent}, openai.FinishReasonNull), false); err != nil {
+				return err
+			}
+		}
+		if msg.Content != "" {
+			if err := sendMessage(writer, w, chunk(choice.Index, openai.ChatCompletionStreamChoiceDelta{Content: msg.Content}, openai.FinishReasonNull), false); err != nil {
+				return err
+			}
+		}
+		for j, call := range msg.ToolCalls {
+			index := j
+			call.Index = &index
+			if err := sendMessage(writer, w, chunk(choice.Index, openai.ChatCompletionStreamChoiceDelta{ToolCalls: []openai.ToolCall{call}}, openai.FinishReasonNull), false); err != nil {
+				return err
+			}
+		}
+
+		final := chunk(choice.Index, openai.ChatCompletionStreamChoiceDelta{}, choice.FinishReason)
+		if i == len(resp.Choices)-1 {
+			usage := resp.Usage
+			final.Usage = &usage
+		}
+		if err := sendMessage(writer, w, final, true); err != nil {
+			return err
+		}
+	}
+	return sendFinishSignal(writer, w)
+}
+
+// SendStreamError 在已经开始的 SSE 流中下发 OpenAI 风格的错误并结束流
+func SendStreamError(w io.Writer, apiErr *openai.APIError) error {
+	writer := bufio.NewWriterSize(w, initialBufferSize)
+	if err := sendMessage(writer, w, openai.ErrorResponse{Error: apiErr}, true); err != nil {
+		return err
+	}
+	return sendFinishSignal(writer, w)
+}
+
+// MergeChatCompletions 将多个独立会话的响应合并为一个多 choice 响应，choice 按顺序重新编号，用量累加
+func MergeChatCompletions(resps []openai.ChatCompletionResponse) openai.ChatCompletionResponse {
+	merged := resps[0]
+	merged.Choices = nil
+	merged.Usage = openai.Usage{}
+	for _, resp := range resps {
+		for _, choice := range resp.Choices {
+			choice.Index = len(merged.Choices)
+			merged.Choices = append(merged.Choices, choice)
+		}
+		merged.Usage.PromptTokens += resp.Usage.PromptTokens
+		merged.Usage.CompletionTokens += resp.Usage.CompletionTokens
+		merged.Usage.TotalTokens += resp.Usage.TotalTokens
+	}
+	return merged
+}
+
+// ProcessMonicaResponses 并发读取多条上游响应（n > 1），合并为一个多 choice 的非流式响应
+func ProcessMonicaResponses(ctx context.Context, req openai.ChatCompletionRequest, bodies []io.Reader, fp string) (openai.ChatCompletionResponse, error) {
+	type result struct {
+		resp openai.ChatCompletionResponse
+		err  error
+	}
+	results := lop.Map(bodies, func(body io.Reader, _ int) result {
+		resp, err := ProcessMonicaResponse(ctx, req, body, fp)
+		return result{resp: resp, err: err}
+	})
+
+	resps := make([]openai.ChatCompletionResponse, 0, len(results))
+	for _, res := range results {
+		if res.err != nil {
+			return openai.ChatCompletionResponse{}, res.err
+		}
+		resps = append(resps, res.resp)
+	}
+	return MergeChatCompletions(resps), nil
+}
+
+// StreamMonicaSSEToChoices 将一条或多条上游响应转换为 Chat Completions 流式响应，
+// 每条上游响应对应一个 choice，各 choice 的 chunk 按 index 交错下发，最后结束的 choice 携带累计用量。
+// tools 不为空时解析工具调用，以 delta.tool_calls 下发：首个 chunk 携带 id 与函数名，之后的 chunk 逐段携带 arguments
+func StreamMonicaSSEToChoices(ctx context.Context, req openai.ChatCompletionRequest, tools *types.ToolEmulation, w io.Writer, bodies []io.Reader, fp string) error {
+	writer := bufio.NewWriterSize(w, initialBufferSize)
+	chatId := utils.RandStringUsingMathRand(29)
+	now := time.Now().Unix()
+
+	var mu sync.Mutex
+	var usage openai.Usage
+	remaining := len(bodies)
+
+	newChunk := func(index int, content, reasoning string) openai.ChatCompletionStreamResponse {
+		msg := createStreamMessage(chatId, now, req, fp, content, reasoning)
+		msg.Choices[0].Index = index
+		return msg
+	}
+	// send 在锁内连续下发多个 chunk，保证同一个 choice 的 chunk 不被其他 choice 打断
+	send := func(chunks ...openai.ChatCompletionStreamResponse) error {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, chunk := range chunks {
+			if err := sendMessage(writer, w, chunk, false); err != nil {
+				return err
+			}
+		}
+		return flushWriter(writer, w)
+	}
+
+	streamChoice := func(index int, body io.Reader) error {
+		var completion strings.Builder
+		var parser *toolStreamParser
+		if tools != nil {
+			parser = newToolStreamParser(tools)
+		}
+		callCount := 0
+
+		sendText := func(content, reasoning string) error {
+			if content == "" && reasoning == "" {
+				return nil
+			}
+			return send(newChunk(index, content, reasoning))
+		}
+		sendCall := func(call types.EmulatedToolCall) error {
+			toolCall := call.ToOpenAI(newToolCallID())
+			args := toolCall.Function.Arguments
+			callIndex := callCount
+			callCount++
+
+			toolCall.Index = &callIndex
+			toolCall.Function.Arguments = ""
+			head := newChunk(index, "", "")
+			head.Choices[0].Delta.ToolCalls = []openai.ToolCall{toolCall}
+			chunks := []openai.ChatCompletionStreamResponse{head}
+			for _, piece := range splitArguments(args) {
+				chunk := newChunk(index, "", "")
+				chunk.Choices[0].Delta.ToolCalls = []openai.ToolCall{{
+					Index:    &callIndex,
+					Function: openai.FunctionCall{Arguments: piece},
+				}}
+				chunks = append(chunks, chunk)
+			}
+			return send(chunks...)
+		}
+
+		err := ReadMonicaSSE(ctx, body, func(sseData SSEData) error {
+			reasoning, content := splitSSEData(sseData)
+			completion.WriteString(content)
+			if err := sendText("", reasoning); err != nil {
+				return err
+			}
+			if parser == nil {
+				return sendText(content, "")
+			}
+
+			text, calls := parser.feed(content)
+			if err := sendText(text, ""); err != nil {
+				return err
+			}
+			for _, call := range calls {
+				if err := sendCall(call); err != nil {
+					return err
+				}
+			}
+			return nil
+		}, func() error {
+			mu.Lock()
+			defer mu.Unlock()
+			return sendHeartbeat(writer, w)
+		})
+		if err != nil {
+			return err
+		}
+
+		if parser != nil {
+			if err := sendText(parser.finish(), ""); err != nil {
+				return err
+			}
+		}
+
+		final := newChunk(index, "", "")
+		final.Choices[0].FinishReason = openai.FinishReasonStop
+		if callCount > 0 {
+			final.Choices[0].FinishReason = openai.FinishReasonToolCalls
+		}
+		choiceUsage := utils.CalculateUsage(req, completion.String())
+
+		// 累计用量与下发结束 chunk 在同一把锁内完成，保证携带用量的 chunk 最后下发
+		mu.Lock()
+		defer mu.Unlock()
+		usage.PromptTokens += choiceUsage.PromptTokens
+		usage.CompletionTokens += choiceUsage.CompletionTokens
+		usage.TotalTokens += choiceUsage.TotalTokens
+		remaining--
+		if remaining == 0 {
+			total := usage
+			final.Usage = &total
+		}
+		if err := sendMessage(writer, w, final, false); err != nil {
+			return err
+		}
+		return flushWriter(writer, w)
+	}
+
+	errs := make([]error, len(bodies))
+	var wg sync.WaitGroup
+	for i, body := range bodies {
+		wg.Add(1)
+		go func(i int, body io.Reader) {
+			defer wg.Done()
+			errs[i] = streamChoice(i, body)
+		}(i, body)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return sendFinishSignal(writer, w)
+}
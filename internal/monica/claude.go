@@ -0,0 +1,213 @@
+package monica
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+
+	"monica-proxy/internal/types"
+	"monica-proxy/internal/utils"
+)
+
+const (
+	claudeStopEndTurn     = "end_turn"
+	claudeStopSequence    = "stop_sequence"
+	claudeBlockText       = "text"
+	claudeBlockThinking   = "thinking"
+	claudeMessageIDLength = 24
+	claudeMessageIDPrefix = "msg_"
+	claudeMessageType     = "message"
+	claudeRoleAssistant   = "assistant"
+)
+
+func newClaudeMessage(id, model string, usage types.ClaudeUsage) types.ClaudeResponse {
+	return types.ClaudeResponse{
+		ID:      id,
+		Type:    claudeMessageType,
+		Role:    claudeRoleAssistant,
+		Model:   model,
+		Content: []any{},
+		Usage:   usage,
+	}
+}
+
+// ProcessMonicaResponseToClaude 读取完整的上游响应并组装为 Anthropic 非流式响应
+func ProcessMonicaResponseToClaude(ctx context.Context, req types.ClaudeRequest, chatReq openai.ChatCompletionRequest, r io.Reader) (types.ClaudeResponse, error) {
+	thinking, text, err := CollectMonicaResponse(ctx, r)
+	if err != nil {
+		return types.ClaudeResponse{}, err
+	}
+
+	content, stop, hit := truncateAtStop(text, req.StopSequences)
+	usage := utils.CalculateUsage(chatReq, thinking+content)
+
+	resp := newClaudeMessage(claudeMessageIDPrefix+utils.RandStringUsingMathRand(claudeMessageIDLength), req.Model, types.ClaudeUsage{
+		InputTokens:  usage.PromptTokens,
+		OutputTokens: usage.CompletionTokens,
+	})
+	if thinking != "" {
+		resp.Content = append(resp.Content, types.ClaudeThinkingBlock{Type: claudeBlockThinking, Thinking: thinking})
+	}
+	resp.Content = append(resp.Content, types.ClaudeTextBlock{Type: claudeBlockText, Text: content})
+
+	stopReason := claudeStopEndTurn
+	if hit {
+		stopReason = claudeStopSequence
+		resp.StopSequence = &stop
+	}
+	resp.StopReason = &stopReason
+	return resp, nil
+}
+
+// claudeStreamWriter 维护 Anthropic 流式输出的内容块状态
+type claudeStreamWriter struct {
+	writer     *bufio.Writer
+	w          io.Writer
+	blockIndex int
+	blockType  string // 当前打开的内容块类型，为空表示没有打开的块
+	output     strings.Builder
+}
+
+func (s *claudeStreamWriter) send(event string, data any) error {
+	return sendEvent(s.writer, s.w, event, data)
+}
+
+// ensureBlock 确保当前打开的内容块为指定类型，类型切换时关闭旧块并开启新块
+func (s *claudeStreamWriter) ensureBlock(blockType string) error {
+	if s.blockType == blockType {
+		return nil
+	}
+	if err := s.closeBlock(); err != nil {
+		return err
+	}
+
+	var block any = types.ClaudeTextBlock{Type: claudeBlockText}
+	if blockType == claudeBlockThinking {
+		block = types.ClaudeThinkingBlock{Type: claudeBlockThinking}
+	}
+	s.blockType = blockType
+	return s.send("content_block_start", types.ClaudeContentBlockStartEvent{
+		Type:         "content_block_start",
+		Index:        s.blockIndex,
+		ContentBlock: block,
+	})
+}
+
+func (s *claudeStreamWriter) closeBlock() error {
+	if s.blockType == "" {
+		return nil
+	}
+	err := s.send("content_block_stop", types.ClaudeContentBlockStopEvent{Type: "content_block_stop", Index: s.blockIndex})
+	s.blockType = ""
+	s.blockIndex++
+	return err
+}
+
+func (s *claudeStreamWriter) thinking(text string) error {
+	if text == "" {
+		return nil
+	}
+	if err := s.ensureBlock(claudeBlockThinking); err != nil {
+		return err
+	}
+	s.output.WriteString(text)
+	return s.send("content_block_delta", types.ClaudeContentBlockDeltaEvent{
+		Type:  "content_block_delta",
+		Index: s.blockIndex,
+		Delta: types.ClaudeDelta{Type: "thinking_delta", Thinking: text},
+	})
+}
+
+func (s *claudeStreamWriter) text(text string) error {
+	if text == "" {
+		return nil
+	}
+	if err := s.ensureBlock(claudeBlockText); err != nil {
+		return err
+	}
+	s.output.WriteString(text)
+	return s.send("content_block_delta", types.ClaudeContentBlockDeltaEvent{
+		Type:  "content_block_delta",
+		Index: s.blockIndex,
+		Delta: types.ClaudeDelta{Type: "text_delta", Text: text},
+	})
+}
+
+// StreamMonicaSSEToClaude 将 Monica 上游 SSE 转换为 Anthropic Messages 流式事件
+func StreamMonicaSSEToClaude(ctx context.Context, req types.ClaudeRequest, chatReq openai.ChatCompletionRequest, w io.Writer, r io.Reader) error {
+	s := &claudeStreamWriter{
+		writer: bufio.NewWriterSize(w, initialBufferSize),
+		w:      w,
+	}
+	promptTokens := utils.CalculatePromptTokens(chatReq)
+
+	msg := newClaudeMessage(claudeMessageIDPrefix+utils.RandStringUsingMathRand(claudeMessageIDLength), req.Model, types.ClaudeUsage{InputTokens: promptTokens})
+	if err := s.send("message_start", types.ClaudeMessageStartEvent{Type: "message_start", Message: msg}); err != nil {
+		return err
+	}
+	if err := s.send("ping", types.ClaudeEvent{Type: "ping"}); err != nil {
+		return err
+	}
+
+	stops := newStopMatcher(req.StopSequences)
+	var stopSequence string
+	stopHit := false
+
+	err := ReadMonicaSSE(ctx, r, func(sseData SSEData) error {
+		reasoning, content := splitSSEData(sseData)
+		if err := s.thinking(reasoning); err != nil {
+			return err
+		}
+		emit, stop, hit := stops.feed(content)
+		if err := s.text(emit); err != nil {
+			return err
+		}
+		if hit {
+			stopSequence, stopHit = stop, true
+			return errStopReading
+		}
+		return nil
+	}, func() error {
+		return s.send("ping", types.ClaudeEvent{Type: "ping"})
+	})
+	if err != nil {
+		return err
+	}
+
+	if !stopHit {
+		if err := s.text(stops.flush()); err != nil {
+			return err
+		}
+	}
+	// 保证至少有一个内容块
+	if s.blockIndex == 0 && s.blockType == "" {
+		if err := s.ensureBlock(claudeBlockText); err != nil {
+			return err
+		}
+	}
+	if err := s.closeBlock(); err != nil {
+		return err
+	}
+
+	delta := types.ClaudeMessageDelta{}
+	stopReason := claudeStopEndTurn
+	if stopHit {
+		stopReason = claudeStopSequence
+		delta.StopSequence = &stopSequence
+	}
+	delta.StopReason = &stopReason
+	if err := s.send("message_delta", types.ClaudeMessageDeltaEvent{
+		Type:  "message_delta",
+		Delta: delta,
+		Usage: types.ClaudeUsage{
+			InputTokens:  promptTokens,
+			OutputTokens: utils.CalculateTokens(s.output.String()),
+		},
+	}); err != nil {
+		return err
+	}
+	return s.send("message_stop", types.ClaudeEvent{Type: "message_stop"})
+}
@@ -4,24 +4,45 @@ import (
 	"context"
 	"github.com/go-resty/resty/v2"
 	"log"
-	"monica-proxy/internal/config"
+	"monica-proxy/internal/account"
 	"monica-proxy/internal/types"
 	"monica-proxy/internal/utils"
 )
 
+// SendMonicaRequest 使用 context 中的账号发送对话请求
 func SendMonicaRequest(ctx context.Context, mReq *types.MonicaRequest) (*resty.Response, error) {
-	resp, err := utils.RestySSEClient.R().
+	acc := account.FromContext(ctx)
+	if acc == nil {
+		return nil, account.ErrNoAccount
+	}
+
+	resp, err := utils.SSEClient(acc.Proxy).R().
 		SetContext(ctx).
-		SetHeader("cookie", config.MonicaConfig.MonicaCookie).
+		SetHeader("cookie", acc.Cookie).
 		SetHeader("Accept", "text/event-stream").
 		SetDoNotParseResponse(true). // 不自动解析响应
 		SetBody(mReq).
 		Post(types.BotChatURL)
 
 	if err != nil {
-		log.Printf("Monica API error: %v", err)
-		return nil, err
+		log.Printf("Monica API error (account %s): %v", acc.ID, err)
+		// 真实请求的失败同样推进账号状态机，不必等到下一次健康检查
+		return nil, acc.ObserveError(ctx, utils.StatusCode(resp), err)
 	}
+	acc.Observe(account.OutcomeOK, "")
 
 	return resp, nil
 }
+
+// ProbeAccount 使用开销很小的文件查询接口探测账号状态，供账号池的健康检查使用
+func ProbeAccount(ctx context.Context, acc *account.Account) (int, string, error) {
+	resp, err := utils.DefaultClient(acc.Proxy).R().
+		SetContext(ctx).
+		SetHeader("cookie", acc.Cookie).
+		SetBody(map[string][]string{"file_uids": {}}).
+		Post(types.FileGetURL)
+	if utils.StatusCode(resp) == 0 {
+		return 0, "", err
+	}
+	return resp.StatusCode(), resp.String(), err
+}
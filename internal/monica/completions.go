@@ -0,0 +1,163 @@
+package monica
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	lop "github.com/samber/lo/parallel"
+	"github.com/sashabaranov/go-openai"
+
+	"monica-proxy/internal/types"
+	"monica-proxy/internal/utils"
+)
+
+const (
+	textCompletionObject = "text_completion"
+	completionIDLength   = 29
+)
+
+func finishReason(reason string) *string {
+	return &reason
+}
+
+// ProcessMonicaResponseToCompletion 并发读取每个 prompt 的上游响应，组装为 text_completion 非流式响应
+func ProcessMonicaResponseToCompletion(ctx context.Context, req openai.CompletionRequest, prompts []string, chatReqs []openai.ChatCompletionRequest, bodies []io.Reader) (types.CompletionResponse, error) {
+	type result struct {
+		text  string
+		usage openai.Usage
+		err   error
+	}
+	results := lop.Map(bodies, func(body io.Reader, i int) result {
+		_, content, err := CollectMonicaResponse(ctx, body)
+		if err != nil {
+			return result{err: err}
+		}
+		text, _, _ := truncateAtStop(content, req.Stop)
+		res := result{text: text, usage: utils.CalculateUsage(chatReqs[i], text)}
+		if req.Echo {
+			res.text = prompts[i] + text
+		}
+		return res
+	})
+
+	resp := types.CompletionResponse{
+		ID:      "cmpl-" + utils.RandStringUsingMathRand(completionIDLength),
+		Object:  textCompletionObject,
+		Created: time.Now().Unix(),
+		Model:   req.Model,
+		Usage:   &openai.Usage{},
+	}
+	for i, res := range results {
+		if res.err != nil {
+			return types.CompletionResponse{}, res.err
+		}
+		resp.Choices = append(resp.Choices, types.CompletionChoice{
+			Text:         res.text,
+			Index:        i,
+			FinishReason: finishReason("stop"),
+		})
+		resp.Usage.PromptTokens += res.usage.PromptTokens
+		resp.Usage.CompletionTokens += res.usage.CompletionTokens
+		resp.Usage.TotalTokens += res.usage.TotalTokens
+	}
+	return resp, nil
+}
+
+// StreamMonicaSSEToCompletion 并发读取每个 prompt 的上游响应，以 text_completion chunk 流式下发，choice 之间按 index 交错输出
+func StreamMonicaSSEToCompletion(ctx context.Context, req openai.CompletionRequest, prompts []string, chatReqs []openai.ChatCompletionRequest, w io.Writer, bodies []io.Reader) error {
+	writer := bufio.NewWriterSize(w, initialBufferSize)
+	id := "cmpl-" + utils.RandStringUsingMathRand(completionIDLength)
+	now := time.Now().Unix()
+
+	var mu sync.Mutex
+	send := func(chunk types.CompletionResponse) error {
+		mu.Lock()
+		defer mu.Unlock()
+		return sendMessage(writer, w, chunk, true)
+	}
+	newChunk := func(index int, text string, reason *string) types.CompletionResponse {
+		return types.CompletionResponse{
+			ID:      id,
+			Object:  textCompletionObject,
+			Created: now,
+			Model:   req.Model,
+			Choices: []types.CompletionChoice{{Text: text, Index: index, FinishReason: reason}},
+		}
+	}
+
+	usages := make([]openai.Usage, len(bodies))
+	errs := make([]error, len(bodies))
+	var wg sync.WaitGroup
+	for i, body := range bodies {
+		wg.Add(1)
+		go func(i int, body io.Reader) {
+			defer wg.Done()
+			if req.Echo {
+				if errs[i] = send(newChunk(i, prompts[i], nil)); errs[i] != nil {
+					return
+				}
+			}
+
+			var output strings.Builder
+			stops := newStopMatcher(req.Stop)
+			stopHit := false
+			errs[i] = ReadMonicaSSE(ctx, body, func(sseData SSEData) error {
+				_, content := splitSSEData(sseData)
+				emit, _, hit := stops.feed(content)
+				output.WriteString(emit)
+				if emit != "" {
+					if err := send(newChunk(i, emit, nil)); err != nil {
+						return err
+					}
+				}
+				if hit {
+					stopHit = true
+					return errStopReading
+				}
+				return nil
+			}, func() error {
+				mu.Lock()
+				defer mu.Unlock()
+				return sendHeartbeat(writer, w)
+			})
+			if errs[i] != nil {
+				return
+			}
+
+			rest := ""
+			if !stopHit {
+				rest = stops.flush()
+				output.WriteString(rest)
+			}
+			usages[i] = utils.CalculateUsage(chatReqs[i], output.String())
+			errs[i] = send(newChunk(i, rest, finishReason("stop")))
+		}(i, body)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	if req.StreamOptions != nil && req.StreamOptions.IncludeUsage {
+		usage := openai.Usage{}
+		for _, u := range usages {
+			usage.PromptTokens += u.PromptTokens
+			usage.CompletionTokens += u.CompletionTokens
+			usage.TotalTokens += u.TotalTokens
+		}
+		chunk := newChunk(0, "", nil)
+		chunk.Choices = []types.CompletionChoice{}
+		chunk.Usage = &usage
+		if err := sendMessage(writer, w, chunk, false); err != nil {
+			return err
+		}
+	}
+	return sendFinishSignal(writer, w)
+}
@@ -0,0 +1,138 @@
+package monica
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/bytedance/sonic"
+	"github.com/sashabaranov/go-openai"
+
+	"monica-proxy/internal/types"
+	"monica-proxy/internal/utils"
+)
+
+const geminiFinishStop = "STOP"
+
+func newGeminiUsage(chatReq openai.ChatCompletionRequest, thoughts, text string) *types.GeminiUsageMetadata {
+	usage := utils.CalculateUsage(chatReq, thoughts+text)
+	return &types.GeminiUsageMetadata{
+		PromptTokenCount:     usage.PromptTokens,
+		CandidatesTokenCount: usage.CompletionTokens,
+		ThoughtsTokenCount:   utils.CalculateTokens(thoughts),
+		TotalTokenCount:      usage.TotalTokens,
+	}
+}
+
+func newGeminiResponse(model string, parts []types.GeminiPart, finishReason string) types.GeminiResponse {
+	if parts == nil {
+		parts = []types.GeminiPart{}
+	}
+	return types.GeminiResponse{
+		Candidates: []types.GeminiCandidate{{
+			Content:      types.GeminiContent{Role: "model", Parts: parts},
+			FinishReason: finishReason,
+		}},
+		ModelVersion: model,
+	}
+}
+
+// ProcessMonicaResponseToGemini 读取完整的上游响应并组装为 Gemini generateContent 响应
+func ProcessMonicaResponseToGemini(ctx context.Context, model string, req types.GeminiRequest, chatReq openai.ChatCompletionRequest, r io.Reader) (types.GeminiResponse, error) {
+	thoughts, content, err := CollectMonicaResponse(ctx, r)
+	if err != nil {
+		return types.GeminiResponse{}, err
+	}
+	text, _, _ := truncateAtStop(content, chatReq.Stop)
+
+	var parts []types.GeminiPart
+	if thoughts != "" && req.IncludeThoughts() {
+		parts = append(parts, types.GeminiPart{Text: thoughts, Thought: true})
+	}
+	parts = append(parts, types.GeminiPart{Text: text})
+
+	resp := newGeminiResponse(model, parts, geminiFinishStop)
+	resp.UsageMetadata = newGeminiUsage(chatReq, thoughts, text)
+	return resp, nil
+}
+
+// StreamMonicaSSEToGemini 将 Monica 上游 SSE 转换为 streamGenerateContent 流式响应。
+// sse 为 true 时按 alt=sse 输出 data: 行，否则输出逐步写入的 JSON 数组
+func StreamMonicaSSEToGemini(ctx context.Context, model string, req types.GeminiRequest, chatReq openai.ChatCompletionRequest, w io.Writer, r io.Reader, sse bool) error {
+	writer := bufio.NewWriterSize(w, initialBufferSize)
+	includeThoughts := req.IncludeThoughts()
+
+	chunks := 0
+	send := func(chunk types.GeminiResponse) error {
+		if sse {
+			return sendMessage(writer, w, chunk, true)
+		}
+		line, err := sonic.MarshalString(chunk)
+		if err != nil {
+			return fmt.Errorf("marshal error: %w", err)
+		}
+		sep := ",\n"
+		if chunks == 0 {
+			sep = "["
+		}
+		chunks++
+		if _, err := writer.WriteString(sep + line); err != nil {
+			return fmt.Errorf("write error: %w", err)
+		}
+		return flushWriter(writer, w)
+	}
+
+	var thoughts, output strings.Builder
+	stops := newStopMatcher(chatReq.Stop)
+	stopHit := false
+	err := ReadMonicaSSE(ctx, r, func(sseData SSEData) error {
+		reasoning, content := splitSSEData(sseData)
+		thoughts.WriteString(reasoning)
+		if reasoning != "" && includeThoughts {
+			if err := send(newGeminiResponse(model, []types.GeminiPart{{Text: reasoning, Thought: true}}, "")); err != nil {
+				return err
+			}
+		}
+
+		emit, _, hit := stops.feed(content)
+		output.WriteString(emit)
+		if emit != "" {
+			if err := send(newGeminiResponse(model, []types.GeminiPart{{Text: emit}}, "")); err != nil {
+				return err
+			}
+		}
+		if hit {
+			stopHit = true
+			return errStopReading
+		}
+		return nil
+	}, func() error {
+		if !sse {
+			return nil
+		}
+		return sendHeartbeat(writer, w)
+	})
+	if err != nil {
+		return err
+	}
+
+	rest := ""
+	if !stopHit {
+		rest = stops.flush()
+		output.WriteString(rest)
+	}
+	final := newGeminiResponse(model, []types.GeminiPart{{Text: rest}}, geminiFinishStop)
+	final.UsageMetadata = newGeminiUsage(chatReq, thoughts.String(), output.String())
+	if err := send(final); err != nil {
+		return err
+	}
+	if !sse {
+		if _, err := writer.WriteString("]"); err != nil {
+			return fmt.Errorf("write error: %w", err)
+		}
+		return flushWriter(writer, w)
+	}
+	return nil
+}
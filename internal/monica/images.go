@@ -0,0 +1,20 @@
+package monica
+
+import (
+	"context"
+	"io"
+	"strings"
+)
+
+// CollectMonicaImages 读取绘图模型的上游响应，收集全部 draw_img_result 图片地址与文本部分
+func CollectMonicaImages(ctx context.Context, r io.Reader) (urls []string, text string, err error) {
+	var textBuilder strings.Builder
+	err = ReadMonicaSSE(ctx, r, func(sseData SSEData) error {
+		if sseData.AgentStatus.Type == "draw_img_result" && sseData.AgentStatus.Metadata.ImageURL != "" {
+			urls = append(urls, sseData.AgentStatus.Metadata.ImageURL)
+		}
+		textBuilder.WriteString(sseData.Text)
+		return nil
+	}, nil)
+	return urls, strings.TrimSpace(textBuilder.String()), err
+}
@@ -0,0 +1,59 @@
+package monica
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/bytedance/sonic"
+
+	"monica-proxy/internal/utils"
+)
+
+// CompletionMeter 旁路解析上游 SSE，累计模型输出的思考内容与正文，
+// 用于按实际输出的 token 结算速率限制与用量
+type CompletionMeter struct {
+	pending []byte
+	text    strings.Builder
+}
+
+// Write 接收上游 SSE 的原始字节，按行解析 data: 消息，解析失败的行直接忽略
+func (m *CompletionMeter) Write(p []byte) (int, error) {
+	m.pending = append(m.pending, p...)
+	for {
+		i := bytes.IndexByte(m.pending, '\n')
+		if i < 0 {
+			break
+		}
+		m.consume(m.pending[:i])
+		m.pending = m.pending[i+1:]
+	}
+	return len(p), nil
+}
+
+func (m *CompletionMeter) consume(line []byte) {
+	data, ok := bytes.CutPrefix(bytes.TrimSpace(line), []byte("data:"))
+	if !ok {
+		return
+	}
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || string(data) == sseFinish {
+		return
+	}
+	var sseData SSEData
+	if err := sonic.Unmarshal(data, &sseData); err != nil {
+		return
+	}
+	reasoning, content := splitSSEData(sseData)
+	m.text.WriteString(reasoning)
+	m.text.WriteString(content)
+}
+
+// Text 返回目前累计的输出文本
+func (m *CompletionMeter) Text() string {
+	return m.text.String()
+}
+
+// Tokens 返回目前累计的输出 token 数
+func (m *CompletionMeter) Tokens() int {
+	return utils.CalculateTokens(m.text.String())
+}
@@ -0,0 +1,119 @@
+package monica
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/sashabaranov/go-openai"
+
+	"monica-proxy/internal/types"
+	"monica-proxy/internal/utils"
+)
+
+// ollamaLine 构造一行 Ollama 响应，chat 为 true 时为 /api/chat 格式，否则为 /api/generate 格式
+func ollamaLine(model string, chat bool, content, thinking string, done types.OllamaDone) any {
+	createdAt := time.Now().UTC().Format(time.RFC3339Nano)
+	if chat {
+		return types.OllamaChatResponse{
+			Model:     model,
+			CreatedAt: createdAt,
+			Message: types.OllamaMessage{
+				Role:     openai.ChatMessageRoleAssistant,
+				Content:  content,
+				Thinking: thinking,
+			},
+			OllamaDone: done,
+		}
+	}
+	return types.OllamaGenerateResponse{
+		Model:      model,
+		CreatedAt:  createdAt,
+		Response:   content,
+		Thinking:   thinking,
+		OllamaDone: done,
+	}
+}
+
+// ollamaDone 根据完整输出计算结束行的统计字段
+func ollamaDone(chatReq openai.ChatCompletionRequest, output string, start time.Time) types.OllamaDone {
+	usage := utils.CalculateUsage(chatReq, output)
+	elapsed := time.Since(start).Nanoseconds()
+	return types.OllamaDone{
+		Done:            true,
+		DoneReason:      "stop",
+		TotalDuration:   elapsed,
+		PromptEvalCount: usage.PromptTokens,
+		EvalCount:       usage.CompletionTokens,
+		EvalDuration:    elapsed,
+	}
+}
+
+// sendNDJSON 写入一行 NDJSON 并立即 flush
+func sendNDJSON(writer *bufio.Writer, w io.Writer, data any) error {
+	line, err := sonic.MarshalString(data)
+	if err != nil {
+		return fmt.Errorf("marshal error: %w", err)
+	}
+	if _, err := writer.WriteString(line + "\n"); err != nil {
+		return fmt.Errorf("write error: %w", err)
+	}
+	return flushWriter(writer, w)
+}
+
+// ProcessMonicaResponseToOllama 读取完整的上游响应并组装为单个 Ollama 响应对象
+func ProcessMonicaResponseToOllama(ctx context.Context, model string, chat, think bool, chatReq openai.ChatCompletionRequest, r io.Reader) (any, error) {
+	start := time.Now()
+	thinking, content, err := CollectMonicaResponse(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	text, _, _ := truncateAtStop(content, chatReq.Stop)
+	if !think {
+		thinking = ""
+	}
+	return ollamaLine(model, chat, text, thinking, ollamaDone(chatReq, thinking+text, start)), nil
+}
+
+// StreamMonicaSSEToOllama 将 Monica 上游 SSE 转换为 Ollama 的 NDJSON 流
+func StreamMonicaSSEToOllama(ctx context.Context, model string, chat, think bool, chatReq openai.ChatCompletionRequest, w io.Writer, r io.Reader) error {
+	start := time.Now()
+	writer := bufio.NewWriterSize(w, initialBufferSize)
+
+	var output strings.Builder
+	stops := newStopMatcher(chatReq.Stop)
+	stopHit := false
+	err := ReadMonicaSSE(ctx, r, func(sseData SSEData) error {
+		thinking, content := splitSSEData(sseData)
+		if !think {
+			thinking = ""
+		}
+		emit, _, hit := stops.feed(content)
+		output.WriteString(thinking)
+		output.WriteString(emit)
+		if emit != "" || thinking != "" {
+			if err := sendNDJSON(writer, w, ollamaLine(model, chat, emit, thinking, types.OllamaDone{})); err != nil {
+				return err
+			}
+		}
+		if hit {
+			stopHit = true
+			return errStopReading
+		}
+		return nil
+	}, nil)
+	if err != nil {
+		return err
+	}
+
+	rest := ""
+	if !stopHit {
+		rest = stops.flush()
+		output.WriteString(rest)
+	}
+	return sendNDJSON(writer, w, ollamaLine(model, chat, rest, "", ollamaDone(chatReq, output.String(), start)))
+}
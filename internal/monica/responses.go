@@ -0,0 +1,306 @@
+package monica
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+
+	"monica-proxy/internal/types"
+	"monica-proxy/internal/utils"
+)
+
+const (
+	responsesObject       = "response"
+	responsesIDLength     = 24
+	responsesStatusDone   = "completed"
+	responsesStatusActive = "in_progress"
+)
+
+// newResponsesResponse 根据请求创建响应对象骨架
+func newResponsesResponse(req types.ResponsesRequest, status string) types.ResponsesResponse {
+	resp := types.ResponsesResponse{
+		ID:                "resp_" + utils.RandStringSecure(responsesIDLength),
+		Object:            responsesObject,
+		CreatedAt:         time.Now().Unix(),
+		Status:            status,
+		Model:             req.Model,
+		Output:            []any{},
+		ParallelToolCalls: true,
+		Reasoning:         req.Reasoning,
+		Store:             req.Store == nil || *req.Store,
+		Temperature:       req.Temperature,
+		TopP:              req.TopP,
+		ToolChoice:        "auto",
+		Tools:             []any{},
+		User:              req.User,
+		Metadata:          req.Metadata,
+	}
+	if resp.Metadata == nil {
+		resp.Metadata = map[string]string{}
+	}
+	if req.Instructions != "" {
+		resp.Instructions = &req.Instructions
+	}
+	if req.MaxOutputTokens > 0 {
+		resp.MaxOutputTokens = &req.MaxOutputTokens
+	}
+	if req.PreviousResponseID != "" {
+		resp.PreviousResponseID = &req.PreviousResponseID
+	}
+	return resp
+}
+
+func newResponsesUsage(chatReq openai.ChatCompletionRequest, reasoning, text string) *types.ResponsesUsage {
+	usage := utils.CalculateUsage(chatReq, reasoning+text)
+	return &types.ResponsesUsage{
+		InputTokens:  usage.PromptTokens,
+		OutputTokens: usage.CompletionTokens,
+		OutputTokensDetails: types.ResponsesOutputTokensDetails{
+			ReasoningTokens: utils.CalculateTokens(reasoning),
+		},
+		TotalTokens: usage.TotalTokens,
+	}
+}
+
+func newReasoningItem(text string) types.ResponsesReasoningItem {
+	item := types.ResponsesReasoningItem{
+		ID:      "rs_" + utils.RandStringUsingMathRand(responsesIDLength),
+		Type:    "reasoning",
+		Summary: []types.ResponsesSummaryText{},
+	}
+	if text != "" {
+		item.Summary = append(item.Summary, types.ResponsesSummaryText{Type: "summary_text", Text: text})
+	}
+	return item
+}
+
+func newMessageItem(status string) types.ResponsesMessageItem {
+	return types.ResponsesMessageItem{
+		ID:      "msg_" + utils.RandStringUsingMathRand(responsesIDLength),
+		Type:    "message",
+		Status:  status,
+		Role:    openai.ChatMessageRoleAssistant,
+		Content: []types.ResponsesOutputText{},
+	}
+}
+
+func newOutputText(text string) types.ResponsesOutputText {
+	return types.ResponsesOutputText{Type: "output_text", Text: text, Annotations: []any{}}
+}
+
+// ProcessMonicaResponseToResponses 读取完整的上游响应并组装为 Responses API 非流式响应，同时返回输出文本
+func ProcessMonicaResponseToResponses(ctx context.Context, req types.ResponsesRequest, chatReq openai.ChatCompletionRequest, r io.Reader) (types.ResponsesResponse, string, error) {
+	reasoning, text, err := CollectMonicaResponse(ctx, r)
+	if err != nil {
+		return types.ResponsesResponse{}, "", err
+	}
+
+	resp := newResponsesResponse(req, responsesStatusDone)
+	if reasoning != "" {
+		resp.Output = append(resp.Output, newReasoningItem(reasoning))
+	}
+	message := newMessageItem(responsesStatusDone)
+	message.Content = append(message.Content, newOutputText(text))
+	resp.Output = append(resp.Output, message)
+	resp.Usage = newResponsesUsage(chatReq, reasoning, text)
+	return resp, text, nil
+}
+
+// responsesStreamWriter 维护 Responses API 流式输出的输出项状态
+type responsesStreamWriter struct {
+	writer   *bufio.Writer
+	w        io.Writer
+	seq      int
+	resp     types.ResponsesResponse
+	itemType string // 当前打开的输出项类型，为空表示没有打开的项
+	itemID   string
+	current  strings.Builder
+	// 全部推理与正文内容，用于计算用量
+	reasoning strings.Builder
+	text      strings.Builder
+}
+
+func (s *responsesStreamWriter) send(event string, data any) error {
+	return sendEvent(s.writer, s.w, event, data)
+}
+
+func (s *responsesStreamWriter) nextSeq() int {
+	seq := s.seq
+	s.seq++
+	return seq
+}
+
+func (s *responsesStreamWriter) sendResponse(event string) error {
+	return s.send(event, types.ResponsesResponseEvent{Type: event, SequenceNumber: s.nextSeq(), Response: s.resp})
+}
+
+// openItem 确保当前打开的输出项为指定类型，类型切换时先关闭旧项
+func (s *responsesStreamWriter) openItem(itemType string) error {
+	if s.itemType == itemType {
+		return nil
+	}
+	if err := s.closeItem(); err != nil {
+		return err
+	}
+
+	outputIndex := len(s.resp.Output)
+	s.itemType = itemType
+	s.current.Reset()
+	if itemType == "reasoning" {
+		item := newReasoningItem("")
+		s.itemID = item.ID
+		if err := s.send("response.output_item.added", types.ResponsesOutputItemEvent{
+			Type: "response.output_item.added", SequenceNumber: s.nextSeq(), OutputIndex: outputIndex, Item: item,
+		}); err != nil {
+			return err
+		}
+		return s.send("response.reasoning_summary_part.added", types.ResponsesSummaryPartEvent{
+			Type: "response.reasoning_summary_part.added", SequenceNumber: s.nextSeq(), ItemID: s.itemID,
+			OutputIndex: outputIndex, Part: types.ResponsesSummaryText{Type: "summary_text"},
+		})
+	}
+
+	item := newMessageItem(responsesStatusActive)
+	s.itemID = item.ID
+	if err := s.send("response.output_item.added", types.ResponsesOutputItemEvent{
+		Type: "response.output_item.added", SequenceNumber: s.nextSeq(), OutputIndex: outputIndex, Item: item,
+	}); err != nil {
+		return err
+	}
+	return s.send("response.content_part.added", types.ResponsesContentPartEvent{
+		Type: "response.content_part.added", SequenceNumber: s.nextSeq(), ItemID: s.itemID,
+		OutputIndex: outputIndex, Part: newOutputText(""),
+	})
+}
+
+// closeItem 发送当前输出项的 done 系列事件，并将其写入最终响应
+func (s *responsesStreamWriter) closeItem() error {
+	if s.itemType == "" {
+		return nil
+	}
+	outputIndex := len(s.resp.Output)
+	text := s.current.String()
+
+	var item any
+	if s.itemType == "reasoning" {
+		if err := s.send("response.reasoning_summary_text.done", types.ResponsesSummaryTextEvent{
+			Type: "response.reasoning_summary_text.done", SequenceNumber: s.nextSeq(), ItemID: s.itemID,
+			OutputIndex: outputIndex, Text: text,
+		}); err != nil {
+			return err
+		}
+		part := types.ResponsesSummaryText{Type: "summary_text", Text: text}
+		if err := s.send("response.reasoning_summary_part.done", types.ResponsesSummaryPartEvent{
+			Type: "response.reasoning_summary_part.done", SequenceNumber: s.nextSeq(), ItemID: s.itemID,
+			OutputIndex: outputIndex, Part: part,
+		}); err != nil {
+			return err
+		}
+		reasoningItem := newReasoningItem(text)
+		reasoningItem.ID = s.itemID
+		item = reasoningItem
+	} else {
+		if err := s.send("response.output_text.done", types.ResponsesTextEvent{
+			Type: "response.output_text.done", SequenceNumber: s.nextSeq(), ItemID: s.itemID,
+			OutputIndex: outputIndex, Text: text,
+		}); err != nil {
+			return err
+		}
+		if err := s.send("response.content_part.done", types.ResponsesContentPartEvent{
+			Type: "response.content_part.done", SequenceNumber: s.nextSeq(), ItemID: s.itemID,
+			OutputIndex: outputIndex, Part: newOutputText(text),
+		}); err != nil {
+			return err
+		}
+		messageItem := newMessageItem(responsesStatusDone)
+		messageItem.ID = s.itemID
+		messageItem.Content = append(messageItem.Content, newOutputText(text))
+		item = messageItem
+	}
+
+	s.resp.Output = append(s.resp.Output, item)
+	s.itemType = ""
+	return s.send("response.output_item.done", types.ResponsesOutputItemEvent{
+		Type: "response.output_item.done", SequenceNumber: s.nextSeq(), OutputIndex: outputIndex, Item: item,
+	})
+}
+
+func (s *responsesStreamWriter) reasoningDelta(delta string) error {
+	if delta == "" {
+		return nil
+	}
+	if err := s.openItem("reasoning"); err != nil {
+		return err
+	}
+	s.current.WriteString(delta)
+	s.reasoning.WriteString(delta)
+	return s.send("response.reasoning_summary_text.delta", types.ResponsesSummaryTextEvent{
+		Type: "response.reasoning_summary_text.delta", SequenceNumber: s.nextSeq(), ItemID: s.itemID,
+		OutputIndex: len(s.resp.Output), Delta: delta,
+	})
+}
+
+func (s *responsesStreamWriter) textDelta(delta string) error {
+	if delta == "" {
+		return nil
+	}
+	if err := s.openItem("message"); err != nil {
+		return err
+	}
+	s.current.WriteString(delta)
+	s.text.WriteString(delta)
+	return s.send("response.output_text.delta", types.ResponsesTextEvent{
+		Type: "response.output_text.delta", SequenceNumber: s.nextSeq(), ItemID: s.itemID,
+		OutputIndex: len(s.resp.Output), Delta: delta,
+	})
+}
+
+// StreamMonicaSSEToResponses 将 Monica 上游 SSE 转换为 Responses API 流式事件，返回最终响应与输出文本
+func StreamMonicaSSEToResponses(ctx context.Context, req types.ResponsesRequest, chatReq openai.ChatCompletionRequest, w io.Writer, r io.Reader) (types.ResponsesResponse, string, error) {
+	s := &responsesStreamWriter{
+		writer: bufio.NewWriterSize(w, initialBufferSize),
+		w:      w,
+		resp:   newResponsesResponse(req, responsesStatusActive),
+	}
+
+	if err := s.sendResponse("response.created"); err != nil {
+		return s.resp, "", err
+	}
+	if err := s.sendResponse("response.in_progress"); err != nil {
+		return s.resp, "", err
+	}
+
+	err := ReadMonicaSSE(ctx, r, func(sseData SSEData) error {
+		reasoning, content := splitSSEData(sseData)
+		if err := s.reasoningDelta(reasoning); err != nil {
+			return err
+		}
+		return s.textDelta(content)
+	}, func() error {
+		return sendHeartbeat(s.writer, s.w)
+	})
+	if err != nil {
+		return s.resp, "", err
+	}
+
+	// 保证至少有一个消息输出项
+	if s.text.Len() == 0 {
+		if err := s.openItem("message"); err != nil {
+			return s.resp, "", err
+		}
+	}
+	if err := s.closeItem(); err != nil {
+		return s.resp, "", err
+	}
+
+	s.resp.Status = responsesStatusDone
+	s.resp.Usage = newResponsesUsage(chatReq, s.reasoning.String(), s.text.String())
+	if err := s.sendResponse("response.completed"); err != nil {
+		return s.resp, "", err
+	}
+	return s.resp, s.text.String(), nil
+}
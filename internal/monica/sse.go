@@ -3,6 +3,7 @@ package monica
 import (
 	"bufio"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -340,6 +341,112 @@ func StreamMonicaSSEToClient(ctx context.Context, req openai.ChatCompletionReque
 	}
 }
 
+// ReadMonicaSSE 读取 Monica 上游 SSE 流并逐条回调解析后的数据，供各类下游协议复用。
+// 收到 Finished 消息或 EOF 时返回；onIdle 不为空时按心跳间隔调用，用于向客户端保活。
+func ReadMonicaSSE(ctx context.Context, r io.Reader, onData func(SSEData) error, onIdle func() error) error {
+	reader := bufio.NewReaderSize(r, initialBufferSize)
+
+	type readResult struct {
+		line string
+		err  error
+	}
+	lineChan := make(chan readResult, 1)
+	go func() {
+		defer close(lineChan)
+		for {
+			line, err := reader.ReadString('\n')
+			select {
+			case lineChan <- readResult{line: line, err: err}:
+			case <-ctx.Done():
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-heartbeat.C:
+			if onIdle != nil {
+				if err := onIdle(); err != nil {
+					log.Printf("Heartbeat error: %v", err)
+				}
+			}
+		case result, ok := <-lineChan:
+			if !ok {
+				return ctx.Err()
+			}
+			line, err := result.line, result.err
+			if err != nil && err != io.EOF {
+				return fmt.Errorf("read error: %w", err)
+			}
+
+			if strings.HasPrefix(line, "data: ") {
+				jsonStr := strings.TrimSpace(strings.TrimPrefix(line, "data: "))
+				if jsonStr != "" && jsonStr != sseFinish {
+					var sseData SSEData
+					if err := sonic.UnmarshalString(jsonStr, &sseData); err != nil {
+						log.Printf("Error unmarshaling SSE data: %v", err)
+					} else {
+						if err := onData(sseData); err != nil {
+							if err == errStopReading {
+								return nil
+							}
+							return err
+						}
+						if sseData.Finished {
+							return nil
+						}
+					}
+				}
+			}
+
+			if err == io.EOF {
+				return nil
+			}
+		}
+	}
+}
+
+// CollectMonicaResponse 读取完整的上游响应，分别返回思考内容与正文内容
+func CollectMonicaResponse(ctx context.Context, r io.Reader) (reasoning, content string, err error) {
+	return CollectMonicaResponseWithIdle(ctx, r, nil)
+}
+
+// CollectMonicaResponseWithIdle 与 CollectMonicaResponse 相同，读取期间按心跳间隔调用 onIdle
+func CollectMonicaResponseWithIdle(ctx context.Context, r io.Reader, onIdle func() error) (reasoning, content string, err error) {
+	var reasoningBuilder, contentBuilder strings.Builder
+	err = ReadMonicaSSE(ctx, r, func(sseData SSEData) error {
+		thinking, text := splitSSEData(sseData)
+		reasoningBuilder.WriteString(thinking)
+		contentBuilder.WriteString(text)
+		return nil
+	}, onIdle)
+	return reasoningBuilder.String(), contentBuilder.String(), err
+}
+
+// errStopReading 由 ReadMonicaSSE 的回调返回，表示提前结束读取（如命中停止序列）
+var errStopReading = errors.New("stop reading")
+
+// splitSSEData 将一条上游消息拆分为思考内容与正文内容，分支与 processMessage 保持一致
+func splitSSEData(sseData SSEData) (reasoning, content string) {
+	switch {
+	case sseData.AgentStatus.Type == "thinking_detail_stream":
+		return sseData.AgentStatus.Metadata.ReasoningDetail, sseData.Text
+	case sseData.AgentStatus.Type == "draw_img_result" && sseData.AgentStatus.Metadata.ImageURL != "":
+		return "", "\n![image](" + sseData.AgentStatus.Metadata.ImageURL + ")\n" + sseData.Text
+	default:
+		return "", sseData.Text
+	}
+}
+
 func retryProcessMessage(writer *bufio.Writer, w io.Writer, sseData SSEData, chatId, fingerprint string, now int64, thinkFlag *bool, metrics *Metrics, completionBuilder *strings.Builder, req openai.ChatCompletionRequest, doFlush bool) error {
 	for retry := 0; retry < maxRetries; retry++ {
 		if err := processMessage(writer, w, sseData, chatId, fingerprint, now, thinkFlag, metrics, completionBuilder, req, doFlush); err != nil {
@@ -450,7 +557,7 @@ func createThinkMessage(chatId string, now int64, req openai.ChatCompletionReque
 	}
 }
 
-func sendMessage(writer *bufio.Writer, w io.Writer, sseMsg openai.ChatCompletionStreamResponse, doFlush bool) error {
+func sendMessage(writer *bufio.Writer, w io.Writer, sseMsg any, doFlush bool) error {
 	sendLine, err := sonic.MarshalString(sseMsg)
 	if err != nil {
 		return fmt.Errorf("marshal error: %w", err)
@@ -467,6 +574,19 @@ func sendMessage(writer *bufio.Writer, w io.Writer, sseMsg openai.ChatCompletion
 	return nil
 }
 
+// sendEvent 发送带事件名的 SSE 消息（Anthropic、Responses 等协议使用）
+func sendEvent(writer *bufio.Writer, w io.Writer, event string, data any) error {
+	sendLine, err := sonic.MarshalString(data)
+	if err != nil {
+		return fmt.Errorf("marshal error: %w", err)
+	}
+
+	if _, err := writer.WriteString(fmt.Sprintf("event: %s\ndata: %s\n\n", event, sendLine)); err != nil {
+		return fmt.Errorf("write error: %w", err)
+	}
+	return flushWriter(writer, w)
+}
+
 func sendHeartbeat(writer *bufio.Writer, w io.Writer) error {
 	if _, err := writer.WriteString(": keepalive\n\n"); err != nil {
 		return fmt.Errorf("heartbeat write error: %w", err)
@@ -0,0 +1,78 @@
+package monica
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// stopMatcher 在代理侧实现停止序列：Monica 不支持 stop 参数，只能在输出中截断。
+// 流式场景下会暂存可能构成停止序列前缀的尾部文本，避免把停止序列的一部分发给客户端。
+type stopMatcher struct {
+	stops   []string
+	maxLen  int
+	pending string
+}
+
+func newStopMatcher(stops []string) *stopMatcher {
+	m := &stopMatcher{}
+	for _, s := range stops {
+		if s == "" {
+			continue
+		}
+		m.stops = append(m.stops, s)
+		if len(s) > m.maxLen {
+			m.maxLen = len(s)
+		}
+	}
+	return m
+}
+
+// feed 追加新文本，返回可以安全下发的部分；命中停止序列时 hit 为 true 并返回命中的序列
+func (m *stopMatcher) feed(text string) (emit string, stop string, hit bool) {
+	if len(m.stops) == 0 {
+		return text, "", false
+	}
+	m.pending += text
+
+	earliest := -1
+	for _, s := range m.stops {
+		if i := strings.Index(m.pending, s); i >= 0 && (earliest < 0 || i < earliest) {
+			earliest, stop = i, s
+		}
+	}
+	if earliest >= 0 {
+		// 停止序列之后的文本保留在 pending 中，需要时可以通过 flush 取出
+		emit = m.pending[:earliest]
+		m.pending = m.pending[earliest+len(stop):]
+		return emit, stop, true
+	}
+
+	// 保留 maxLen-1 字节，且不截断 UTF-8 字符
+	cut := len(m.pending) - (m.maxLen - 1)
+	if cut <= 0 {
+		return "", "", false
+	}
+	for cut > 0 && cut < len(m.pending) && !utf8.RuneStart(m.pending[cut]) {
+		cut--
+	}
+	emit = m.pending[:cut]
+	m.pending = m.pending[cut:]
+	return emit, "", false
+}
+
+// flush 返回暂存的剩余文本
+func (m *stopMatcher) flush() string {
+	rest := m.pending
+	m.pending = ""
+	return rest
+}
+
+// truncateAtStop 非流式场景下在最早出现的停止序列处截断文本
+func truncateAtStop(text string, stops []string) (string, string, bool) {
+	m := newStopMatcher(stops)
+	emit, stop, hit := m.feed(text)
+	if hit {
+		return emit, stop, true
+	}
+	return emit + m.flush(), "", false
+}
@@ -0,0 +1,182 @@
+package monica
+
+import (
+	"encoding/json"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/sashabaranov/go-openai"
+
+	"monica-proxy/internal/types"
+	"monica-proxy/internal/utils"
+)
+
+const (
+	toolCallIDLength       = 24
+	toolArgumentsChunkSize = 64 // 流式下发 arguments 时每个 chunk 的字节数
+)
+
+func newToolCallID() string {
+	return "call_" + utils.RandStringUsingMathRand(toolCallIDLength)
+}
+
+// ApplyToolCalls 解析非流式响应中的工具调用，命中时改写为 tool_calls 并将 finish_reason 设为 tool_calls
+func ApplyToolCalls(resp *openai.ChatCompletionResponse, tools *types.ToolEmulation) {
+	for i := range resp.Choices {
+		msg := &resp.Choices[i].Message
+
+		// 思考内容保持原样，只解析正文部分
+		think, text := "", msg.Content
+		if idx := strings.LastIndex(text, "</think>"); idx >= 0 {
+			think, text = text[:idx+len("</think>")], text[idx+len("</think>"):]
+		}
+		text, calls := tools.ParseToolCalls(text)
+		if len(calls) == 0 {
+			continue
+		}
+
+		msg.Content = think + text
+		for _, call := range calls {
+			msg.ToolCalls = append(msg.ToolCalls, call.ToOpenAI(newToolCallID()))
+		}
+		resp.Choices[i].FinishReason = openai.FinishReasonToolCalls
+	}
+}
+
+// toolStreamParser 流式解析模型输出中的工具调用块：
+// 标记之前的文本作为正文下发，标记之后按 JSON 对象逐个解析，每解析出一个调用立即下发
+type toolStreamParser struct {
+	tools   *types.ToolEmulation
+	marker  *stopMatcher
+	inCalls bool
+	done    bool
+	buf     string // 标记之后尚未解析完的文本
+	raw     strings.Builder
+	emitted int
+
+	// JSON 扫描状态
+	scanned  int
+	depth    int
+	objDepth int // 调用对象所在的层级：数组写法为 1，单个对象写法为 0
+	objStart int
+	inString bool
+	escaped  bool
+	started  bool
+}
+
+func newToolStreamParser(tools *types.ToolEmulation) *toolStreamParser {
+	return &toolStreamParser{
+		tools:    tools,
+		marker:   newStopMatcher([]string{types.ToolCallsOpenTag}),
+		objStart: -1,
+	}
+}
+
+// feed 追加模型输出，返回可以作为正文下发的文本与新解析出的工具调用
+func (p *toolStreamParser) feed(text string) (string, []types.EmulatedToolCall) {
+	if p.done {
+		return "", nil
+	}
+	if !p.inCalls {
+		emit, _, hit := p.marker.feed(text)
+		if !hit {
+			return emit, nil
+		}
+		p.inCalls = true
+		text = p.marker.flush()
+		return emit, p.scan(text)
+	}
+	return "", p.scan(text)
+}
+
+// finish 结束解析，返回暂存的正文；工具调用块无法解析时原样作为正文返回
+func (p *toolStreamParser) finish() string {
+	if !p.inCalls {
+		return p.marker.flush()
+	}
+	if p.emitted == 0 {
+		return types.ToolCallsOpenTag + p.raw.String()
+	}
+	return ""
+}
+
+func (p *toolStreamParser) scan(text string) []types.EmulatedToolCall {
+	p.raw.WriteString(text)
+	p.buf += text
+
+	var calls []types.EmulatedToolCall
+	for ; p.scanned < len(p.buf) && !p.done; p.scanned++ {
+		c := p.buf[p.scanned]
+		if p.inString {
+			switch {
+			case p.escaped:
+				p.escaped = false
+			case c == '\\':
+				p.escaped = true
+			case c == '"':
+				p.inString = false
+			}
+			continue
+		}
+
+		switch c {
+		case '"':
+			p.inString = p.depth > 0
+		case '[', '{':
+			if !p.started {
+				p.started = true
+				if c == '[' {
+					p.objDepth = 1
+				}
+			}
+			if c == '{' && p.depth == p.objDepth {
+				p.objStart = p.scanned
+			}
+			p.depth++
+		case ']', '}':
+			if !p.started {
+				break
+			}
+			p.depth--
+			if c == '}' && p.depth == p.objDepth && p.objStart >= 0 {
+				var call types.EmulatedToolCall
+				if err := json.Unmarshal([]byte(p.buf[p.objStart:p.scanned+1]), &call); err == nil {
+					if filtered := p.tools.Filter([]types.EmulatedToolCall{call}); len(filtered) > 0 && (p.tools.Parallel || p.emitted == 0) {
+						calls = append(calls, filtered[0])
+						p.emitted++
+					}
+				}
+				p.objStart = -1
+			}
+			if p.depth <= 0 {
+				// 数组（或单个对象）结束，忽略之后的内容
+				p.done = true
+			}
+		}
+	}
+
+	// 丢弃已经解析完的部分，避免缓冲区无限增长
+	if p.objStart < 0 {
+		p.buf = p.buf[p.scanned:]
+		p.scanned = 0
+	} else if p.objStart > 0 {
+		p.buf = p.buf[p.objStart:]
+		p.scanned -= p.objStart
+		p.objStart = 0
+	}
+	return calls
+}
+
+// splitArguments 将 arguments 切分为多个片段，用于流式下发，不截断 UTF-8 字符
+func splitArguments(args string) []string {
+	var pieces []string
+	for len(args) > toolArgumentsChunkSize {
+		cut := toolArgumentsChunkSize
+		for cut > 0 && !utf8.RuneStart(args[cut]) {
+			cut--
+		}
+		pieces = append(pieces, args[:cut])
+		args = args[cut:]
+	}
+	return append(pieces, args)
+}
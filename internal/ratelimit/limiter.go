@@ -0,0 +1,280 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Limits 一个 API 密钥的速率限制，0 表示不限制
+type Limits struct {
+	RPM int // 每分钟请求数
+	TPM int // 每分钟 token 数，按提示词 token 准入，按实际输出 token 结算
+}
+
+// Unlimited 返回是否没有任何限制
+func (l Limits) Unlimited() bool {
+	return l.RPM <= 0 && l.TPM <= 0
+}
+
+// Error 超出速率限制，Kind 为 requests 或 tokens
+type Error struct {
+	Kind       string
+	Limit      int
+	Requested  int
+	RetryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("Rate limit reached for %s per minute: limit %d, requested %d. Please try again in %s.",
+		e.Kind, e.Limit, e.Requested, formatReset(e.RetryAfter))
+}
+
+// RetryAfterSeconds 用于 Retry-After header 的秒数，向上取整且至少为 1
+func (e *Error) RetryAfterSeconds() int {
+	seconds := int(math.Ceil(e.RetryAfter.Seconds()))
+	if seconds < 1 {
+		return 1
+	}
+	return seconds
+}
+
+// bucket 令牌桶，容量为每分钟的额度，按容量/分钟的速度连续恢复。结算时允许透支为负数，
+// 之后的请求需要等额度恢复为正
+type bucket struct {
+	capacity float64
+	tokens   float64
+	last     time.Time
+}
+
+func newBucket(capacity int, now time.Time) *bucket {
+	return &bucket{capacity: float64(capacity), tokens: float64(capacity), last: now}
+}
+
+func (b *bucket) refill(now time.Time) {
+	elapsed := now.Sub(b.last).Minutes()
+	if elapsed > 0 {
+		b.tokens = math.Min(b.capacity, b.tokens+elapsed*b.capacity)
+		b.last = now
+	}
+}
+
+// wait 返回额度恢复到 n 需要的时间
+func (b *bucket) wait(n float64) time.Duration {
+	if b.tokens >= n {
+		return 0
+	}
+	return time.Duration((n - b.tokens) / b.capacity * float64(time.Minute))
+}
+
+func (b *bucket) remaining() int {
+	return int(math.Max(0, math.Floor(b.tokens)))
+}
+
+// keyState 一个密钥的请求数与 token 两个令牌桶，未限制的维度为 nil
+type keyState struct {
+	mu       sync.Mutex
+	limits   Limits
+	requests *bucket
+	tokens   *bucket
+	used     time.Time // 最近一次准入、扣除或结算的时间
+}
+
+// idle 返回密钥是否超过 idleTimeout 未使用且令牌桶已经恢复全满，此时删除与保留状态效果相同
+func (s *keyState) idle(now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now.Sub(s.used) < idleTimeout {
+		return false
+	}
+	for _, b := range []*bucket{s.requests, s.tokens} {
+		if b == nil {
+			continue
+		}
+		b.refill(now)
+		if b.tokens < b.capacity {
+			return false
+		}
+	}
+	return true
+}
+
+// idleTimeout 清理空闲密钥状态的间隔与空闲时长，等于令牌桶从空恢复到满的时间
+const idleTimeout = time.Minute
+
+// Limiter 按 API 密钥限流，空闲的密钥状态定期清理
+type Limiter struct {
+	mu    sync.Mutex
+	keys  map[string]*keyState
+	now   func() time.Time
+	swept time.Time
+}
+
+// Default 全局限流器
+var Default = NewLimiter()
+
+// NewLimiter 创建限流器
+func NewLimiter() *Limiter {
+	return &Limiter{keys: make(map[string]*keyState), now: time.Now}
+}
+
+// state 返回密钥的令牌桶，限制变化后重新创建
+func (l *Limiter) state(keyID string, limits Limits) *keyState {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	if now.Sub(l.swept) >= idleTimeout {
+		l.sweepLocked(now)
+	}
+	s, ok := l.keys[keyID]
+	if ok && s.limits == limits {
+		return s
+	}
+	s = &keyState{limits: limits, used: now}
+	if limits.RPM > 0 {
+		s.requests = newBucket(limits.RPM, now)
+	}
+	if limits.TPM > 0 {
+		s.tokens = newBucket(limits.TPM, now)
+	}
+	l.keys[keyID] = s
+	return s
+}
+
+// sweepLocked 删除空闲的密钥状态，避免密钥与 JWT 调用方增多后状态只增不减
+func (l *Limiter) sweepLocked(now time.Time) {
+	for id, s := range l.keys {
+		if s.idle(now) {
+			delete(l.keys, id)
+		}
+	}
+	l.swept = now
+}
+
+// Admit 请求准入：消耗一个请求额度，token 额度已透支时拒绝。没有限制时返回 nil Meter
+func (l *Limiter) Admit(keyID string, limits Limits) (*Meter, error) {
+	if limits.Unlimited() {
+		return nil, nil
+	}
+	m := &Meter{limiter: l, state: l.state(keyID, limits)}
+	s := m.state
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := l.now()
+	s.used = now
+	if s.requests != nil {
+		s.requests.refill(now)
+		if wait := s.requests.wait(1); wait > 0 {
+			return m, &Error{Kind: "requests", Limit: limits.RPM, Requested: 1, RetryAfter: wait}
+		}
+	}
+	if s.tokens != nil {
+		s.tokens.refill(now)
+		if wait := s.tokens.wait(1); wait > 0 {
+			return m, &Error{Kind: "tokens", Limit: limits.TPM, Requested: 1, RetryAfter: wait}
+		}
+	}
+	if s.requests != nil {
+		s.requests.tokens--
+	}
+	return m, nil
+}
+
+// Meter 一次请求的计量，所有方法都可以在 nil 上调用
+type Meter struct {
+	limiter *Limiter
+	state   *keyState
+}
+
+// Charge 按提示词 token 准入并扣除 token 额度。提示词超过每分钟额度时需要额度全满才能通过
+func (m *Meter) Charge(tokens int) error {
+	if m == nil || m.state.tokens == nil || tokens <= 0 {
+		return nil
+	}
+	s := m.state
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := m.limiter.now()
+	s.used = now
+	s.tokens.refill(now)
+	need := math.Min(float64(tokens), s.tokens.capacity)
+	if wait := s.tokens.wait(need); wait > 0 {
+		return &Error{Kind: "tokens", Limit: s.limits.TPM, Requested: tokens, RetryAfter: wait}
+	}
+	s.tokens.tokens -= float64(tokens)
+	return nil
+}
+
+// Settle 按实际输出的 token 结算，额度不足时透支
+func (m *Meter) Settle(tokens int) {
+	if m == nil || m.state.tokens == nil || tokens <= 0 {
+		return
+	}
+	s := m.state
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := m.limiter.now()
+	s.used = now
+	s.tokens.refill(now)
+	s.tokens.tokens -= float64(tokens)
+}
+
+// Refund 退还 Charge 扣除但没有用于上游请求的 token 额度，最多恢复到全满
+func (m *Meter) Refund(tokens int) {
+	if m == nil || m.state.tokens == nil || tokens <= 0 {
+		return
+	}
+	s := m.state
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens.refill(m.limiter.now())
+	s.tokens.tokens = math.Min(s.tokens.capacity, s.tokens.tokens+float64(tokens))
+}
+
+// SetHeaders 写入 OpenAI 风格的 x-ratelimit-* 响应头
+func (m *Meter) SetHeaders(h http.Header) {
+	if m == nil {
+		return
+	}
+	s := m.state
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := m.limiter.now()
+	if b := s.requests; b != nil {
+		b.refill(now)
+		h.Set("x-ratelimit-limit-requests", strconv.Itoa(s.limits.RPM))
+		h.Set("x-ratelimit-remaining-requests", strconv.Itoa(b.remaining()))
+		h.Set("x-ratelimit-reset-requests", formatReset(b.wait(b.capacity)))
+	}
+	if b := s.tokens; b != nil {
+		b.refill(now)
+		h.Set("x-ratelimit-limit-tokens", strconv.Itoa(s.limits.TPM))
+		h.Set("x-ratelimit-remaining-tokens", strconv.Itoa(b.remaining()))
+		h.Set("x-ratelimit-reset-tokens", formatReset(b.wait(b.capacity)))
+	}
+}
+
+// formatReset 按 OpenAI 的格式输出时长，如 "20ms"、"1s"、"6m0s"
+func formatReset(d time.Duration) string {
+	if d < time.Second {
+		return d.Round(time.Millisecond).String()
+	}
+	return d.Round(time.Second).String()
+}
+
+type contextKey struct{}
+
+// WithMeter 将本次请求的计量放入 context，供建立上游连接时按 token 准入与结算
+func WithMeter(ctx context.Context, m *Meter) context.Context {
+	return context.WithValue(ctx, contextKey{}, m)
+}
+
+// FromContext 返回 context 中的计量，没有限制时返回 nil
+func FromContext(ctx context.Context) *Meter {
+	m, _ := ctx.Value(contextKey{}).(*Meter)
+	return m
+}
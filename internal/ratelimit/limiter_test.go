@@ -0,0 +1,71 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiterEvictsIdleKeys(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	l := NewLimiter()
+	l.now = func() time.Time { return now }
+	limits := Limits{RPM: 60, TPM: 1000}
+
+	m, err := l.Admit("overdrawn", limits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Admit("quiet", limits); err != nil {
+		t.Fatal(err)
+	}
+	// 透支的 token 额度需要两分钟才能恢复
+	m.Settle(2000)
+
+	now = now.Add(90 * time.Second)
+	if _, err := l.Admit("other", limits); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := l.keys["quiet"]; ok {
+		t.Error("idle key with full buckets was not evicted")
+	}
+	if _, ok := l.keys["overdrawn"]; !ok {
+		t.Error("key with an overdrawn bucket was evicted")
+	}
+
+	now = now.Add(2 * time.Minute)
+	l.state("other", limits)
+	if _, ok := l.keys["overdrawn"]; ok {
+		t.Error("key was not evicted after its buckets refilled")
+	}
+	if _, ok := l.keys["other"]; !ok {
+		t.Error("key in use was not recreated")
+	}
+}
+
+func TestMeterRefund(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	l := NewLimiter()
+	l.now = func() time.Time { return now }
+	limits := Limits{TPM: 1000}
+
+	m, err := l.Admit("key", limits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Charge(800); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Charge(800); err == nil {
+		t.Fatal("second charge passed with 200 tokens left")
+	}
+	// 上游请求失败时退还，额度恢复后可以再次准入
+	m.Refund(800)
+	if err := m.Charge(800); err != nil {
+		t.Fatalf("charge after refund: %v", err)
+	}
+	// 退还不会超过容量
+	m.Refund(5000)
+	if got := m.state.tokens.tokens; got != 1000 {
+		t.Fatalf("tokens after refund = %v, want 1000", got)
+	}
+}
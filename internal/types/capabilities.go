@@ -0,0 +1,73 @@
+package types
+
+import (
+	"fmt"
+
+	"github.com/sashabaranov/go-openai"
+
+	"monica-proxy/internal/utils"
+)
+
+// CapabilityError 请求超出模型能力时返回的错误，字段与 OpenAI 错误信封对应
+type CapabilityError struct {
+	Param   string
+	Code    string
+	Message string
+}
+
+func (e *CapabilityError) Error() string {
+	return e.Message
+}
+
+// hasImageInput 判断请求中是否包含图片
+func hasImageInput(req openai.ChatCompletionRequest) bool {
+	for _, msg := range req.Messages {
+		for _, part := range msg.MultiContent {
+			if part.Type == openai.ChatMessagePartTypeImageURL {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// AdaptChatRequest 按模型能力校验并调整请求：
+// 无法满足的请求（图片输入、超出上下文窗口）返回 CapabilityError，
+// 可以降级的参数（推理强度、输出长度）直接在请求上修改
+func AdaptChatRequest(req *openai.ChatCompletionRequest) error {
+	model, exists := GetModel(req.Model)
+	if !exists {
+		return &CapabilityError{Param: "model", Code: "model_not_found", Message: fmt.Sprintf("The model `%s` does not exist", req.Model)}
+	}
+	caps := model.Capabilities
+
+	if !caps.Vision && hasImageInput(*req) {
+		return &CapabilityError{Param: "messages", Code: "image_input_not_supported", Message: fmt.Sprintf("Model %s does not support image input", req.Model)}
+	}
+
+	if caps.ContextWindow > 0 {
+		if tokens := utils.CalculatePromptTokens(*req); tokens > caps.ContextWindow {
+			return &CapabilityError{
+				Param:   "messages",
+				Code:    "context_length_exceeded",
+				Message: fmt.Sprintf("This model's maximum context length is %d tokens. However, your messages resulted in %d tokens.", caps.ContextWindow, tokens),
+			}
+		}
+	}
+
+	// 非推理模型忽略推理强度
+	if !caps.Reasoning {
+		req.ReasoningEffort = ""
+	}
+
+	// 输出长度超过模型上限时截断到上限
+	if limit := caps.MaxOutputTokens; limit > 0 {
+		if req.MaxTokens > limit {
+			req.MaxTokens = limit
+		}
+		if req.MaxCompletionTokens > limit {
+			req.MaxCompletionTokens = limit
+		}
+	}
+	return nil
+}
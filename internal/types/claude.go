@@ -0,0 +1,258 @@
+package types
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// ClaudeRequest Anthropic Messages API 请求格式
+type ClaudeRequest struct {
+	Model         string          `json:"model"`
+	System        ClaudeContent   `json:"system,omitempty"` // 可以是字符串或文本块数组
+	Messages      []ClaudeMessage `json:"messages"`
+	MaxTokens     int             `json:"max_tokens"`
+	StopSequences []string        `json:"stop_sequences,omitempty"`
+	Stream        bool            `json:"stream,omitempty"`
+	Temperature   float32         `json:"temperature,omitempty"`
+	TopP          float32         `json:"top_p,omitempty"`
+	TopK          int             `json:"top_k,omitempty"`
+	Metadata      *ClaudeMetadata `json:"metadata,omitempty"`
+	Thinking      *ClaudeThinking `json:"thinking,omitempty"`
+}
+
+// ClaudeMetadata 请求元数据
+type ClaudeMetadata struct {
+	UserID string `json:"user_id,omitempty"`
+}
+
+// ClaudeThinking 扩展思考配置，Monica 侧由模型自身决定是否思考，这里仅做兼容解析
+type ClaudeThinking struct {
+	Type         string `json:"type"`
+	BudgetTokens int    `json:"budget_tokens,omitempty"`
+}
+
+// ClaudeMessage 对话消息
+type ClaudeMessage struct {
+	Role    string        `json:"role"` // "user" 或 "assistant"
+	Content ClaudeContent `json:"content"`
+}
+
+// ClaudeContent 兼容字符串与内容块数组两种写法
+type ClaudeContent []ClaudeContentBlock
+
+// ClaudeContentBlock 请求中的内容块
+type ClaudeContentBlock struct {
+	Type      string             `json:"type"` // text / image / thinking / tool_use / tool_result
+	Text      string             `json:"text,omitempty"`
+	Thinking  string             `json:"thinking,omitempty"`
+	Source    *ClaudeImageSource `json:"source,omitempty"`
+	ID        string             `json:"id,omitempty"`
+	Name      string             `json:"name,omitempty"`
+	Input     json.RawMessage    `json:"input,omitempty"`
+	ToolUseID string             `json:"tool_use_id,omitempty"`
+	Content   ClaudeContent      `json:"content,omitempty"`
+}
+
+// ClaudeImageSource 图片来源
+type ClaudeImageSource struct {
+	Type      string `json:"type"` // "base64" 或 "url"
+	MediaType string `json:"media_type,omitempty"`
+	Data      string `json:"data,omitempty"`
+	URL       string `json:"url,omitempty"`
+}
+
+func (c *ClaudeContent) UnmarshalJSON(b []byte) error {
+	var text string
+	if err := json.Unmarshal(b, &text); err == nil {
+		*c = ClaudeContent{{Type: "text", Text: text}}
+		return nil
+	}
+	var blocks []ClaudeContentBlock
+	if err := json.Unmarshal(b, &blocks); err != nil {
+		return err
+	}
+	*c = blocks
+	return nil
+}
+
+// Text 拼接内容中的全部文本块
+func (c ClaudeContent) Text() string {
+	var texts []string
+	for _, block := range c {
+		if block.Type == "text" && block.Text != "" {
+			texts = append(texts, block.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// ClaudeResponse 非流式响应
+type ClaudeResponse struct {
+	ID           string      `json:"id"`
+	Type         string      `json:"type"`
+	Role         string      `json:"role"`
+	Model        string      `json:"model"`
+	Content      []any       `json:"content"`
+	StopReason   *string     `json:"stop_reason"`
+	StopSequence *string     `json:"stop_sequence"`
+	Usage        ClaudeUsage `json:"usage"`
+}
+
+// ClaudeTextBlock 响应中的文本块
+type ClaudeTextBlock struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// ClaudeThinkingBlock 响应中的思考块，Monica 不返回签名，signature 恒为空
+type ClaudeThinkingBlock struct {
+	Type      string `json:"type"`
+	Thinking  string `json:"thinking"`
+	Signature string `json:"signature"`
+}
+
+// ClaudeUsage token 用量
+type ClaudeUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+// ClaudeMessageStartEvent message_start 事件
+type ClaudeMessageStartEvent struct {
+	Type    string         `json:"type"`
+	Message ClaudeResponse `json:"message"`
+}
+
+// ClaudeContentBlockStartEvent content_block_start 事件
+type ClaudeContentBlockStartEvent struct {
+	Type         string `json:"type"`
+	Index        int    `json:"index"`
+	ContentBlock any    `json:"content_block"`
+}
+
+// ClaudeContentBlockDeltaEvent content_block_delta 事件
+type ClaudeContentBlockDeltaEvent struct {
+	Type  string      `json:"type"`
+	Index int         `json:"index"`
+	Delta ClaudeDelta `json:"delta"`
+}
+
+// ClaudeDelta 增量内容，text_delta 使用 text，thinking_delta 使用 thinking
+type ClaudeDelta struct {
+	Type     string `json:"type"`
+	Text     string `json:"text,omitempty"`
+	Thinking string `json:"thinking,omitempty"`
+}
+
+// ClaudeContentBlockStopEvent content_block_stop 事件
+type ClaudeContentBlockStopEvent struct {
+	Type  string `json:"type"`
+	Index int    `json:"index"`
+}
+
+// ClaudeMessageDeltaEvent message_delta 事件
+type ClaudeMessageDeltaEvent struct {
+	Type  string             `json:"type"`
+	Delta ClaudeMessageDelta `json:"delta"`
+	Usage ClaudeUsage        `json:"usage"`
+}
+
+// ClaudeMessageDelta 消息级别的增量
+type ClaudeMessageDelta struct {
+	StopReason   *string `json:"stop_reason"`
+	StopSequence *string `json:"stop_sequence"`
+}
+
+// ClaudeEvent 只有 type 字段的事件，如 ping、message_stop
+type ClaudeEvent struct {
+	Type string `json:"type"`
+}
+
+// ClaudeErrorResponse Anthropic 风格的错误信封
+type ClaudeErrorResponse struct {
+	Type  string      `json:"type"`
+	Error ClaudeError `json:"error"`
+}
+
+// ClaudeError 错误详情
+type ClaudeError struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+// ClaudeToChatGPT 将 Anthropic 请求转换为 OpenAI 请求，后续复用 ChatGPTToMonica 构建 Monica 请求
+func ClaudeToChatGPT(req ClaudeRequest) (openai.ChatCompletionRequest, error) {
+	chatReq := openai.ChatCompletionRequest{
+		Model:       req.Model,
+		MaxTokens:   req.MaxTokens,
+		Stop:        req.StopSequences,
+		Stream:      req.Stream,
+		Temperature: req.Temperature,
+		TopP:        req.TopP,
+	}
+	if req.Metadata != nil {
+		chatReq.User = req.Metadata.UserID
+	}
+
+	if system := req.System.Text(); system != "" {
+		chatReq.Messages = append(chatReq.Messages, openai.ChatCompletionMessage{
+			Role:    openai.ChatMessageRoleSystem,
+			Content: system,
+		})
+	}
+
+	for _, msg := range req.Messages {
+		if msg.Role != "user" && msg.Role != "assistant" {
+			return chatReq, fmt.Errorf("unsupported role: %s", msg.Role)
+		}
+
+		var texts []string
+		var images []string
+		for _, block := range msg.Content {
+			switch block.Type {
+			case "text":
+				texts = append(texts, block.Text)
+			case "image":
+				if block.Source == nil {
+					continue
+				}
+				if block.Source.Type == "base64" {
+					images = append(images, fmt.Sprintf("data:%s;base64,%s", block.Source.MediaType, block.Source.Data))
+				} else if block.Source.URL != "" {
+					images = append(images, block.Source.URL)
+				}
+			case "tool_use":
+				// Monica 不支持工具调用，以文本形式保留上下文
+				texts = append(texts, fmt.Sprintf("[tool_use %s] %s", block.Name, string(block.Input)))
+			case "tool_result":
+				texts = append(texts, fmt.Sprintf("[tool_result %s] %s", block.ToolUseID, block.Content.Text()))
+			}
+			// thinking 块为历史思考内容，Monica 无需回传，直接忽略
+		}
+
+		chatMsg := openai.ChatCompletionMessage{Role: msg.Role}
+		text := strings.Join(texts, "\n")
+		if len(images) > 0 {
+			if text != "" {
+				chatMsg.MultiContent = append(chatMsg.MultiContent, openai.ChatMessagePart{
+					Type: openai.ChatMessagePartTypeText,
+					Text: text,
+				})
+			}
+			for _, url := range images {
+				chatMsg.MultiContent = append(chatMsg.MultiContent, openai.ChatMessagePart{
+					Type:     openai.ChatMessagePartTypeImageURL,
+					ImageURL: &openai.ChatMessageImageURL{URL: url},
+				})
+			}
+		} else {
+			chatMsg.Content = text
+		}
+		chatReq.Messages = append(chatReq.Messages, chatMsg)
+	}
+
+	return chatReq, nil
+}
@@ -0,0 +1,67 @@
+package types
+
+import (
+	"fmt"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// CompletionPrompts 解析 /v1/completions 的 prompt 字段，兼容字符串与字符串数组
+func CompletionPrompts(req openai.CompletionRequest) ([]string, error) {
+	switch prompt := req.Prompt.(type) {
+	case string:
+		return []string{prompt}, nil
+	case []any:
+		prompts := make([]string, 0, len(prompt))
+		for _, p := range prompt {
+			text, ok := p.(string)
+			if !ok {
+				return nil, fmt.Errorf("prompt must be a string or an array of strings")
+			}
+			prompts = append(prompts, text)
+		}
+		return prompts, nil
+	default:
+		return nil, fmt.Errorf("prompt must be a string or an array of strings")
+	}
+}
+
+// CompletionToChatGPT 将单个 prompt 包装为一条用户消息，复用 ChatGPTToMonica 构建 Monica 请求
+func CompletionToChatGPT(req openai.CompletionRequest, prompt string) openai.ChatCompletionRequest {
+	content := prompt
+	if req.Suffix != "" {
+		// Monica 不支持插入式补全，通过提示词让模型只输出前后文之间的内容
+		content = fmt.Sprintf("Fill in the text that belongs between the prefix and the suffix below. "+
+			"Reply with the inserted text only, without repeating the prefix or the suffix.\n\n"+
+			"<prefix>\n%s\n</prefix>\n<suffix>\n%s\n</suffix>", prompt, req.Suffix)
+	}
+
+	return openai.ChatCompletionRequest{
+		Model:       req.Model,
+		Messages:    []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: content}},
+		MaxTokens:   req.MaxTokens,
+		Temperature: req.Temperature,
+		TopP:        req.TopP,
+		Stop:        req.Stop,
+		Stream:      req.Stream,
+		User:        req.User,
+	}
+}
+
+// CompletionResponse text_completion 响应，流式与非流式共用
+type CompletionResponse struct {
+	ID      string             `json:"id"`
+	Object  string             `json:"object"`
+	Created int64              `json:"created"`
+	Model   string             `json:"model"`
+	Choices []CompletionChoice `json:"choices"`
+	Usage   *openai.Usage      `json:"usage,omitempty"`
+}
+
+// CompletionChoice 单个补全结果，流式输出未结束时 finish_reason 为 null
+type CompletionChoice struct {
+	Text         string  `json:"text"`
+	Index        int     `json:"index"`
+	Logprobs     any     `json:"logprobs"`
+	FinishReason *string `json:"finish_reason"`
+}
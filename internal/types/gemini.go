@@ -0,0 +1,202 @@
+package types
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// GeminiRequest Gemini generateContent 请求格式，同时兼容 REST 接口的 snake_case 写法
+type GeminiRequest struct {
+	Contents               []GeminiContent         `json:"contents"`
+	SystemInstruction      *GeminiContent          `json:"systemInstruction,omitempty"`
+	SystemInstructionSnake *GeminiContent          `json:"system_instruction,omitempty"`
+	GenerationConfig       *GeminiGenerationConfig `json:"generationConfig,omitempty"`
+	GenerationConfigSnake  *GeminiGenerationConfig `json:"generation_config,omitempty"`
+}
+
+// GeminiContent 对话内容
+type GeminiContent struct {
+	Role  string       `json:"role,omitempty"` // "user" 或 "model"
+	Parts []GeminiPart `json:"parts"`
+}
+
+// GeminiPart 内容片段
+type GeminiPart struct {
+	Text            string          `json:"text,omitempty"`
+	Thought         bool            `json:"thought,omitempty"`
+	InlineData      *GeminiBlob     `json:"inlineData,omitempty"`
+	InlineDataSnake *GeminiBlob     `json:"inline_data,omitempty"`
+	FileData        *GeminiFileData `json:"fileData,omitempty"`
+}
+
+// GeminiBlob 内联数据（base64）
+type GeminiBlob struct {
+	MimeType      string `json:"mimeType,omitempty"`
+	MimeTypeSnake string `json:"mime_type,omitempty"`
+	Data          string `json:"data"`
+}
+
+// GeminiFileData 文件引用
+type GeminiFileData struct {
+	MimeType string `json:"mimeType,omitempty"`
+	FileURI  string `json:"fileUri"`
+}
+
+// GeminiGenerationConfig 生成配置
+type GeminiGenerationConfig struct {
+	Temperature     float32               `json:"temperature,omitempty"`
+	TopP            float32               `json:"topP,omitempty"`
+	TopK            int                   `json:"topK,omitempty"`
+	MaxOutputTokens int                   `json:"maxOutputTokens,omitempty"`
+	StopSequences   []string              `json:"stopSequences,omitempty"`
+	CandidateCount  int                   `json:"candidateCount,omitempty"`
+	ThinkingConfig  *GeminiThinkingConfig `json:"thinkingConfig,omitempty"`
+}
+
+// GeminiThinkingConfig 思考配置
+type GeminiThinkingConfig struct {
+	IncludeThoughts bool `json:"includeThoughts,omitempty"`
+	ThinkingBudget  int  `json:"thinkingBudget,omitempty"`
+}
+
+// GeminiResponse generateContent 响应，流式时每个 chunk 也使用该结构
+type GeminiResponse struct {
+	Candidates    []GeminiCandidate    `json:"candidates"`
+	UsageMetadata *GeminiUsageMetadata `json:"usageMetadata,omitempty"`
+	ModelVersion  string               `json:"modelVersion,omitempty"`
+}
+
+// GeminiCandidate 候选结果
+type GeminiCandidate struct {
+	Content      GeminiContent `json:"content"`
+	FinishReason string        `json:"finishReason,omitempty"`
+	Index        int           `json:"index"`
+}
+
+// GeminiUsageMetadata token 用量
+type GeminiUsageMetadata struct {
+	PromptTokenCount     int `json:"promptTokenCount"`
+	CandidatesTokenCount int `json:"candidatesTokenCount"`
+	ThoughtsTokenCount   int `json:"thoughtsTokenCount,omitempty"`
+	TotalTokenCount      int `json:"totalTokenCount"`
+}
+
+// GeminiErrorResponse Gemini 风格的错误信封
+type GeminiErrorResponse struct {
+	Error GeminiError `json:"error"`
+}
+
+// GeminiError 错误详情
+type GeminiError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Status  string `json:"status"`
+}
+
+// Config 返回生成配置，兼容 camelCase 与 snake_case
+func (r GeminiRequest) Config() GeminiGenerationConfig {
+	if r.GenerationConfig != nil {
+		return *r.GenerationConfig
+	}
+	if r.GenerationConfigSnake != nil {
+		return *r.GenerationConfigSnake
+	}
+	return GeminiGenerationConfig{}
+}
+
+// IncludeThoughts 是否在响应中返回思考内容
+func (r GeminiRequest) IncludeThoughts() bool {
+	cfg := r.Config()
+	return cfg.ThinkingConfig != nil && cfg.ThinkingConfig.IncludeThoughts
+}
+
+// GeminiToChatGPT 将 Gemini 请求转换为 OpenAI 请求，inlineData 图片以 data URL 形式交给 ChatGPTToMonica 上传
+func GeminiToChatGPT(model string, req GeminiRequest) (openai.ChatCompletionRequest, error) {
+	cfg := req.Config()
+	chatReq := openai.ChatCompletionRequest{
+		Model:       model,
+		MaxTokens:   cfg.MaxOutputTokens,
+		Temperature: cfg.Temperature,
+		TopP:        cfg.TopP,
+		Stop:        cfg.StopSequences,
+	}
+
+	system := req.SystemInstruction
+	if system == nil {
+		system = req.SystemInstructionSnake
+	}
+	if system != nil {
+		var texts []string
+		for _, part := range system.Parts {
+			if part.Text != "" {
+				texts = append(texts, part.Text)
+			}
+		}
+		if len(texts) > 0 {
+			chatReq.Messages = append(chatReq.Messages, openai.ChatCompletionMessage{
+				Role:    openai.ChatMessageRoleSystem,
+				Content: strings.Join(texts, "\n"),
+			})
+		}
+	}
+
+	for _, content := range req.Contents {
+		role := openai.ChatMessageRoleUser
+		if content.Role == "model" {
+			role = openai.ChatMessageRoleAssistant
+		}
+
+		var texts []string
+		var images []string
+		for _, part := range content.Parts {
+			if part.Thought {
+				// 历史思考内容无需回传
+				continue
+			}
+			if part.Text != "" {
+				texts = append(texts, part.Text)
+			}
+			blob := part.InlineData
+			if blob == nil {
+				blob = part.InlineDataSnake
+			}
+			if blob != nil {
+				mimeType := blob.MimeType
+				if mimeType == "" {
+					mimeType = blob.MimeTypeSnake
+				}
+				if !SupportedImageTypes[mimeType] {
+					return chatReq, fmt.Errorf("unsupported inline data mime type: %s", mimeType)
+				}
+				images = append(images, fmt.Sprintf("data:%s;base64,%s", mimeType, blob.Data))
+			}
+			if part.FileData != nil {
+				texts = append(texts, fmt.Sprintf("[file: %s]", part.FileData.FileURI))
+			}
+		}
+
+		msg := openai.ChatCompletionMessage{Role: role}
+		text := strings.Join(texts, "\n")
+		if len(images) == 0 {
+			msg.Content = text
+		} else {
+			if text != "" {
+				msg.MultiContent = append(msg.MultiContent, openai.ChatMessagePart{
+					Type: openai.ChatMessagePartTypeText,
+					Text: text,
+				})
+			}
+			for _, url := range images {
+				msg.MultiContent = append(msg.MultiContent, openai.ChatMessagePart{
+					Type:     openai.ChatMessagePartTypeImageURL,
+					ImageURL: &openai.ChatMessageImageURL{URL: url},
+				})
+			}
+		}
+		chatReq.Messages = append(chatReq.Messages, msg)
+	}
+
+	return chatReq, nil
+}
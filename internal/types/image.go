@@ -4,7 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log"
-	"monica-proxy/internal/config"
+	"monica-proxy/internal/account"
 	"monica-proxy/internal/utils"
 	"net/http"
 	"strings"
@@ -19,7 +19,7 @@ const (
 	imageCacheSize  = 1000             // 图片缓存最大条目数，防止内存无限增长
 )
 
-var imageCache = NewLRUCache(imageCacheSize)
+var imageCache = NewLRUCache[*FileInfo](imageCacheSize)
 
 // sampleAndHash 对base64字符串进行采样并计算xxHash
 func sampleAndHash(data string) string {
@@ -42,10 +42,15 @@ func sampleAndHash(data string) string {
 	return fmt.Sprintf("%x", xxhash.Sum64String(strings.Join(samples, "")))
 }
 
-// UploadBase64Image 上传base64编码的图片到Monica
+// UploadBase64Image 使用 context 中的账号上传base64编码的图片到Monica
 func UploadBase64Image(ctx context.Context, base64Data string) (*FileInfo, error) {
-	// 1. 生成缓存key
-	cacheKey := sampleAndHash(base64Data)
+	acc := account.FromContext(ctx)
+	if acc == nil {
+		return nil, account.ErrNoAccount
+	}
+
+	// 1. 生成缓存key，file_uid 只在上传的账号下有效，因此按账号区分
+	cacheKey := acc.ID + ":" + sampleAndHash(base64Data)
 
 	// 2. 检查缓存
 	if value, exists := imageCache.Load(cacheKey); exists {
@@ -87,15 +92,16 @@ func UploadBase64Image(ctx context.Context, base64Data string) (*FileInfo, error
 	}
 
 	var preSignResp PreSignResponse
-	_, err = utils.RestyDefaultClient.R().
+	resp, err := utils.DefaultClient(acc.Proxy).R().
 		SetContext(ctx).
-		SetHeader("cookie", config.MonicaConfig.MonicaCookie).
+		SetHeader("cookie", acc.Cookie).
 		SetBody(preSignReq).
 		SetResult(&preSignResp).
 		Post(PreSignURL)
 
 	if err != nil {
-		return nil, fmt.Errorf("get pre-sign url failed: %v", err)
+		// 预签名与创建文件对象使用账号 cookie，失败时记录到账号状态，便于换账号重新上传
+		return nil, fmt.Errorf("get pre-sign url failed: %w", acc.ObserveError(ctx, utils.StatusCode(resp), err))
 	}
 
 	if len(preSignResp.Data.PreSignURLList) == 0 || len(preSignResp.Data.ObjectURLList) == 0 {
@@ -104,7 +110,7 @@ func UploadBase64Image(ctx context.Context, base64Data string) (*FileInfo, error
 	log.Printf("preSign info: %+v", preSignResp)
 
 	// 6. 上传图片数据
-	_, err = utils.RestyDefaultClient.R().
+	_, err = utils.DefaultClient(acc.Proxy).R().
 		SetContext(ctx).
 		SetHeader("Content-Type", fileInfo.FileType).
 		SetBody(imageData).
@@ -121,15 +127,15 @@ func UploadBase64Image(ctx context.Context, base64Data string) (*FileInfo, error
 	}
 
 	var uploadResp FileUploadResponse
-	_, err = utils.RestyDefaultClient.R().
+	resp, err = utils.DefaultClient(acc.Proxy).R().
 		SetContext(ctx).
-		SetHeader("cookie", config.MonicaConfig.MonicaCookie).
+		SetHeader("cookie", acc.Cookie).
 		SetBody(uploadReq).
 		SetResult(&uploadResp).
 		Post(FileUploadURL)
 
 	if err != nil {
-		return nil, fmt.Errorf("create file object failed: %v", err)
+		return nil, fmt.Errorf("create file object failed: %w", acc.ObserveError(ctx, utils.StatusCode(resp), err))
 	}
 	log.Printf("uploadResp: %+v", uploadResp)
 	if len(uploadResp.Data.Items) > 0 {
@@ -154,9 +160,9 @@ func UploadBase64Image(ctx context.Context, base64Data string) (*FileInfo, error
 		if retryCount > 5 {
 			return nil, fmt.Errorf("retry limit exceeded")
 		}
-		_, err = utils.RestyDefaultClient.R().
+		_, err = utils.DefaultClient(acc.Proxy).R().
 			SetContext(ctx).
-			SetHeader("cookie", config.MonicaConfig.MonicaCookie).
+			SetHeader("cookie", acc.Cookie).
 			SetBody(reqMap).
 			SetResult(&batchResp).
 			Post(FileGetURL)
@@ -0,0 +1,47 @@
+package types
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+const (
+	// DefaultImageModel /v1/images/generations 未指定模型时使用的绘图模型
+	DefaultImageModel = "dall-e-3"
+	// MaxImageN 单次请求最多生成的图片数量，每张图片对应一个独立的 Monica 会话
+	MaxImageN = 4
+)
+
+// 支持的图片尺寸
+var SupportedImageSizes = map[string]bool{
+	openai.CreateImageSize1024x1024: true,
+	openai.CreateImageSize1792x1024: true,
+	openai.CreateImageSize1024x1792: true,
+}
+
+// ImageToChatGPT 将图片生成请求转换为发给绘图模型的单条用户消息，尺寸、质量与风格以提示词形式传递
+func ImageToChatGPT(req openai.ImageRequest) openai.ChatCompletionRequest {
+	var options []string
+	if req.Size != "" {
+		options = append(options, fmt.Sprintf("size: %s", req.Size))
+	}
+	if req.Quality != "" {
+		options = append(options, fmt.Sprintf("quality: %s", req.Quality))
+	}
+	if req.Style != "" {
+		options = append(options, fmt.Sprintf("style: %s", req.Style))
+	}
+
+	content := req.Prompt
+	if len(options) > 0 {
+		content = fmt.Sprintf("%s\n\n(%s)", req.Prompt, strings.Join(options, ", "))
+	}
+
+	return openai.ChatCompletionRequest{
+		Model:    req.Model,
+		Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: content}},
+		User:     req.User,
+	}
+}
@@ -0,0 +1,307 @@
+package types
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	maxSchemaErrors = 10 // 返回的校验错误条数上限
+	maxSchemaDepth  = 64 // $ref 递归深度上限，防止循环引用
+)
+
+// JSONSchema 精简的 JSON Schema 校验器，覆盖结构化输出常用的关键字：
+// type、enum、const、properties、required、additionalProperties、items、prefixItems、
+// minItems/maxItems、minLength/maxLength、pattern、minimum/maximum、exclusiveMinimum/exclusiveMaximum、
+// anyOf/oneOf/allOf/not 以及文档内的 $ref
+type JSONSchema struct {
+	root any
+}
+
+// ParseJSONSchema 解析 JSON Schema 文档
+func ParseJSONSchema(raw []byte) (*JSONSchema, error) {
+	var root any
+	if err := json.Unmarshal(raw, &root); err != nil {
+		return nil, err
+	}
+	switch root.(type) {
+	case map[string]any, bool:
+	default:
+		return nil, fmt.Errorf("schema must be an object or boolean")
+	}
+	return &JSONSchema{root: root}, nil
+}
+
+// Validate 校验 JSON 值（encoding/json 解码得到的 any），返回错误列表，为空表示通过
+func (s *JSONSchema) Validate(value any) []string {
+	var errs []string
+	s.validate(s.root, value, "$", 0, &errs)
+	return errs
+}
+
+func (s *JSONSchema) addError(errs *[]string, path, format string, args ...any) {
+	if len(*errs) < maxSchemaErrors {
+		*errs = append(*errs, path+": "+fmt.Sprintf(format, args...))
+	}
+}
+
+// resolveRef 解析文档内引用，如 #/$defs/Item
+func (s *JSONSchema) resolveRef(ref string) (any, bool) {
+	if !strings.HasPrefix(ref, "#") {
+		return nil, false
+	}
+	node := s.root
+	for _, token := range strings.Split(strings.TrimPrefix(ref, "#"), "/") {
+		if token == "" {
+			continue
+		}
+		token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+		switch n := node.(type) {
+		case map[string]any:
+			var ok bool
+			if node, ok = n[token]; !ok {
+				return nil, false
+			}
+		case []any:
+			i, err := strconv.Atoi(token)
+			if err != nil || i < 0 || i >= len(n) {
+				return nil, false
+			}
+			node = n[i]
+		default:
+			return nil, false
+		}
+	}
+	return node, true
+}
+
+func (s *JSONSchema) validate(schema, value any, path string, depth int, errs *[]string) {
+	if depth > maxSchemaDepth {
+		s.addError(errs, path, "schema nesting too deep")
+		return
+	}
+
+	switch sc := schema.(type) {
+	case bool:
+		if !sc {
+			s.addError(errs, path, "value is not allowed")
+		}
+		return
+	case map[string]any:
+		s.validateObject(sc, value, path, depth, errs)
+	}
+}
+
+func (s *JSONSchema) validateObject(sc map[string]any, value any, path string, depth int, errs *[]string) {
+	if ref, ok := sc["$ref"].(string); ok {
+		target, found := s.resolveRef(ref)
+		if !found {
+			s.addError(errs, path, "unresolvable $ref %s", ref)
+			return
+		}
+		s.validate(target, value, path, depth+1, errs)
+	}
+
+	if t, ok := sc["type"]; ok && !matchesType(t, value) {
+		s.addError(errs, path, "expected type %v, got %s", t, jsonTypeName(value))
+		return
+	}
+
+	if enum, ok := sc["enum"].([]any); ok {
+		found := false
+		for _, e := range enum {
+			if reflect.DeepEqual(e, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			s.addError(errs, path, "value is not one of the allowed values")
+		}
+	}
+	if c, ok := sc["const"]; ok && !reflect.DeepEqual(c, value) {
+		s.addError(errs, path, "value must be %v", c)
+	}
+
+	switch v := value.(type) {
+	case map[string]any:
+		s.validateProperties(sc, v, path, depth, errs)
+	case []any:
+		s.validateItems(sc, v, path, depth, errs)
+	case string:
+		length := utf8.RuneCountInString(v)
+		if n, ok := schemaNumber(sc, "minLength"); ok && float64(length) < n {
+			s.addError(errs, path, "string is shorter than %v", n)
+		}
+		if n, ok := schemaNumber(sc, "maxLength"); ok && float64(length) > n {
+			s.addError(errs, path, "string is longer than %v", n)
+		}
+		if pattern, ok := sc["pattern"].(string); ok {
+			if re, err := regexp.Compile(pattern); err == nil && !re.MatchString(v) {
+				s.addError(errs, path, "string does not match pattern %s", pattern)
+			}
+		}
+	case float64:
+		if n, ok := schemaNumber(sc, "minimum"); ok && v < n {
+			s.addError(errs, path, "value must be >= %v", n)
+		}
+		if n, ok := schemaNumber(sc, "maximum"); ok && v > n {
+			s.addError(errs, path, "value must be <= %v", n)
+		}
+		if n, ok := schemaNumber(sc, "exclusiveMinimum"); ok && v <= n {
+			s.addError(errs, path, "value must be > %v", n)
+		}
+		if n, ok := schemaNumber(sc, "exclusiveMaximum"); ok && v >= n {
+			s.addError(errs, path, "value must be < %v", n)
+		}
+	}
+
+	if all, ok := sc["allOf"].([]any); ok {
+		for _, sub := range all {
+			s.validate(sub, value, path, depth+1, errs)
+		}
+	}
+	if anyOf, ok := sc["anyOf"].([]any); ok && s.countMatches(anyOf, value, path, depth) == 0 {
+		s.addError(errs, path, "value does not match any of the allowed schemas")
+	}
+	if oneOf, ok := sc["oneOf"].([]any); ok {
+		if n := s.countMatches(oneOf, value, path, depth); n != 1 {
+			s.addError(errs, path, "value must match exactly one schema, matched %d", n)
+		}
+	}
+	if not, ok := sc["not"]; ok {
+		var sub []string
+		s.validate(not, value, path, depth+1, &sub)
+		if len(sub) == 0 {
+			s.addError(errs, path, "value must not match the schema")
+		}
+	}
+}
+
+func (s *JSONSchema) validateProperties(sc map[string]any, v map[string]any, path string, depth int, errs *[]string) {
+	if required, ok := sc["required"].([]any); ok {
+		for _, r := range required {
+			if name, ok := r.(string); ok {
+				if _, exists := v[name]; !exists {
+					s.addError(errs, path, "missing required property %q", name)
+				}
+			}
+		}
+	}
+
+	properties, _ := sc["properties"].(map[string]any)
+	additional, hasAdditional := sc["additionalProperties"]
+
+	// 按键名排序，保证错误信息顺序稳定
+	keys := make([]string, 0, len(v))
+	for k := range v {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		childPath := path + "." + k
+		if sub, ok := properties[k]; ok {
+			s.validate(sub, v[k], childPath, depth+1, errs)
+		} else if hasAdditional {
+			if allowed, ok := additional.(bool); ok && !allowed {
+				s.addError(errs, path, "unexpected property %q", k)
+			} else {
+				s.validate(additional, v[k], childPath, depth+1, errs)
+			}
+		}
+	}
+}
+
+func (s *JSONSchema) validateItems(sc map[string]any, v []any, path string, depth int, errs *[]string) {
+	if n, ok := schemaNumber(sc, "minItems"); ok && float64(len(v)) < n {
+		s.addError(errs, path, "array must have at least %v items", n)
+	}
+	if n, ok := schemaNumber(sc, "maxItems"); ok && float64(len(v)) > n {
+		s.addError(errs, path, "array must have at most %v items", n)
+	}
+
+	prefix, _ := sc["prefixItems"].([]any)
+	items := sc["items"]
+	// 旧版写法：items 为数组时按位置校验
+	if tuple, ok := items.([]any); ok {
+		prefix, items = tuple, nil
+	}
+	for i, item := range v {
+		childPath := fmt.Sprintf("%s[%d]", path, i)
+		if i < len(prefix) {
+			s.validate(prefix[i], item, childPath, depth+1, errs)
+		} else if items != nil {
+			s.validate(items, item, childPath, depth+1, errs)
+		}
+	}
+}
+
+func (s *JSONSchema) countMatches(schemas []any, value any, path string, depth int) int {
+	matched := 0
+	for _, sub := range schemas {
+		var subErrs []string
+		s.validate(sub, value, path, depth+1, &subErrs)
+		if len(subErrs) == 0 {
+			matched++
+		}
+	}
+	return matched
+}
+
+func schemaNumber(sc map[string]any, key string) (float64, bool) {
+	n, ok := sc[key].(float64)
+	return n, ok
+}
+
+// matchesType 判断值是否满足 type 关键字，type 可以是字符串或字符串数组
+func matchesType(t any, value any) bool {
+	switch tt := t.(type) {
+	case string:
+		return matchesTypeName(tt, value)
+	case []any:
+		for _, name := range tt {
+			if s, ok := name.(string); ok && matchesTypeName(s, value) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func matchesTypeName(name string, value any) bool {
+	switch name {
+	case "integer":
+		n, ok := value.(float64)
+		return ok && n == math.Trunc(n)
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	}
+	return jsonTypeName(value) == name
+}
+
+func jsonTypeName(value any) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return "unknown"
+}
@@ -0,0 +1,71 @@
+package types
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestJSONSchemaValidate(t *testing.T) {
+	const person = `{
+		"type": "object",
+		"properties": {
+			"name": {"type": "string", "minLength": 1},
+			"age": {"type": "integer", "minimum": 0},
+			"role": {"enum": ["admin", "user"]},
+			"address": {
+				"type": "object",
+				"properties": {"city": {"type": "string"}},
+				"required": ["city"],
+				"additionalProperties": false
+			},
+			"tags": {"type": "array", "items": {"type": "string"}, "maxItems": 2}
+		},
+		"required": ["name", "age"],
+		"additionalProperties": false
+	}`
+
+	tests := []struct {
+		name   string
+		schema string
+		value  string
+		errs   []string // 每条期望的错误需要作为子串出现，为空表示校验通过
+	}{
+		{name: "valid", schema: person, value: `{"name":"a","age":3,"role":"admin","address":{"city":"x"},"tags":["t"]}`},
+		{name: "root type", schema: person, value: `[]`, errs: []string{"$: expected type object, got array"}},
+		{name: "integer type", schema: person, value: `{"name":"a","age":1.5}`, errs: []string{"$.age: expected type integer"}},
+		{name: "type list", schema: `{"type":["string","null"]}`, value: `null`},
+		{name: "missing required", schema: person, value: `{"name":"a"}`, errs: []string{`$: missing required property "age"`}},
+		{name: "enum", schema: person, value: `{"name":"a","age":1,"role":"root"}`, errs: []string{"$.role: value is not one of the allowed values"}},
+		{name: "additional properties false", schema: person, value: `{"name":"a","age":1,"extra":true}`, errs: []string{`$: unexpected property "extra"`}},
+		{name: "additional properties schema", schema: `{"type":"object","additionalProperties":{"type":"number"}}`, value: `{"a":1,"b":"x"}`, errs: []string{"$.b: expected type number, got string"}},
+		{name: "nested required", schema: person, value: `{"name":"a","age":1,"address":{}}`, errs: []string{`$.address: missing required property "city"`}},
+		{name: "nested additional", schema: person, value: `{"name":"a","age":1,"address":{"city":"x","zip":"1"}}`, errs: []string{`$.address: unexpected property "zip"`}},
+		{name: "array items", schema: person, value: `{"name":"a","age":1,"tags":["x",2]}`, errs: []string{"$.tags[1]: expected type string, got number"}},
+		{name: "max items", schema: person, value: `{"name":"a","age":1,"tags":["x","y","z"]}`, errs: []string{"$.tags: array must have at most 2 items"}},
+		{name: "array of objects", schema: `{"type":"array","items":{"type":"object","required":["id"]}}`, value: `[{"id":1},{}]`, errs: []string{`$[1]: missing required property "id"`}},
+		{name: "ref", schema: `{"$defs":{"id":{"type":"integer"}},"type":"object","properties":{"id":{"$ref":"#/$defs/id"}}}`, value: `{"id":"x"}`, errs: []string{"$.id: expected type integer, got string"}},
+		{name: "multiple errors", schema: person, value: `{"name":"","age":-1}`, errs: []string{"$.age: value must be >= 0", "$.name: string is shorter than 1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schema, err := ParseJSONSchema([]byte(tt.schema))
+			if err != nil {
+				t.Fatalf("parse schema: %v", err)
+			}
+			var value any
+			if err := json.Unmarshal([]byte(tt.value), &value); err != nil {
+				t.Fatalf("parse value: %v", err)
+			}
+			errs := schema.Validate(value)
+			if len(errs) != len(tt.errs) {
+				t.Fatalf("errors = %q, want %q", errs, tt.errs)
+			}
+			for i, want := range tt.errs {
+				if !strings.Contains(errs[i], want) {
+					t.Errorf("error %d = %q, want %q", i, errs[i], want)
+				}
+			}
+		})
+	}
+}
@@ -6,24 +6,24 @@ import (
 )
 
 // LRUCache 带 LRU 淘汰策略的缓存，防止内存无限增长
-type LRUCache struct {
+type LRUCache[V any] struct {
 	capacity int
 	mu       sync.Mutex
 	cache    map[string]*list.Element
 	lru      *list.List
 }
 
-type cacheEntry struct {
+type cacheEntry[V any] struct {
 	key   string
-	value *FileInfo
+	value V
 }
 
 // NewLRUCache 创建容量限制的 LRU 缓存
-func NewLRUCache(capacity int) *LRUCache {
+func NewLRUCache[V any](capacity int) *LRUCache[V] {
 	if capacity <= 0 {
 		capacity = 1000
 	}
-	return &LRUCache{
+	return &LRUCache[V]{
 		capacity: capacity,
 		cache:    make(map[string]*list.Element, capacity),
 		lru:      list.New(),
@@ -31,25 +31,26 @@ func NewLRUCache(capacity int) *LRUCache {
 }
 
 // Load 获取缓存值，若存在则移至最近使用
-func (c *LRUCache) Load(key string) (*FileInfo, bool) {
+func (c *LRUCache[V]) Load(key string) (V, bool) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
 	if elem, ok := c.cache[key]; ok {
 		c.lru.MoveToFront(elem)
-		return elem.Value.(*cacheEntry).value, true
+		return elem.Value.(*cacheEntry[V]).value, true
 	}
-	return nil, false
+	var zero V
+	return zero, false
 }
 
 // Store 存入缓存，若超出容量则淘汰最久未使用的项
-func (c *LRUCache) Store(key string, value *FileInfo) {
+func (c *LRUCache[V]) Store(key string, value V) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
 	if elem, ok := c.cache[key]; ok {
 		c.lru.MoveToFront(elem)
-		elem.Value.(*cacheEntry).value = value
+		elem.Value.(*cacheEntry[V]).value = value
 		return
 	}
 
@@ -58,10 +59,10 @@ func (c *LRUCache) Store(key string, value *FileInfo) {
 		oldest := c.lru.Back()
 		if oldest != nil {
 			c.lru.Remove(oldest)
-			delete(c.cache, oldest.Value.(*cacheEntry).key)
+			delete(c.cache, oldest.Value.(*cacheEntry[V]).key)
 		}
 	}
 
-	elem := c.lru.PushFront(&cacheEntry{key: key, value: value})
+	elem := c.lru.PushFront(&cacheEntry[V]{key: key, value: value})
 	c.cache[key] = elem
 }
@@ -2,8 +2,12 @@ package types
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"log"
+	"monica-proxy/internal/account"
 	"monica-proxy/internal/config"
 	"sync"
 
@@ -197,12 +201,23 @@ type FileBatchGetResponse struct {
 
 // OpenAIModel represents a model in the OpenAI API format
 type OpenAIModel struct {
-	ID              string `json:"id"`
-	Object          string `json:"object"`
-	BotUid          string `json:"-"`
-	Origin          string `json:"-"`
-	OriginPageTitle string `json:"-"`
-	OwnedBy         string `json:"owned_by"`
+	ID              string            `json:"id"`
+	Object          string            `json:"object"`
+	BotUid          string            `json:"-"`
+	Origin          string            `json:"-"`
+	OriginPageTitle string            `json:"-"`
+	OwnedBy         string            `json:"owned_by"`
+	Capabilities    ModelCapabilities `json:"capabilities"` // 扩展字段，OpenAI 原生接口没有
+}
+
+// ModelCapabilities 模型能力，用于请求校验，同时作为扩展字段出现在模型列表中
+type ModelCapabilities struct {
+	Vision          bool `json:"vision"`            // 支持图片输入
+	ImageGeneration bool `json:"image_generation"`  // 支持生成图片
+	Reasoning       bool `json:"reasoning"`         // 支持推理（思考）
+	WebSearch       bool `json:"web_search"`        // 支持联网搜索
+	ContextWindow   int  `json:"context_window"`    // 上下文窗口（token）
+	MaxOutputTokens int  `json:"max_output_tokens"` // 最大输出 token，0 表示不适用
 }
 
 // OpenAIModelList represents the response format for the /v1/models endpoint
@@ -212,36 +227,36 @@ type OpenAIModelList struct {
 }
 
 var modelMap = map[string]OpenAIModel{
-	"gpt-5":                         {Object: "model", OwnedBy: "monica", BotUid: "gpt_5", Origin: "https://monica.im/home/chat/GPT-5/gpt_5", OriginPageTitle: "GPT-5 - Monica 智能体"},
-	"gpt-5.1":                       {Object: "model", OwnedBy: "monica", BotUid: "gpt_5_1", Origin: "https://monica.im/home/chat/GPT-5.1/gpt_5_1", OriginPageTitle: "GPT-5.1 - Monica 智能体"},
-	"gpt-5.2":                       {Object: "model", OwnedBy: "monica", BotUid: "gpt_5_2", Origin: "https://monica.im/home/chat/GPT-5.2/gpt_5_2", OriginPageTitle: "GPT-5.2 - Monica 智能体"},
-	"gpt-5.5":                       {Object: "model", OwnedBy: "monica", BotUid: "monica", Origin: "https://monica.im/home/chat/Monica/monica", OriginPageTitle: "聊天 - Monica"},
-	"gpt-4o":                        {Object: "model", OwnedBy: "monica", BotUid: "gpt_4_o_mini_chat", Origin: "https://monica.im/home/chat/gpt-4o/gpt_4_o_chat", OriginPageTitle: "GPT-4o - Monica 智能体"},
-	"gpt-4.1":                       {Object: "model", OwnedBy: "monica", BotUid: "gpt_4_1", Origin: "https://monica.im/home/chat/GPT-4.1/gpt_4_1", OriginPageTitle: "GPT-4.1 - Monica 智能体"},
-	"gpt-4.5-preview":               {Object: "model", OwnedBy: "monica", BotUid: "gpt_4_5_chat", Origin: "https://monica.im/home/chat/GPT-4.5/gpt_4_5_chat", OriginPageTitle: "GPT-4.5 - Monica 智能体"},
-	"openai-o1":                     {Object: "model", OwnedBy: "monica", BotUid: "openai_o1", Origin: "https://monica.im/home/chat/o1/openai_o1", OriginPageTitle: "o1 - Monica 智能体"},
-	"openai-o-3-mini":               {Object: "model", OwnedBy: "monica", BotUid: "openai_o_3_mini", Origin: "https://monica.im/home/chat/o3-mini/openai_o_3_mini", OriginPageTitle: "o3-mini - Monica 智能体"},
-	"gpt-4o-mini":                   {Object: "model", OwnedBy: "monica", BotUid: "gpt_4_o_mini_chat", Origin: "https://monica.im/home/chat/gpt-4o-mini/gpt_4_o_mini_chat", OriginPageTitle: "GPT-4o mini - Monica 智能体"},
-	"dall-e-3":                      {Object: "model", OwnedBy: "monica", BotUid: "dall_e_3_chat", Origin: "https://monica.im/home/chat/DALL%C2%B7E%203/dall_e_3_chat", OriginPageTitle: "DALL·E 3 - Monica 智能体"},
-	"grok-3-beta":                   {Object: "model", OwnedBy: "monica", BotUid: "grok_3_beta", Origin: "https://monica.im/home/chat/Grok%203/grok_3_beta", OriginPageTitle: "Grok 3 - Monica 智能体"},
-	"grok-4-0709":                   {Object: "model", OwnedBy: "monica", BotUid: "grok_4", Origin: "https://monica.im/home/chat/Grok%204/grok_4", OriginPageTitle: "Grok 4 - Monica 智能体"},
-	"claude-3.5-haiku":              {Object: "model", OwnedBy: "monica", BotUid: "claude_3.5_haiku", Origin: "https://monica.im/home/chat/Claude%203.5%20Haiku/claude_3.5_haiku", OriginPageTitle: "Claude 3.5 Haiku - Monica 智能体"},
-	"claude-3.5-sonnet":             {Object: "model", OwnedBy: "monica", BotUid: "claude_3.5_sonnet", Origin: "https://monica.im/home/chat/Claude%203.5%20Sonnet%20V2/claude_3.5_sonnet", OriginPageTitle: "Claude 3.5 Sonnet V2 - Monica 智能体"},
-	"claude-3.7-sonnet":             {Object: "model", OwnedBy: "monica", BotUid: "claude_3_7_sonnet", Origin: "https://monica.im/home/chat/Claude%203.7%20Sonnet/claude_3_7_sonnet", OriginPageTitle: "Claude 3.7 Sonnet - Monica 智能体"},
-	"claude-3.7-sonnet-thinking":    {Object: "model", OwnedBy: "monica", BotUid: "claude_3_7_sonnet_think", Origin: "https://monica.im/home/chat/Claude%203.7%20Sonnet%20Thinking/claude_3_7_sonnet_think", OriginPageTitle: "Claude 3.7 Sonnet Thinking - Monica 智能体"},
-	"claude-4-sonnet":               {Object: "model", OwnedBy: "monica", BotUid: "claude_4_sonnet", Origin: "https://monica.im/home/chat/claude-4-sonnet/claude_4_sonnet", OriginPageTitle: "Claude 4 Sonnet - Monica 智能体"},
-	"claude-4-opus":                 {Object: "model", OwnedBy: "monica", BotUid: "claude_4_opus", Origin: "https://monica.im/home/chat/Claude%204%20Opus/claude_4_opus", OriginPageTitle: "Claude 4 Opus - Monica 智能体"},
-	"claude-sonnet-4-5":             {Object: "model", OwnedBy: "monica", BotUid: "claude_4_5_sonnet", Origin: "https://monica.im/home/chat/Claude%204.5%20Sonnet/claude_4_5_sonnet", OriginPageTitle: "Claude 4.5 Sonnet - Monica 智能体"},
-	"claude-sonnet-4-6":             {Object: "model", OwnedBy: "monica", BotUid: "claude_4_6_sonnet", Origin: "https://monica.im/home/chat/Claude%204.6%20Sonnet/claude_4_6_sonnet", OriginPageTitle: "Claude 4.6 Sonnet - Monica 智能体"},
-	"deepclaude":                    {Object: "model", OwnedBy: "monica", BotUid: "deepclaude", Origin: "https://monica.im/home/chat/DeepClaude/deepclaude", OriginPageTitle: "DeepClaude - Monica 智能体"},
-	"gemini-2.5-pro":                {Object: "model", OwnedBy: "monica", BotUid: "gemini_2_5_pro", Origin: "https://monica.im/home/chat/Gemini%202.5%20Pro/gemini_2_5_pro", OriginPageTitle: "Gemini 2.5 Pro - Monica 智能体"},
-	"gemini-2.5-flash":              {Object: "model", OwnedBy: "monica", BotUid: "gemini_2_5_flash", Origin: "https://monica.im/home/chat/Gemini%202.5%20Flash/gemini_2_5_flash", OriginPageTitle: "Gemini 2.5 Flash - Monica 智能体"},
-	"gemini-3-pro-preview-thinking": {Object: "model", OwnedBy: "monica", BotUid: "gemini_3_pro_preview_think", Origin: "https://monica.im/home/chat/Gemini%203%20Pro/gemini_3_pro_preview_think", OriginPageTitle: "Gemini 3 Pro - Monica 智能体"},
-	"gemini-3.5-flash-thinking":     {Object: "model", OwnedBy: "monica", BotUid: "gemini_3_5_flash", Origin: "https://monica.im/home/chat/Gemini%203.5%20Flash/gemini_3_5_flash", OriginPageTitle: "Gemini 3.5 Flash - Monica 智能体"},
-	"deepseek-chat":                 {Object: "model", OwnedBy: "monica", BotUid: "deepseek_chat", Origin: "https://monica.im/home/chat/DeepSeek%20V3/deepseek_chat", OriginPageTitle: "DeepSeek V3 - Monica 智能体"},
-	"deepseek-reasoner":             {Object: "model", OwnedBy: "monica", BotUid: "deepseek_reasoner", Origin: "https://monica.im/home/chat/DeepSeek%20R1/deepseek_reasoner", OriginPageTitle: "DeepSeek R1 - Monica 智能体"},
-	"llama-3.3-70b":                 {Object: "model", OwnedBy: "monica", BotUid: "llama_3_3_70b", Origin: "https://monica.im/home/chat/Llama%203.3%2070B/llama_3_3_70b", OriginPageTitle: "Llama 3.3 70B - Monica 智能体"},
-	"llama-3.1-405b":                {Object: "model", OwnedBy: "monica", BotUid: "llama_3_1_405b", Origin: "https://monica.im/home/chat/Llama%203.1%20405B/llama_3_1_405b", OriginPageTitle: "Llama 3.1 405B - Monica 智能体"},
+	"gpt-5":                         {Object: "model", OwnedBy: "monica", BotUid: "gpt_5", Origin: "https://monica.im/home/chat/GPT-5/gpt_5", OriginPageTitle: "GPT-5 - Monica 智能体", Capabilities: ModelCapabilities{Vision: true, Reasoning: true, WebSearch: true, ContextWindow: 400000, MaxOutputTokens: 128000}},
+	"gpt-5.1":                       {Object: "model", OwnedBy: "monica", BotUid: "gpt_5_1", Origin: "https://monica.im/home/chat/GPT-5.1/gpt_5_1", OriginPageTitle: "GPT-5.1 - Monica 智能体", Capabilities: ModelCapabilities{Vision: true, Reasoning: true, WebSearch: true, ContextWindow: 400000, MaxOutputTokens: 128000}},
+	"gpt-5.2":                       {Object: "model", OwnedBy: "monica", BotUid: "gpt_5_2", Origin: "https://monica.im/home/chat/GPT-5.2/gpt_5_2", OriginPageTitle: "GPT-5.2 - Monica 智能体", Capabilities: ModelCapabilities{Vision: true, Reasoning: true, WebSearch: true, ContextWindow: 400000, MaxOutputTokens: 128000}},
+	"gpt-5.5":                       {Object: "model", OwnedBy: "monica", BotUid: "monica", Origin: "https://monica.im/home/chat/Monica/monica", OriginPageTitle: "聊天 - Monica", Capabilities: ModelCapabilities{Vision: true, Reasoning: true, WebSearch: true, ContextWindow: 400000, MaxOutputTokens: 128000}},
+	"gpt-4o":                        {Object: "model", OwnedBy: "monica", BotUid: "gpt_4_o_mini_chat", Origin: "https://monica.im/home/chat/gpt-4o/gpt_4_o_chat", OriginPageTitle: "GPT-4o - Monica 智能体", Capabilities: ModelCapabilities{Vision: true, WebSearch: true, ContextWindow: 128000, MaxOutputTokens: 16384}},
+	"gpt-4.1":                       {Object: "model", OwnedBy: "monica", BotUid: "gpt_4_1", Origin: "https://monica.im/home/chat/GPT-4.1/gpt_4_1", OriginPageTitle: "GPT-4.1 - Monica 智能体", Capabilities: ModelCapabilities{Vision: true, WebSearch: true, ContextWindow: 1047576, MaxOutputTokens: 32768}},
+	"gpt-4.5-preview":               {Object: "model", OwnedBy: "monica", BotUid: "gpt_4_5_chat", Origin: "https://monica.im/home/chat/GPT-4.5/gpt_4_5_chat", OriginPageTitle: "GPT-4.5 - Monica 智能体", Capabilities: ModelCapabilities{Vision: true, WebSearch: true, ContextWindow: 128000, MaxOutputTokens: 16384}},
+	"openai-o1":                     {Object: "model", OwnedBy: "monica", BotUid: "openai_o1", Origin: "https://monica.im/home/chat/o1/openai_o1", OriginPageTitle: "o1 - Monica 智能体", Capabilities: ModelCapabilities{Vision: true, Reasoning: true, WebSearch: true, ContextWindow: 200000, MaxOutputTokens: 100000}},
+	"openai-o-3-mini":               {Object: "model", OwnedBy: "monica", BotUid: "openai_o_3_mini", Origin: "https://monica.im/home/chat/o3-mini/openai_o_3_mini", OriginPageTitle: "o3-mini - Monica 智能体", Capabilities: ModelCapabilities{Reasoning: true, WebSearch: true, ContextWindow: 200000, MaxOutputTokens: 100000}},
+	"gpt-4o-mini":                   {Object: "model", OwnedBy: "monica", BotUid: "gpt_4_o_mini_chat", Origin: "https://monica.im/home/chat/gpt-4o-mini/gpt_4_o_mini_chat", OriginPageTitle: "GPT-4o mini - Monica 智能体", Capabilities: ModelCapabilities{Vision: true, WebSearch: true, ContextWindow: 128000, MaxOutputTokens: 16384}},
+	"dall-e-3":                      {Object: "model", OwnedBy: "monica", BotUid: "dall_e_3_chat", Origin: "https://monica.im/home/chat/DALL%C2%B7E%203/dall_e_3_chat", OriginPageTitle: "DALL·E 3 - Monica 智能体", Capabilities: ModelCapabilities{ImageGeneration: true, ContextWindow: 4000}},
+	"grok-3-beta":                   {Object: "model", OwnedBy: "monica", BotUid: "grok_3_beta", Origin: "https://monica.im/home/chat/Grok%203/grok_3_beta", OriginPageTitle: "Grok 3 - Monica 智能体", Capabilities: ModelCapabilities{WebSearch: true, ContextWindow: 131072, MaxOutputTokens: 16384}},
+	"grok-4-0709":                   {Object: "model", OwnedBy: "monica", BotUid: "grok_4", Origin: "https://monica.im/home/chat/Grok%204/grok_4", OriginPageTitle: "Grok 4 - Monica 智能体", Capabilities: ModelCapabilities{Vision: true, Reasoning: true, WebSearch: true, ContextWindow: 256000, MaxOutputTokens: 32768}},
+	"claude-3.5-haiku":              {Object: "model", OwnedBy: "monica", BotUid: "claude_3.5_haiku", Origin: "https://monica.im/home/chat/Claude%203.5%20Haiku/claude_3.5_haiku", OriginPageTitle: "Claude 3.5 Haiku - Monica 智能体", Capabilities: ModelCapabilities{WebSearch: true, ContextWindow: 200000, MaxOutputTokens: 8192}},
+	"claude-3.5-sonnet":             {Object: "model", OwnedBy: "monica", BotUid: "claude_3.5_sonnet", Origin: "https://monica.im/home/chat/Claude%203.5%20Sonnet%20V2/claude_3.5_sonnet", OriginPageTitle: "Claude 3.5 Sonnet V2 - Monica 智能体", Capabilities: ModelCapabilities{Vision: true, WebSearch: true, ContextWindow: 200000, MaxOutputTokens: 8192}},
+	"claude-3.7-sonnet":             {Object: "model", OwnedBy: "monica", BotUid: "claude_3_7_sonnet", Origin: "https://monica.im/home/chat/Claude%203.7%20Sonnet/claude_3_7_sonnet", OriginPageTitle: "Claude 3.7 Sonnet - Monica 智能体", Capabilities: ModelCapabilities{Vision: true, WebSearch: true, ContextWindow: 200000, MaxOutputTokens: 64000}},
+	"claude-3.7-sonnet-thinking":    {Object: "model", OwnedBy: "monica", BotUid: "claude_3_7_sonnet_think", Origin: "https://monica.im/home/chat/Claude%203.7%20Sonnet%20Thinking/claude_3_7_sonnet_think", OriginPageTitle: "Claude 3.7 Sonnet Thinking - Monica 智能体", Capabilities: ModelCapabilities{Vision: true, Reasoning: true, WebSearch: true, ContextWindow: 200000, MaxOutputTokens: 64000}},
+	"claude-4-sonnet":               {Object: "model", OwnedBy: "monica", BotUid: "claude_4_sonnet", Origin: "https://monica.im/home/chat/claude-4-sonnet/claude_4_sonnet", OriginPageTitle: "Claude 4 Sonnet - Monica 智能体", Capabilities: ModelCapabilities{Vision: true, WebSearch: true, ContextWindow: 200000, MaxOutputTokens: 64000}},
+	"claude-4-opus":                 {Object: "model", OwnedBy: "monica", BotUid: "claude_4_opus", Origin: "https://monica.im/home/chat/Claude%204%20Opus/claude_4_opus", OriginPageTitle: "Claude 4 Opus - Monica 智能体", Capabilities: ModelCapabilities{Vision: true, WebSearch: true, ContextWindow: 200000, MaxOutputTokens: 32000}},
+	"claude-sonnet-4-5":             {Object: "model", OwnedBy: "monica", BotUid: "claude_4_5_sonnet", Origin: "https://monica.im/home/chat/Claude%204.5%20Sonnet/claude_4_5_sonnet", OriginPageTitle: "Claude 4.5 Sonnet - Monica 智能体", Capabilities: ModelCapabilities{Vision: true, WebSearch: true, ContextWindow: 200000, MaxOutputTokens: 64000}},
+	"claude-sonnet-4-6":             {Object: "model", OwnedBy: "monica", BotUid: "claude_4_6_sonnet", Origin: "https://monica.im/home/chat/Claude%204.6%20Sonnet/claude_4_6_sonnet", OriginPageTitle: "Claude 4.6 Sonnet - Monica 智能体", Capabilities: ModelCapabilities{Vision: true, WebSearch: true, ContextWindow: 200000, MaxOutputTokens: 64000}},
+	"deepclaude":                    {Object: "model", OwnedBy: "monica", BotUid: "deepclaude", Origin: "https://monica.im/home/chat/DeepClaude/deepclaude", OriginPageTitle: "DeepClaude - Monica 智能体", Capabilities: ModelCapabilities{Reasoning: true, WebSearch: true, ContextWindow: 64000, MaxOutputTokens: 8192}},
+	"gemini-2.5-pro":                {Object: "model", OwnedBy: "monica", BotUid: "gemini_2_5_pro", Origin: "https://monica.im/home/chat/Gemini%202.5%20Pro/gemini_2_5_pro", OriginPageTitle: "Gemini 2.5 Pro - Monica 智能体", Capabilities: ModelCapabilities{Vision: true, Reasoning: true, WebSearch: true, ContextWindow: 1048576, MaxOutputTokens: 65536}},
+	"gemini-2.5-flash":              {Object: "model", OwnedBy: "monica", BotUid: "gemini_2_5_flash", Origin: "https://monica.im/home/chat/Gemini%202.5%20Flash/gemini_2_5_flash", OriginPageTitle: "Gemini 2.5 Flash - Monica 智能体", Capabilities: ModelCapabilities{Vision: true, Reasoning: true, WebSearch: true, ContextWindow: 1048576, MaxOutputTokens: 65536}},
+	"gemini-3-pro-preview-thinking": {Object: "model", OwnedBy: "monica", BotUid: "gemini_3_pro_preview_think", Origin: "https://monica.im/home/chat/Gemini%203%20Pro/gemini_3_pro_preview_think", OriginPageTitle: "Gemini 3 Pro - Monica 智能体", Capabilities: ModelCapabilities{Vision: true, Reasoning: true, WebSearch: true, ContextWindow: 1048576, MaxOutputTokens: 65536}},
+	"gemini-3.5-flash-thinking":     {Object: "model", OwnedBy: "monica", BotUid: "gemini_3_5_flash", Origin: "https://monica.im/home/chat/Gemini%203.5%20Flash/gemini_3_5_flash", OriginPageTitle: "Gemini 3.5 Flash - Monica 智能体", Capabilities: ModelCapabilities{Vision: true, Reasoning: true, WebSearch: true, ContextWindow: 1048576, MaxOutputTokens: 65536}},
+	"deepseek-chat":                 {Object: "model", OwnedBy: "monica", BotUid: "deepseek_chat", Origin: "https://monica.im/home/chat/DeepSeek%20V3/deepseek_chat", OriginPageTitle: "DeepSeek V3 - Monica 智能体", Capabilities: ModelCapabilities{WebSearch: true, ContextWindow: 65536, MaxOutputTokens: 8192}},
+	"deepseek-reasoner":             {Object: "model", OwnedBy: "monica", BotUid: "deepseek_reasoner", Origin: "https://monica.im/home/chat/DeepSeek%20R1/deepseek_reasoner", OriginPageTitle: "DeepSeek R1 - Monica 智能体", Capabilities: ModelCapabilities{Reasoning: true, WebSearch: true, ContextWindow: 65536, MaxOutputTokens: 32768}},
+	"llama-3.3-70b":                 {Object: "model", OwnedBy: "monica", BotUid: "llama_3_3_70b", Origin: "https://monica.im/home/chat/Llama%203.3%2070B/llama_3_3_70b", OriginPageTitle: "Llama 3.3 70B - Monica 智能体", Capabilities: ModelCapabilities{WebSearch: true, ContextWindow: 128000, MaxOutputTokens: 8192}},
+	"llama-3.1-405b":                {Object: "model", OwnedBy: "monica", BotUid: "llama_3_1_405b", Origin: "https://monica.im/home/chat/Llama%203.1%20405B/llama_3_1_405b", OriginPageTitle: "Llama 3.1 405B - Monica 智能体", Capabilities: ModelCapabilities{WebSearch: true, ContextWindow: 128000, MaxOutputTokens: 4096}},
 }
 
 func IsModelSupported(modelName string) bool {
@@ -249,6 +264,13 @@ func IsModelSupported(modelName string) bool {
 	return exists
 }
 
+// GetModel 返回指定模型的信息（包含 ID 与能力）
+func GetModel(modelName string) (OpenAIModel, bool) {
+	model, exists := modelMap[modelName]
+	model.ID = modelName
+	return model, exists
+}
+
 var (
 	cachedModels     OpenAIModelList
 	cachedModelsOnce sync.Once
@@ -270,8 +292,8 @@ func GetSupportedModels() OpenAIModelList {
 	return cachedModels
 }
 
-// ChatGPTToMonica 将 ChatGPTRequest 转换为 MonicaRequest
-func ChatGPTToMonica(chatReq openai.ChatCompletionRequest) (*MonicaRequest, error) {
+// ChatGPTToMonica 将 ChatGPTRequest 转换为 MonicaRequest，图片使用 context 中的账号上传
+func ChatGPTToMonica(ctx context.Context, chatReq openai.ChatCompletionRequest) (*MonicaRequest, error) {
 	if len(chatReq.Messages) == 0 {
 		return nil, fmt.Errorf("empty messages")
 	}
@@ -297,7 +319,8 @@ func ChatGPTToMonica(chatReq openai.ChatCompletionRequest) (*MonicaRequest, erro
 	for _, msg := range chatReq.Messages {
 		if msg.Role == "system" {
 			//monica不支持系统提示词，拼接到用户提示词前面，实现系统提示词效果
-			system_prompt = msg.Content + "\n"
+			//连续的多条系统消息依次拼接
+			system_prompt += messageText(msg) + "\n"
 			continue
 		}
 		var msgContext string
@@ -319,20 +342,32 @@ func ChatGPTToMonica(chatReq openai.ChatCompletionRequest) (*MonicaRequest, erro
 		} else {
 			//拼接用户提示词到系统提示词前面
 			msg.Content = system_prompt + msg.Content
+			if msgContext != "" || len(imgUrl) > 0 {
+				msgContext = system_prompt + msgContext
+			}
 			system_prompt = ""
 		}
 
 		var content ItemContent
 		if len(imgUrl) > 0 {
-			ctx := context.Background()
+			var accountErr error
+			var accountErrOnce sync.Once
 			fileIfoList := lop.Map(imgUrl, func(item *openai.ChatMessageImageURL, _ int) FileInfo {
 				f, err := UploadBase64Image(ctx, item.URL)
 				if err != nil {
 					log.Println(err)
+					// 账号导致的上传失败直接返回，由调用方换账号后重新上传
+					var upErr *account.UpstreamError
+					if errors.As(err, &upErr) && upErr.Retryable() {
+						accountErrOnce.Do(func() { accountErr = err })
+					}
 					return FileInfo{}
 				}
 				return *f
 			})
+			if accountErr != nil {
+				return nil, accountErr
+			}
 
 			content = ItemContent{
 				Type:        "file_with_text",
@@ -389,3 +424,22 @@ func ChatGPTToMonica(chatReq openai.ChatCompletionRequest) (*MonicaRequest, erro
 
 	return mReq, nil
 }
+
+// ConversationKey 从请求推导会话标识，用于把同一会话的后续请求路由到同一账号：
+// 优先使用 user 字段，否则使用截至第一条用户消息的对话前缀的哈希，同一会话的后续轮次前缀不变
+func ConversationKey(req openai.ChatCompletionRequest) string {
+	if req.User != "" {
+		return "user:" + req.User
+	}
+	h := sha256.New()
+	for _, msg := range req.Messages {
+		h.Write([]byte(msg.Role))
+		h.Write([]byte{0})
+		h.Write([]byte(messageText(msg)))
+		h.Write([]byte{0})
+		if msg.Role == openai.ChatMessageRoleUser {
+			return "prefix:" + hex.EncodeToString(h.Sum(nil))[:32]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,268 @@
+package types
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// OllamaOptions 模型参数，仅解析代理可以处理的部分
+type OllamaOptions struct {
+	Temperature float32  `json:"temperature,omitempty"`
+	TopP        float32  `json:"top_p,omitempty"`
+	NumPredict  int      `json:"num_predict,omitempty"`
+	Stop        []string `json:"stop,omitempty"`
+}
+
+// OllamaMessage 对话消息，images 为不带 data URL 前缀的 base64 图片
+type OllamaMessage struct {
+	Role     string   `json:"role"`
+	Content  string   `json:"content"`
+	Thinking string   `json:"thinking,omitempty"`
+	Images   []string `json:"images,omitempty"`
+}
+
+// OllamaChatRequest /api/chat 请求
+type OllamaChatRequest struct {
+	Model    string          `json:"model"`
+	Messages []OllamaMessage `json:"messages"`
+	Stream   *bool           `json:"stream,omitempty"` // Ollama 默认流式返回
+	Think    *bool           `json:"think,omitempty"`
+	Options  *OllamaOptions  `json:"options,omitempty"`
+}
+
+// OllamaGenerateRequest /api/generate 请求
+type OllamaGenerateRequest struct {
+	Model   string         `json:"model"`
+	Prompt  string         `json:"prompt"`
+	Suffix  string         `json:"suffix,omitempty"`
+	System  string         `json:"system,omitempty"`
+	Images  []string       `json:"images,omitempty"`
+	Stream  *bool          `json:"stream,omitempty"`
+	Think   *bool          `json:"think,omitempty"`
+	Options *OllamaOptions `json:"options,omitempty"`
+}
+
+// OllamaShowRequest /api/show 请求，旧版客户端使用 name 字段
+type OllamaShowRequest struct {
+	Model string `json:"model"`
+	Name  string `json:"name"`
+}
+
+// OllamaChatResponse /api/chat 响应行
+type OllamaChatResponse struct {
+	Model     string        `json:"model"`
+	CreatedAt string        `json:"created_at"`
+	Message   OllamaMessage `json:"message"`
+	OllamaDone
+}
+
+// OllamaGenerateResponse /api/generate 响应行
+type OllamaGenerateResponse struct {
+	Model     string `json:"model"`
+	CreatedAt string `json:"created_at"`
+	Response  string `json:"response"`
+	Thinking  string `json:"thinking,omitempty"`
+	OllamaDone
+}
+
+// OllamaDone 结束行附带的统计字段，未结束时只输出 done=false
+type OllamaDone struct {
+	Done               bool   `json:"done"`
+	DoneReason         string `json:"done_reason,omitempty"`
+	TotalDuration      int64  `json:"total_duration,omitempty"`
+	PromptEvalCount    int    `json:"prompt_eval_count,omitempty"`
+	PromptEvalDuration int64  `json:"prompt_eval_duration,omitempty"`
+	EvalCount          int    `json:"eval_count,omitempty"`
+	EvalDuration       int64  `json:"eval_duration,omitempty"`
+}
+
+// OllamaModelDetails 模型详情
+type OllamaModelDetails struct {
+	Format            string   `json:"format"`
+	Family            string   `json:"family"`
+	Families          []string `json:"families"`
+	ParameterSize     string   `json:"parameter_size"`
+	QuantizationLevel string   `json:"quantization_level"`
+}
+
+// OllamaModel /api/tags 中的模型条目
+type OllamaModel struct {
+	Name       string             `json:"name"`
+	Model      string             `json:"model"`
+	ModifiedAt string             `json:"modified_at"`
+	Size       int64              `json:"size"`
+	Digest     string             `json:"digest"`
+	Details    OllamaModelDetails `json:"details"`
+}
+
+// OllamaTagsResponse /api/tags 响应
+type OllamaTagsResponse struct {
+	Models []OllamaModel `json:"models"`
+}
+
+// OllamaShowResponse /api/show 响应
+type OllamaShowResponse struct {
+	Modelfile    string             `json:"modelfile"`
+	Parameters   string             `json:"parameters"`
+	Template     string             `json:"template"`
+	Details      OllamaModelDetails `json:"details"`
+	ModelInfo    map[string]any     `json:"model_info"`
+	Capabilities []string           `json:"capabilities"`
+}
+
+// OllamaModelName 去掉 Ollama 客户端附加的 :latest 标签
+func OllamaModelName(name string) string {
+	return strings.TrimSuffix(name, ":latest")
+}
+
+// OllamaModelDetail 生成模型的 Ollama 详情，family 取 Monica 模型 ID 的前缀
+func OllamaModelDetail(id string) OllamaModelDetails {
+	family, _, _ := strings.Cut(id, "-")
+	return OllamaModelDetails{
+		Format:   "monica",
+		Family:   family,
+		Families: []string{family},
+	}
+}
+
+// OllamaModelShow 生成 /api/show 响应，capabilities 与上下文长度取自模型能力
+func OllamaModelShow(id string) OllamaShowResponse {
+	model, _ := GetModel(id)
+	details := OllamaModelDetail(id)
+	resp := OllamaShowResponse{
+		Details: details,
+		ModelInfo: map[string]any{
+			"general.architecture":             details.Family,
+			details.Family + ".context_length": model.Capabilities.ContextWindow,
+		},
+		Capabilities: []string{"completion"},
+	}
+	if model.Capabilities.Vision {
+		resp.Capabilities = append(resp.Capabilities, "vision")
+	}
+	if model.Capabilities.Reasoning {
+		resp.Capabilities = append(resp.Capabilities, "thinking")
+	}
+	return resp
+}
+
+// GetOllamaModels 将支持的模型列表转换为 /api/tags 格式
+func GetOllamaModels() OllamaTagsResponse {
+	return OllamaModels(GetSupportedModels())
+}
+
+// OllamaModels 将模型列表转换为 /api/tags 格式
+func OllamaModels(models OpenAIModelList) OllamaTagsResponse {
+	resp := OllamaTagsResponse{Models: make([]OllamaModel, 0, len(models.Data))}
+	for _, m := range models.Data {
+		resp.Models = append(resp.Models, OllamaModel{
+			Name:       m.ID + ":latest",
+			Model:      m.ID + ":latest",
+			ModifiedAt: "1970-01-01T00:00:00Z",
+			Digest:     sampleAndHash(m.ID),
+			Details:    OllamaModelDetail(m.ID),
+		})
+	}
+	return resp
+}
+
+// ollamaImageURL 将 Ollama 的裸 base64 图片转换为 data URL，MIME 类型通过文件头识别
+func ollamaImageURL(data string) (string, error) {
+	head := data
+	if len(head) > 1024 {
+		head = head[:1024]
+	}
+	decoded, err := base64.StdEncoding.DecodeString(head[:len(head)/4*4])
+	if err != nil {
+		return "", fmt.Errorf("decode base64 failed: %v", err)
+	}
+	mimeType := http.DetectContentType(decoded)
+	if !SupportedImageTypes[mimeType] {
+		return "", fmt.Errorf("unsupported image type: %s", mimeType)
+	}
+	return fmt.Sprintf("data:%s;base64,%s", mimeType, data), nil
+}
+
+// ollamaChatMessage 转换单条消息，带图片时使用 MultiContent
+func ollamaChatMessage(role, content string, images []string) (openai.ChatCompletionMessage, error) {
+	msg := openai.ChatCompletionMessage{Role: role}
+	if len(images) == 0 {
+		msg.Content = content
+		return msg, nil
+	}
+	if content != "" {
+		msg.MultiContent = append(msg.MultiContent, openai.ChatMessagePart{
+			Type: openai.ChatMessagePartTypeText,
+			Text: content,
+		})
+	}
+	for _, image := range images {
+		url, err := ollamaImageURL(image)
+		if err != nil {
+			return msg, err
+		}
+		msg.MultiContent = append(msg.MultiContent, openai.ChatMessagePart{
+			Type:     openai.ChatMessagePartTypeImageURL,
+			ImageURL: &openai.ChatMessageImageURL{URL: url},
+		})
+	}
+	return msg, nil
+}
+
+func applyOllamaOptions(chatReq *openai.ChatCompletionRequest, options *OllamaOptions) {
+	if options == nil {
+		return
+	}
+	chatReq.Temperature = options.Temperature
+	chatReq.TopP = options.TopP
+	chatReq.MaxTokens = options.NumPredict
+	chatReq.Stop = options.Stop
+}
+
+// OllamaChatToChatGPT 将 /api/chat 请求转换为 OpenAI 请求
+func OllamaChatToChatGPT(req OllamaChatRequest) (openai.ChatCompletionRequest, error) {
+	chatReq := openai.ChatCompletionRequest{Model: OllamaModelName(req.Model)}
+	applyOllamaOptions(&chatReq, req.Options)
+
+	for _, m := range req.Messages {
+		switch m.Role {
+		case "system", "user", "assistant":
+		case "tool":
+			m.Role = openai.ChatMessageRoleUser
+		default:
+			return chatReq, fmt.Errorf("unsupported role: %s", m.Role)
+		}
+		msg, err := ollamaChatMessage(m.Role, m.Content, m.Images)
+		if err != nil {
+			return chatReq, err
+		}
+		chatReq.Messages = append(chatReq.Messages, msg)
+	}
+	return chatReq, nil
+}
+
+// OllamaGenerateToChatGPT 将 /api/generate 请求转换为 OpenAI 请求，prompt 与 suffix 的处理与 /v1/completions 一致
+func OllamaGenerateToChatGPT(req OllamaGenerateRequest) (openai.ChatCompletionRequest, error) {
+	chatReq := CompletionToChatGPT(openai.CompletionRequest{
+		Model:  OllamaModelName(req.Model),
+		Suffix: req.Suffix,
+	}, req.Prompt)
+	applyOllamaOptions(&chatReq, req.Options)
+
+	msg, err := ollamaChatMessage(openai.ChatMessageRoleUser, chatReq.Messages[0].Content, req.Images)
+	if err != nil {
+		return chatReq, err
+	}
+	chatReq.Messages = []openai.ChatCompletionMessage{msg}
+	if req.System != "" {
+		chatReq.Messages = append([]openai.ChatCompletionMessage{{
+			Role:    openai.ChatMessageRoleSystem,
+			Content: req.System,
+		}}, chatReq.Messages...)
+	}
+	return chatReq, nil
+}
@@ -0,0 +1,154 @@
+package types
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// ChatCompletionRequest 在 openai.ChatCompletionRequest 基础上覆盖 response_format 字段：
+// go-openai 中 json_schema.schema 声明为 json.Marshaler 接口，无法直接反序列化
+type ChatCompletionRequest struct {
+	openai.ChatCompletionRequest
+	ResponseFormat *ResponseFormat `json:"response_format,omitempty"`
+}
+
+// ResponseFormat 输出格式要求
+type ResponseFormat struct {
+	Type       string                    `json:"type"` // text / json_object / json_schema
+	JSONSchema *ResponseFormatJSONSchema `json:"json_schema,omitempty"`
+}
+
+// ResponseFormatJSONSchema json_schema 格式的参数
+type ResponseFormatJSONSchema struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Schema      json.RawMessage `json:"schema"`
+	Strict      bool            `json:"strict"`
+}
+
+// JSONFormat 解析后的输出格式约束，由 ResponseFormatToChatGPT 生成
+type JSONFormat struct {
+	Schema *JSONSchema // 为 nil 时只要求输出 JSON 对象（json_object）
+	raw    json.RawMessage
+}
+
+var (
+	thinkBlockPattern = regexp.MustCompile(`(?s)<think>.*?</think>`)
+	codeFencePattern  = regexp.MustCompile("(?s)```(?:json|JSON)?\\s*\\n?(.*?)```")
+)
+
+// ResponseFormatToChatGPT 将 response_format 转换为提示词，追加到对话开头的系统消息中。
+// 返回 nil 表示不需要校验输出（未设置或为 text）
+func ResponseFormatToChatGPT(req *ChatCompletionRequest) (*JSONFormat, error) {
+	if req.ResponseFormat == nil {
+		return nil, nil
+	}
+
+	format := &JSONFormat{}
+	var sb strings.Builder
+	switch req.ResponseFormat.Type {
+	case "", string(openai.ChatCompletionResponseFormatTypeText):
+		return nil, nil
+	case string(openai.ChatCompletionResponseFormatTypeJSONObject):
+		sb.WriteString("# Response format\n\n")
+		sb.WriteString("Respond only with a single valid JSON object. Do not wrap it in code fences and do not add any text before or after it.\n")
+	case string(openai.ChatCompletionResponseFormatTypeJSONSchema):
+		js := req.ResponseFormat.JSONSchema
+		if js == nil || len(js.Schema) == 0 {
+			return nil, fmt.Errorf("response_format.json_schema.schema is required")
+		}
+		schema, err := ParseJSONSchema(js.Schema)
+		if err != nil {
+			return nil, fmt.Errorf("invalid response_format.json_schema.schema: %v", err)
+		}
+		format.Schema = schema
+		format.raw = js.Schema
+
+		sb.WriteString("# Response format\n\n")
+		sb.WriteString("Respond only with a single valid JSON value that conforms to the following JSON Schema")
+		if js.Name != "" {
+			sb.WriteString(fmt.Sprintf(" (%s)", js.Name))
+		}
+		sb.WriteString(". Do not wrap it in code fences and do not add any text before or after it.\n")
+		if js.Description != "" {
+			sb.WriteString(js.Description + "\n")
+		}
+		sb.WriteString("\n<schema>\n")
+		sb.Write(js.Schema)
+		sb.WriteString("\n</schema>\n")
+	default:
+		return nil, fmt.Errorf("unsupported response_format type: %s", req.ResponseFormat.Type)
+	}
+
+	req.Messages = append([]openai.ChatCompletionMessage{{
+		Role:    openai.ChatMessageRoleSystem,
+		Content: sb.String(),
+	}}, req.Messages...)
+	return format, nil
+}
+
+// ExtractJSON 从模型输出中提取 JSON：去掉思考块与代码块标记，取第一个完整的 JSON 值
+func ExtractJSON(output string) (string, error) {
+	text := thinkBlockPattern.ReplaceAllString(output, "")
+	if m := codeFencePattern.FindStringSubmatch(text); m != nil {
+		text = m[1]
+	}
+	text = strings.TrimSpace(text)
+
+	start := strings.IndexAny(text, "{[")
+	if start < 0 {
+		return "", fmt.Errorf("no JSON value found in output")
+	}
+	dec := json.NewDecoder(strings.NewReader(text[start:]))
+	var value json.RawMessage
+	if err := dec.Decode(&value); err != nil {
+		return "", fmt.Errorf("invalid JSON: %v", err)
+	}
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, value); err != nil {
+		return "", fmt.Errorf("invalid JSON: %v", err)
+	}
+	return compact.String(), nil
+}
+
+// Validate 提取并校验模型输出，返回规范化后的 JSON 文本
+func (f *JSONFormat) Validate(output string) (string, error) {
+	text, err := ExtractJSON(output)
+	if err != nil {
+		return "", err
+	}
+	var value any
+	if err := json.Unmarshal([]byte(text), &value); err != nil {
+		return "", fmt.Errorf("invalid JSON: %v", err)
+	}
+	if f.Schema == nil {
+		if _, ok := value.(map[string]any); !ok {
+			return "", fmt.Errorf("output must be a JSON object")
+		}
+		return text, nil
+	}
+	if errs := f.Schema.Validate(value); len(errs) > 0 {
+		return "", fmt.Errorf("output does not match the schema: %s", strings.Join(errs, "; "))
+	}
+	return text, nil
+}
+
+// RepairMessages 生成修正请求：在原对话后追加上一次的错误输出与修正要求
+func (f *JSONFormat) RepairMessages(messages []openai.ChatCompletionMessage, output string, cause error) []openai.ChatCompletionMessage {
+	repaired := make([]openai.ChatCompletionMessage, 0, len(messages)+2)
+	repaired = append(repaired, messages...)
+
+	prompt := fmt.Sprintf("Your previous reply is not acceptable: %v.\nReply again with only the corrected JSON and nothing else.", cause)
+	if f.Schema != nil {
+		prompt += "\nIt must conform to this JSON Schema:\n" + string(f.raw)
+	}
+	return append(repaired,
+		openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: output},
+		openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: prompt},
+	)
+}
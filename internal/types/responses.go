@@ -0,0 +1,335 @@
+package types
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+const responseHistorySize = 500 // 本地保留的历史响应条数，用于 previous_response_id
+
+// responseHistory 记录每个响应结束时的完整对话（不含 instructions），供后续请求通过 previous_response_id 续接。
+// 按 API 密钥 ID 与响应 ID 保存，其他密钥无法读取或续接
+var responseHistory = NewLRUCache[[]openai.ChatCompletionMessage](responseHistorySize)
+
+// ResponsesRequest OpenAI Responses API 请求格式
+type ResponsesRequest struct {
+	Model              string              `json:"model"`
+	Input              ResponsesInput      `json:"input"`
+	Instructions       string              `json:"instructions,omitempty"`
+	Reasoning          *ResponsesReasoning `json:"reasoning,omitempty"`
+	PreviousResponseID string              `json:"previous_response_id,omitempty"`
+	MaxOutputTokens    int                 `json:"max_output_tokens,omitempty"`
+	Temperature        float32             `json:"temperature,omitempty"`
+	TopP               float32             `json:"top_p,omitempty"`
+	Stream             bool                `json:"stream,omitempty"`
+	Store              *bool               `json:"store,omitempty"`
+	User               string              `json:"user,omitempty"`
+	Metadata           map[string]string   `json:"metadata,omitempty"`
+}
+
+// ResponsesReasoning 推理配置
+type ResponsesReasoning struct {
+	Effort  string `json:"effort,omitempty"`
+	Summary string `json:"summary,omitempty"`
+}
+
+// ResponsesInput 兼容字符串与输入项数组两种写法
+type ResponsesInput []ResponsesInputItem
+
+// ResponsesInputItem 输入项，可以是消息或函数调用相关的条目
+type ResponsesInputItem struct {
+	Type      string           `json:"type,omitempty"` // message / function_call / function_call_output
+	Role      string           `json:"role,omitempty"`
+	Content   ResponsesContent `json:"content,omitempty"`
+	CallID    string           `json:"call_id,omitempty"`
+	Name      string           `json:"name,omitempty"`
+	Arguments string           `json:"arguments,omitempty"`
+	Output    string           `json:"output,omitempty"`
+}
+
+// ResponsesContent 兼容字符串与内容数组两种写法
+type ResponsesContent []ResponsesContentPart
+
+// ResponsesContentPart 输入内容
+type ResponsesContentPart struct {
+	Type     string `json:"type"` // input_text / output_text / input_image
+	Text     string `json:"text,omitempty"`
+	ImageURL string `json:"image_url,omitempty"`
+}
+
+func (in *ResponsesInput) UnmarshalJSON(b []byte) error {
+	var text string
+	if err := json.Unmarshal(b, &text); err == nil {
+		*in = ResponsesInput{{Type: "message", Role: "user", Content: ResponsesContent{{Type: "input_text", Text: text}}}}
+		return nil
+	}
+	var items []ResponsesInputItem
+	if err := json.Unmarshal(b, &items); err != nil {
+		return err
+	}
+	*in = items
+	return nil
+}
+
+func (c *ResponsesContent) UnmarshalJSON(b []byte) error {
+	var text string
+	if err := json.Unmarshal(b, &text); err == nil {
+		*c = ResponsesContent{{Type: "input_text", Text: text}}
+		return nil
+	}
+	var parts []ResponsesContentPart
+	if err := json.Unmarshal(b, &parts); err != nil {
+		return err
+	}
+	*c = parts
+	return nil
+}
+
+// ResponsesResponse Responses API 响应对象
+type ResponsesResponse struct {
+	ID                 string              `json:"id"`
+	Object             string              `json:"object"`
+	CreatedAt          int64               `json:"created_at"`
+	Status             string              `json:"status"`
+	Error              any                 `json:"error"`
+	IncompleteDetails  any                 `json:"incomplete_details"`
+	Instructions       *string             `json:"instructions"`
+	MaxOutputTokens    *int                `json:"max_output_tokens"`
+	Model              string              `json:"model"`
+	Output             []any               `json:"output"`
+	ParallelToolCalls  bool                `json:"parallel_tool_calls"`
+	PreviousResponseID *string             `json:"previous_response_id"`
+	Reasoning          *ResponsesReasoning `json:"reasoning,omitempty"`
+	Store              bool                `json:"store"`
+	Temperature        float32             `json:"temperature"`
+	TopP               float32             `json:"top_p"`
+	ToolChoice         string              `json:"tool_choice"`
+	Tools              []any               `json:"tools"`
+	Usage              *ResponsesUsage     `json:"usage"`
+	User               string              `json:"user,omitempty"`
+	Metadata           map[string]string   `json:"metadata"`
+}
+
+// ResponsesMessageItem 输出的消息项
+type ResponsesMessageItem struct {
+	ID      string                `json:"id"`
+	Type    string                `json:"type"`
+	Status  string                `json:"status"`
+	Role    string                `json:"role"`
+	Content []ResponsesOutputText `json:"content"`
+}
+
+// ResponsesOutputText 输出文本
+type ResponsesOutputText struct {
+	Type        string `json:"type"`
+	Text        string `json:"text"`
+	Annotations []any  `json:"annotations"`
+}
+
+// ResponsesReasoningItem 输出的推理项，summary 为推理摘要
+type ResponsesReasoningItem struct {
+	ID      string                 `json:"id"`
+	Type    string                 `json:"type"`
+	Summary []ResponsesSummaryText `json:"summary"`
+}
+
+// ResponsesSummaryText 推理摘要文本
+type ResponsesSummaryText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// ResponsesUsage token 用量
+type ResponsesUsage struct {
+	InputTokens         int                          `json:"input_tokens"`
+	InputTokensDetails  ResponsesInputTokensDetails  `json:"input_tokens_details"`
+	OutputTokens        int                          `json:"output_tokens"`
+	OutputTokensDetails ResponsesOutputTokensDetails `json:"output_tokens_details"`
+	TotalTokens         int                          `json:"total_tokens"`
+}
+
+// ResponsesInputTokensDetails 输入 token 明细
+type ResponsesInputTokensDetails struct {
+	CachedTokens int `json:"cached_tokens"`
+}
+
+// ResponsesOutputTokensDetails 输出 token 明细
+type ResponsesOutputTokensDetails struct {
+	ReasoningTokens int `json:"reasoning_tokens"`
+}
+
+// ResponsesResponseEvent response.created / response.in_progress / response.completed 事件
+type ResponsesResponseEvent struct {
+	Type           string            `json:"type"`
+	SequenceNumber int               `json:"sequence_number"`
+	Response       ResponsesResponse `json:"response"`
+}
+
+// ResponsesOutputItemEvent response.output_item.added / response.output_item.done 事件
+type ResponsesOutputItemEvent struct {
+	Type           string `json:"type"`
+	SequenceNumber int    `json:"sequence_number"`
+	OutputIndex    int    `json:"output_index"`
+	Item           any    `json:"item"`
+}
+
+// ResponsesContentPartEvent response.content_part.added / response.content_part.done 事件
+type ResponsesContentPartEvent struct {
+	Type           string              `json:"type"`
+	SequenceNumber int                 `json:"sequence_number"`
+	ItemID         string              `json:"item_id"`
+	OutputIndex    int                 `json:"output_index"`
+	ContentIndex   int                 `json:"content_index"`
+	Part           ResponsesOutputText `json:"part"`
+}
+
+// ResponsesTextEvent response.output_text.delta / response.output_text.done 事件
+type ResponsesTextEvent struct {
+	Type           string `json:"type"`
+	SequenceNumber int    `json:"sequence_number"`
+	ItemID         string `json:"item_id"`
+	OutputIndex    int    `json:"output_index"`
+	ContentIndex   int    `json:"content_index"`
+	Delta          string `json:"delta,omitempty"`
+	Text           string `json:"text,omitempty"`
+}
+
+// ResponsesSummaryPartEvent response.reasoning_summary_part.added / done 事件
+type ResponsesSummaryPartEvent struct {
+	Type           string               `json:"type"`
+	SequenceNumber int                  `json:"sequence_number"`
+	ItemID         string               `json:"item_id"`
+	OutputIndex    int                  `json:"output_index"`
+	SummaryIndex   int                  `json:"summary_index"`
+	Part           ResponsesSummaryText `json:"part"`
+}
+
+// ResponsesSummaryTextEvent response.reasoning_summary_text.delta / done 事件
+type ResponsesSummaryTextEvent struct {
+	Type           string `json:"type"`
+	SequenceNumber int    `json:"sequence_number"`
+	ItemID         string `json:"item_id"`
+	OutputIndex    int    `json:"output_index"`
+	SummaryIndex   int    `json:"summary_index"`
+	Delta          string `json:"delta,omitempty"`
+	Text           string `json:"text,omitempty"`
+}
+
+// ResponsesToChatGPT 将 Responses 请求转换为 OpenAI Chat 请求，owner 保存的 previous_response_id 对应的历史对话会拼接在前面。
+// 返回的 history 为不含 instructions 的对话，响应结束后与输出一起通过 SaveResponseHistory 保存。
+func ResponsesToChatGPT(owner string, req ResponsesRequest) (chatReq openai.ChatCompletionRequest, history []openai.ChatCompletionMessage, err error) {
+	chatReq = openai.ChatCompletionRequest{
+		Model:       req.Model,
+		MaxTokens:   req.MaxOutputTokens,
+		Temperature: req.Temperature,
+		TopP:        req.TopP,
+		Stream:      req.Stream,
+		User:        req.User,
+	}
+	if req.Reasoning != nil {
+		chatReq.ReasoningEffort = req.Reasoning.Effort
+	}
+
+	if req.PreviousResponseID != "" {
+		prev, ok := responseHistory.Load(historyKey(owner, req.PreviousResponseID))
+		if !ok {
+			return chatReq, nil, fmt.Errorf("previous response not found: %s", req.PreviousResponseID)
+		}
+		history = append(history, prev...)
+	}
+
+	for _, item := range req.Input {
+		switch item.Type {
+		case "", "message":
+			msg, err := responsesMessage(item)
+			if err != nil {
+				return chatReq, nil, err
+			}
+			history = append(history, msg)
+		case "function_call":
+			// Monica 不支持工具调用，以文本形式保留上下文
+			history = append(history, openai.ChatCompletionMessage{
+				Role:    openai.ChatMessageRoleAssistant,
+				Content: fmt.Sprintf("[function_call %s] %s", item.Name, item.Arguments),
+			})
+		case "function_call_output":
+			history = append(history, openai.ChatCompletionMessage{
+				Role:    openai.ChatMessageRoleUser,
+				Content: fmt.Sprintf("[function_call_output %s] %s", item.CallID, item.Output),
+			})
+		}
+		// reasoning 等其他输入项无需回传给 Monica，直接忽略
+	}
+
+	if req.Instructions != "" {
+		chatReq.Messages = append(chatReq.Messages, openai.ChatCompletionMessage{
+			Role:    openai.ChatMessageRoleSystem,
+			Content: req.Instructions,
+		})
+	}
+	chatReq.Messages = append(chatReq.Messages, history...)
+	return chatReq, history, nil
+}
+
+func responsesMessage(item ResponsesInputItem) (openai.ChatCompletionMessage, error) {
+	role := item.Role
+	switch role {
+	case "user", "assistant", "system":
+	case "developer":
+		role = openai.ChatMessageRoleSystem
+	default:
+		return openai.ChatCompletionMessage{}, fmt.Errorf("unsupported role: %s", item.Role)
+	}
+
+	var texts []string
+	var images []string
+	for _, part := range item.Content {
+		switch part.Type {
+		case "input_text", "output_text":
+			texts = append(texts, part.Text)
+		case "input_image":
+			if part.ImageURL != "" {
+				images = append(images, part.ImageURL)
+			}
+		}
+	}
+
+	msg := openai.ChatCompletionMessage{Role: role}
+	text := strings.Join(texts, "\n")
+	if len(images) == 0 {
+		msg.Content = text
+		return msg, nil
+	}
+	if text != "" {
+		msg.MultiContent = append(msg.MultiContent, openai.ChatMessagePart{
+			Type: openai.ChatMessagePartTypeText,
+			Text: text,
+		})
+	}
+	for _, url := range images {
+		msg.MultiContent = append(msg.MultiContent, openai.ChatMessagePart{
+			Type:     openai.ChatMessagePartTypeImageURL,
+			ImageURL: &openai.ChatMessageImageURL{URL: url},
+		})
+	}
+	return msg, nil
+}
+
+// SaveResponseHistory 保存本轮对话与输出，供 owner 之后通过 previous_response_id 使用
+func SaveResponseHistory(owner, id string, history []openai.ChatCompletionMessage, output string) {
+	turns := make([]openai.ChatCompletionMessage, 0, len(history)+1)
+	turns = append(turns, history...)
+	turns = append(turns, openai.ChatCompletionMessage{
+		Role:    openai.ChatMessageRoleAssistant,
+		Content: output,
+	})
+	responseHistory.Store(historyKey(owner, id), turns)
+}
+
+// historyKey 历史对话的缓存键，owner 为 API 密钥 ID
+func historyKey(owner, id string) string {
+	return owner + "\x00" + id
+}
@@ -0,0 +1,28 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestResponseHistoryScopedByOwner(t *testing.T) {
+	history := []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "secret question"}}
+	SaveResponseHistory("key_a", "resp_test", history, "secret answer")
+
+	req := ResponsesRequest{
+		Model:              "gpt-4o",
+		PreviousResponseID: "resp_test",
+		Input:              ResponsesInput{{Type: "message", Role: "user", Content: ResponsesContent{{Type: "input_text", Text: "go on"}}}},
+	}
+	if _, _, err := ResponsesToChatGPT("key_b", req); err == nil {
+		t.Fatal("another api key continued the conversation")
+	}
+	chatReq, _, err := ResponsesToChatGPT("key_a", req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chatReq.Messages) != 3 || chatReq.Messages[1].Content != "secret answer" {
+		t.Fatalf("messages = %+v, want previous turns followed by the new input", chatReq.Messages)
+	}
+}
@@ -0,0 +1,273 @@
+package types
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// 模型输出工具调用时使用的标记，内部为 JSON 数组
+const (
+	ToolCallsOpenTag  = "<tool_calls>"
+	ToolCallsCloseTag = "</tool_calls>"
+)
+
+// ToolEmulation 工具调用模拟参数，由 ToolsToChatGPT 生成，用于解析模型输出
+type ToolEmulation struct {
+	Parallel bool            // 是否允许一次返回多个调用
+	Names    map[string]bool // 允许调用的工具名
+}
+
+// EmulatedToolCall 模型输出中的单个工具调用
+type EmulatedToolCall struct {
+	Name      string          `json:"name"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+// toolDescription 渲染到提示词中的工具描述
+type toolDescription struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Parameters  any    `json:"parameters,omitempty"`
+}
+
+// parseToolChoice 解析 tool_choice，返回模式（none / auto / required）与指定的工具名
+func parseToolChoice(choice any) (mode, name string, err error) {
+	switch v := choice.(type) {
+	case nil:
+		return "auto", "", nil
+	case string:
+		switch v {
+		case "none", "auto", "required":
+			return v, "", nil
+		}
+		return "", "", fmt.Errorf("invalid tool_choice: %s", v)
+	case map[string]any:
+		if fn, ok := v["function"].(map[string]any); ok {
+			if name, ok := fn["name"].(string); ok && name != "" {
+				return "required", name, nil
+			}
+		}
+		return "", "", fmt.Errorf("tool_choice.function.name is required")
+	}
+	return "", "", fmt.Errorf("invalid tool_choice")
+}
+
+// renderToolPrompt 生成工具说明提示词
+func renderToolPrompt(tools []toolDescription, mode, name string, parallel bool) (string, error) {
+	schema, err := json.MarshalIndent(tools, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("marshal tools failed: %v", err)
+	}
+
+	var sb strings.Builder
+	sb.WriteString("# Tools\n\n")
+	sb.WriteString("You have access to the following tools. Each tool's parameters are described with JSON Schema:\n\n")
+	sb.WriteString("<tools>\n")
+	sb.Write(schema)
+	sb.WriteString("\n</tools>\n\n")
+	sb.WriteString("To call tools, reply with the following block and stop immediately after it:\n")
+	sb.WriteString(ToolCallsOpenTag + "\n")
+	sb.WriteString(`[{"name": "tool_name", "arguments": {"param": "value"}}]` + "\n")
+	sb.WriteString(ToolCallsCloseTag + "\n")
+	sb.WriteString("The block must contain a valid JSON array. \"name\" must come first and \"arguments\" must be a JSON object matching the tool's parameters.\n")
+	if parallel {
+		sb.WriteString("You may call several tools at once by adding more objects to the array.\n")
+	} else {
+		sb.WriteString("Call at most one tool per reply.\n")
+	}
+	switch {
+	case name != "":
+		sb.WriteString(fmt.Sprintf("You must call the tool `%s` in this reply.\n", name))
+	case mode == "required":
+		sb.WriteString("You must call at least one tool in this reply.\n")
+	default:
+		sb.WriteString("If no tool is needed, answer directly without the block.\n")
+	}
+	sb.WriteString("Tool results are returned to you in <tool_result> blocks.\n")
+	return sb.String(), nil
+}
+
+// renderToolCalls 将历史消息中的工具调用渲染为模型输出格式
+func renderToolCalls(calls []openai.ToolCall) string {
+	emulated := make([]EmulatedToolCall, 0, len(calls))
+	for _, call := range calls {
+		args := json.RawMessage(call.Function.Arguments)
+		if !json.Valid(args) {
+			args, _ = json.Marshal(call.Function.Arguments)
+		}
+		emulated = append(emulated, EmulatedToolCall{Name: call.Function.Name, Arguments: args})
+	}
+	b, _ := json.Marshal(emulated)
+	return ToolCallsOpenTag + "\n" + string(b) + "\n" + ToolCallsCloseTag
+}
+
+// messageText 返回消息的文本内容，MultiContent 时拼接所有文本片段
+func messageText(msg openai.ChatCompletionMessage) string {
+	if len(msg.MultiContent) == 0 {
+		return msg.Content
+	}
+	var texts []string
+	for _, part := range msg.MultiContent {
+		if part.Type == openai.ChatMessagePartTypeText {
+			texts = append(texts, part.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// ToolsToChatGPT 将工具定义与工具调用历史改写为 Monica 可以理解的纯文本对话。
+// 返回 nil 表示不需要解析模型输出中的工具调用（没有工具或 tool_choice 为 none）
+func ToolsToChatGPT(req *openai.ChatCompletionRequest) (*ToolEmulation, error) {
+	mode, name, err := parseToolChoice(req.ToolChoice)
+	if err != nil {
+		return nil, err
+	}
+
+	// 改写历史中的工具调用与工具结果，连续的工具结果合并为一条用户消息
+	callNames := make(map[string]string)
+	messages := make([]openai.ChatCompletionMessage, 0, len(req.Messages))
+	for _, msg := range req.Messages {
+		switch {
+		case msg.Role == openai.ChatMessageRoleAssistant && len(msg.ToolCalls) > 0:
+			for _, call := range msg.ToolCalls {
+				callNames[call.ID] = call.Function.Name
+			}
+			content := renderToolCalls(msg.ToolCalls)
+			if text := messageText(msg); text != "" {
+				content = text + "\n" + content
+			}
+			messages = append(messages, openai.ChatCompletionMessage{Role: msg.Role, Content: content})
+		case msg.Role == openai.ChatMessageRoleTool || msg.Role == openai.ChatMessageRoleFunction:
+			toolName := msg.Name
+			if toolName == "" {
+				toolName = callNames[msg.ToolCallID]
+			}
+			result := fmt.Sprintf("<tool_result name=%q tool_call_id=%q>\n%s\n</tool_result>", toolName, msg.ToolCallID, messageText(msg))
+			if last := len(messages) - 1; last >= 0 && messages[last].Role == openai.ChatMessageRoleUser && strings.HasPrefix(messages[last].Content, "<tool_result") {
+				messages[last].Content += "\n" + result
+				continue
+			}
+			messages = append(messages, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: result})
+		default:
+			messages = append(messages, msg)
+		}
+	}
+	req.Messages = messages
+
+	if mode == "none" || len(req.Tools) == 0 {
+		if mode == "required" || name != "" {
+			return nil, fmt.Errorf("tool_choice requires tools")
+		}
+		return nil, nil
+	}
+
+	emulation := &ToolEmulation{
+		Parallel: req.ParallelToolCalls != false,
+		Names:    make(map[string]bool),
+	}
+	var tools []toolDescription
+	for _, tool := range req.Tools {
+		if tool.Type != openai.ToolTypeFunction || tool.Function == nil {
+			return nil, fmt.Errorf("unsupported tool type: %s", tool.Type)
+		}
+		if name != "" && tool.Function.Name != name {
+			continue
+		}
+		emulation.Names[tool.Function.Name] = true
+		tools = append(tools, toolDescription{
+			Name:        tool.Function.Name,
+			Description: tool.Function.Description,
+			Parameters:  tool.Function.Parameters,
+		})
+	}
+	if len(tools) == 0 {
+		return nil, fmt.Errorf("tool_choice refers to unknown function: %s", name)
+	}
+
+	prompt, err := renderToolPrompt(tools, mode, name, emulation.Parallel)
+	if err != nil {
+		return nil, err
+	}
+	// 工具说明作为第一条系统消息，已有的系统消息保持在其后
+	req.Messages = append([]openai.ChatCompletionMessage{{
+		Role:    openai.ChatMessageRoleSystem,
+		Content: prompt,
+	}}, req.Messages...)
+	return emulation, nil
+}
+
+// ParseToolCalls 从模型输出中解析工具调用，返回标记之前的正文与调用列表。
+// 没有标记或解析失败时原样返回正文
+func (t *ToolEmulation) ParseToolCalls(output string) (string, []EmulatedToolCall) {
+	start := strings.Index(output, ToolCallsOpenTag)
+	if start < 0 {
+		return output, nil
+	}
+	body := output[start+len(ToolCallsOpenTag):]
+	if end := strings.Index(body, ToolCallsCloseTag); end >= 0 {
+		body = body[:end]
+	}
+	calls := t.Filter(decodeToolCalls(body))
+	if len(calls) == 0 {
+		return output, nil
+	}
+	return strings.TrimSpace(output[:start]), calls
+}
+
+// Filter 去掉不允许调用的工具，不允许并行时只保留第一个调用
+func (t *ToolEmulation) Filter(calls []EmulatedToolCall) []EmulatedToolCall {
+	var filtered []EmulatedToolCall
+	for _, call := range calls {
+		if !t.Names[call.Name] {
+			continue
+		}
+		if len(call.Arguments) == 0 || string(call.Arguments) == "null" {
+			call.Arguments = json.RawMessage("{}")
+		}
+		filtered = append(filtered, call)
+		if !t.Parallel {
+			break
+		}
+	}
+	return filtered
+}
+
+// decodeToolCalls 解析工具调用 JSON，兼容单个对象与代码块包裹的写法
+func decodeToolCalls(body string) []EmulatedToolCall {
+	body = strings.TrimSpace(body)
+	body = strings.TrimPrefix(body, "```json")
+	body = strings.TrimPrefix(body, "```")
+	body = strings.TrimSuffix(body, "```")
+	body = strings.TrimSpace(body)
+
+	var calls []EmulatedToolCall
+	if err := json.Unmarshal([]byte(body), &calls); err == nil {
+		return calls
+	}
+	var call EmulatedToolCall
+	if err := json.Unmarshal([]byte(body), &call); err == nil {
+		return []EmulatedToolCall{call}
+	}
+	return nil
+}
+
+// ToOpenAI 转换为 OpenAI 工具调用，arguments 为 JSON 字符串
+func (c EmulatedToolCall) ToOpenAI(id string) openai.ToolCall {
+	args := string(c.Arguments)
+	// 部分模型会把 arguments 写成 JSON 字符串
+	var s string
+	if json.Unmarshal(c.Arguments, &s) == nil && json.Valid([]byte(s)) {
+		args = s
+	}
+	return openai.ToolCall{
+		ID:   id,
+		Type: openai.ToolTypeFunction,
+		Function: openai.FunctionCall{
+			Name:      c.Name,
+			Arguments: args,
+		},
+	}
+}
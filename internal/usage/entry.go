@@ -0,0 +1,90 @@
+package usage
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Entry 正在处理的请求的用量，各条上游连接并发累加，请求结束时写入账本
+type Entry struct {
+	mu       sync.Mutex
+	record   Record
+	start    time.Time
+	reserved map[counterKey]int64 // 配额检查时在账本中预留的 token
+}
+
+// NewEntry 开始记录一次请求
+func NewEntry(keyID, endpoint string) *Entry {
+	now := time.Now()
+	return &Entry{record: Record{Time: now, KeyID: keyID, Endpoint: endpoint}, start: now}
+}
+
+// SetModel 记录实际使用的模型
+func (e *Entry) SetModel(model string) {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.record.Model = model
+}
+
+// AddUpstream 记录一条上游连接的提示词与输出 token 数，账号取第一条连接使用的账号
+func (e *Entry) AddUpstream(accountID string, promptTokens, completionTokens int) {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.record.Account == "" {
+		e.record.Account = accountID
+	}
+	e.record.PromptTokens += promptTokens
+	e.record.CompletionTokens += completionTokens
+	e.record.TotalTokens += promptTokens + completionTokens
+}
+
+// Finish 结束记录，返回带有状态码与耗时的用量
+func (e *Entry) Finish(status int) Record {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.record.Status = status
+	e.record.LatencyMs = time.Since(e.start).Milliseconds()
+	return e.record
+}
+
+// reserve 记录在账本中预留的 token，调用方持有账本的锁
+func (e *Entry) reserve(k counterKey, tokens int64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.reserved == nil {
+		e.reserved = make(map[counterKey]int64)
+	}
+	e.reserved[k] += tokens
+}
+
+// takeReserved 取出并清空预留的 token
+func (e *Entry) takeReserved() map[counterKey]int64 {
+	if e == nil {
+		return nil
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	reserved := e.reserved
+	e.reserved = nil
+	return reserved
+}
+
+type contextKey struct{}
+
+// WithEntry 将本次请求的用量记录放入 context
+func WithEntry(ctx context.Context, e *Entry) context.Context {
+	return context.WithValue(ctx, contextKey{}, e)
+}
+
+// FromContext 返回 context 中的用量记录，不记录用量的请求返回 nil
+func FromContext(ctx context.Context) *Entry {
+	e, _ := ctx.Value(contextKey{}).(*Entry)
+	return e
+}
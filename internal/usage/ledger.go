@@ -0,0 +1,225 @@
+package usage
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Record 一次 API 请求的用量，按行追加到账本文件
+type Record struct {
+	Time             time.Time `json:"time"`
+	KeyID            string    `json:"key_id"`
+	Endpoint         string    `json:"endpoint"`
+	Model            string    `json:"model,omitempty"`
+	Account          string    `json:"account,omitempty"` // 第一条上游连接使用的账号
+	PromptTokens     int       `json:"prompt_tokens"`
+	CompletionTokens int       `json:"completion_tokens"`
+	TotalTokens      int       `json:"total_tokens"`
+	LatencyMs        int64     `json:"latency_ms"`
+	Status           int       `json:"status"`
+}
+
+// counterKey 一个密钥在某个模型组、某个周期内的 token 用量，group 为空表示全部模型
+type counterKey struct {
+	keyID  string
+	group  string
+	period string // "d:2006-01-02" 或 "m:2006-01"
+}
+
+// maxMemoryRecords 没有账本文件时在内存中保留的最近记录数，用于用量报表
+const maxMemoryRecords = 100000
+
+// Ledger 用量账本：JSON Lines 文件只追加写入，启动时扫描文件重建本日与本月的用量计数。
+// path 为空时只在内存中计数并保留最近的记录，重启后清零
+type Ledger struct {
+	path   string
+	quotas *QuotaConfig
+
+	mu       sync.Mutex
+	file     *os.File
+	memory   []Record
+	counters map[counterKey]int64
+	reserved map[counterKey]int64 // 进行中的请求通过配额检查时预留的提示词 token
+	day      string               // 计数对应的日期，跨天时清理过期的计数
+}
+
+// DefaultLedger 全局用量账本，启动时创建
+var DefaultLedger = NewLedger(&QuotaConfig{})
+
+// NewLedger 创建只在内存中计数的账本
+func NewLedger(quotas *QuotaConfig) *Ledger {
+	return &Ledger{quotas: quotas, counters: make(map[counterKey]int64), reserved: make(map[counterKey]int64)}
+}
+
+// OpenLedger 打开账本文件，文件不存在时创建
+func OpenLedger(path string, quotas *QuotaConfig) (*Ledger, error) {
+	l := NewLedger(quotas)
+	if path == "" {
+		return l, nil
+	}
+	l.path = path
+
+	now := time.Now()
+	l.day = dayPeriod(now)
+	err := l.Scan(func(r Record) error {
+		if monthPeriod(r.Time) == monthPeriod(now) {
+			l.countLocked(r)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("open usage ledger failed: %v", err)
+	}
+	l.file = f
+	return l, nil
+}
+
+// Path 返回账本文件路径，只在内存中计数时为空
+func (l *Ledger) Path() string {
+	return l.path
+}
+
+// Append 记录一次请求的用量并写入账本文件，写入失败只输出日志，不影响请求
+func (l *Ledger) Append(r Record) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.countLocked(r)
+	if l.path == "" {
+		if len(l.memory) >= maxMemoryRecords {
+			l.memory = append(l.memory[:0], l.memory[len(l.memory)-maxMemoryRecords+1:]...)
+		}
+		l.memory = append(l.memory, r)
+		return
+	}
+	if l.file == nil {
+		return
+	}
+	line, err := json.Marshal(r)
+	if err != nil {
+		return
+	}
+	if _, err := l.file.Write(append(line, '\n')); err != nil {
+		log.Printf("write usage ledger failed: %v", err)
+	}
+}
+
+// Scan 按写入顺序读取账本中的全部记录，无法解析的行直接跳过
+func (l *Ledger) Scan(fn func(Record) error) error {
+	if l.path == "" {
+		l.mu.Lock()
+		records := append([]Record(nil), l.memory...)
+		l.mu.Unlock()
+		for _, r := range records {
+			if err := fn(r); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	f, err := os.Open(l.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read usage ledger failed: %v", err)
+	}
+	defer f.Close()
+
+	reader := bufio.NewReader(f)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			var r Record
+			if json.Unmarshal(line, &r) == nil {
+				if err := fn(r); err != nil {
+					return err
+				}
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read usage ledger failed: %v", err)
+		}
+	}
+}
+
+// usedLocked 返回密钥在本日与本月对某个模型组已经使用与预留的 token 数
+func (l *Ledger) usedLocked(keyID, group string, now time.Time) (daily, monthly int64) {
+	day, month := counterKey{keyID, group, dayPeriod(now)}, counterKey{keyID, group, monthPeriod(now)}
+	return l.counters[day] + l.reserved[day], l.counters[month] + l.reserved[month]
+}
+
+// Release 释放请求结束前预留的 token，应在 Append 之后调用，实际用量已经计入计数
+func (l *Ledger) Release(e *Entry) {
+	reserved := e.takeReserved()
+	if len(reserved) == 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for k, n := range reserved {
+		if l.reserved[k] -= n; l.reserved[k] <= 0 {
+			delete(l.reserved, k)
+		}
+	}
+}
+
+// countLocked 把记录计入全部模型以及模型所属的各个模型组
+func (l *Ledger) countLocked(r Record) {
+	if r.TotalTokens <= 0 {
+		return
+	}
+	if day := dayPeriod(time.Now()); day != l.day {
+		l.pruneLocked(day)
+	}
+	groups := append([]string{""}, l.quotas.GroupsOf(r.Model)...)
+	for _, group := range groups {
+		l.counters[counterKey{r.KeyID, group, dayPeriod(r.Time)}] += int64(r.TotalTokens)
+		l.counters[counterKey{r.KeyID, group, monthPeriod(r.Time)}] += int64(r.TotalTokens)
+	}
+}
+
+// pruneLocked 跨天时删除之前日期与月份的计数
+func (l *Ledger) pruneLocked(day string) {
+	month := "m:" + day[2:9]
+	for k := range l.counters {
+		if k.period != day && k.period != month {
+			delete(l.counters, k)
+		}
+	}
+	l.day = day
+}
+
+// Close 关闭账本文件
+func (l *Ledger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+func dayPeriod(t time.Time) string {
+	return "d:" + t.Local().Format("2006-01-02")
+}
+
+func monthPeriod(t time.Time) string {
+	return "m:" + t.Local().Format("2006-01")
+}
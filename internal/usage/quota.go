@@ -0,0 +1,162 @@
+package usage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Quota 一个模型组的 token 预算，按服务器时区的自然日与自然月计算，0 表示不限制
+type Quota struct {
+	Group   string `json:"group,omitempty"` // 模型组名称，为空时统计全部模型
+	Daily   int64  `json:"daily_tokens,omitempty"`
+	Monthly int64  `json:"monthly_tokens,omitempty"`
+}
+
+// QuotaConfig 配额配置文件：模型组定义与所有密钥的默认配额，密钥可以按模型组覆盖默认配额
+//
+//	{
+//	  "groups": {"premium": ["claude-4-opus*", "openai-o1*"]},
+//	  "default": [{"daily_tokens": 200000}, {"group": "premium", "monthly_tokens": 100000}]
+//	}
+type QuotaConfig struct {
+	Groups  map[string][]string `json:"groups"`  // 模型组名称到模型通配符的映射
+	Default []Quota             `json:"default"` // 未单独设置配额的密钥使用的配额
+}
+
+// LoadQuotaConfig 读取配额配置文件，file 为空时返回空配置
+func LoadQuotaConfig(file string) (*QuotaConfig, error) {
+	cfg := &QuotaConfig{}
+	if file == "" {
+		return cfg, nil
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("read quota file failed: %v", err)
+	}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("parse quota file failed: %v", err)
+	}
+	for name, patterns := range cfg.Groups {
+		for i, pattern := range patterns {
+			pattern = strings.ToLower(strings.TrimSpace(pattern))
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("invalid model pattern %q in group %s: %v", pattern, name, err)
+			}
+			patterns[i] = pattern
+		}
+	}
+	if err := cfg.Validate(cfg.Default); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Validate 校验配额引用的模型组已经定义
+func (c *QuotaConfig) Validate(quotas []Quota) error {
+	for _, q := range quotas {
+		if q.Daily < 0 || q.Monthly < 0 {
+			return errors.New("quota must not be negative")
+		}
+		if _, ok := c.Groups[q.Group]; q.Group != "" && !ok {
+			return fmt.Errorf("unknown model group: %s", q.Group)
+		}
+	}
+	return nil
+}
+
+// GroupsOf 返回模型所属的全部模型组
+func (c *QuotaConfig) GroupsOf(model string) []string {
+	model = strings.ToLower(model)
+	var groups []string
+	for name, patterns := range c.Groups {
+		for _, pattern := range patterns {
+			if ok, _ := path.Match(pattern, model); ok {
+				groups = append(groups, name)
+				break
+			}
+		}
+	}
+	return groups
+}
+
+// Effective 合并默认配额与密钥自己的配额，密钥的配额覆盖同一模型组的默认配额
+func (c *QuotaConfig) Effective(own []Quota) []Quota {
+	quotas := make([]Quota, 0, len(c.Default)+len(own))
+	for _, q := range c.Default {
+		overridden := false
+		for _, o := range own {
+			if o.Group == q.Group {
+				overridden = true
+				break
+			}
+		}
+		if !overridden {
+			quotas = append(quotas, q)
+		}
+	}
+	return append(quotas, own...)
+}
+
+// QuotaError 超出 token 预算
+type QuotaError struct {
+	Group  string // 为空表示全部模型
+	Period string // daily 或 monthly
+	Limit  int64
+	Used   int64
+}
+
+func (e *QuotaError) Error() string {
+	scope := "all models"
+	if e.Group != "" {
+		scope = "model group " + e.Group
+	}
+	return fmt.Sprintf("You exceeded your %s token quota for %s: used %d of %d tokens.", e.Period, scope, e.Used, e.Limit)
+}
+
+// Check 调用 Monica 前检查配额：已用量加上已预留的与本次提示词的 token 数超过任一适用的预算时拒绝。
+// 通过时在同一把锁内把提示词 token 预留到 e，请求结束时由 Release 释放，避免并发请求在用量写入前同时通过检查
+func (l *Ledger) Check(e *Entry, keyID, model string, own []Quota, promptTokens int) error {
+	quotas := l.quotas.Effective(own)
+	if len(quotas) == 0 {
+		return nil
+	}
+	groups := append([]string{""}, l.quotas.GroupsOf(model)...)
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, q := range quotas {
+		if !slices.Contains(groups, q.Group) {
+			continue
+		}
+		daily, monthly := l.usedLocked(keyID, q.Group, now)
+		if q.Daily > 0 && daily+int64(promptTokens) > q.Daily {
+			return &QuotaError{Group: q.Group, Period: "daily", Limit: q.Daily, Used: daily}
+		}
+		if q.Monthly > 0 && monthly+int64(promptTokens) > q.Monthly {
+			return &QuotaError{Group: q.Group, Period: "monthly", Limit: q.Monthly, Used: monthly}
+		}
+	}
+	if e == nil || promptTokens <= 0 {
+		return nil
+	}
+	for _, group := range groups {
+		for _, period := range []string{dayPeriod(now), monthPeriod(now)} {
+			k := counterKey{keyID, group, period}
+			l.reserved[k] += int64(promptTokens)
+			e.reserve(k, int64(promptTokens))
+		}
+	}
+	return nil
+}
+
+// Quotas 返回配额配置
+func (l *Ledger) Quotas() *QuotaConfig {
+	return l.quotas
+}
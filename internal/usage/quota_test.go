@@ -0,0 +1,52 @@
+package usage
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestCheckReservesPromptTokens(t *testing.T) {
+	l := NewLedger(&QuotaConfig{Default: []Quota{{Daily: 100}}})
+
+	// 并发检查时预留的 token 计入已用量，只有一个请求能通过
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var passed []*Entry
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			e := NewEntry("key", "/v1/chat/completions")
+			if l.Check(e, "key", "gpt-4o", nil, 60) == nil {
+				mu.Lock()
+				passed = append(passed, e)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if len(passed) != 1 {
+		t.Fatalf("%d requests passed the quota check, want 1", len(passed))
+	}
+
+	var qe *QuotaError
+	if err := l.Check(NewEntry("key", ""), "key", "gpt-4o", nil, 60); !errors.As(err, &qe) || qe.Used != 60 {
+		t.Fatalf("err = %v, want QuotaError with 60 tokens used", err)
+	}
+
+	// 请求结束后按实际用量计数，预留释放
+	e := passed[0]
+	e.AddUpstream("acc", 30, 0)
+	l.Append(e.Finish(200))
+	l.Release(e)
+	if err := l.Check(nil, "key", "gpt-4o", nil, 60); err != nil {
+		t.Fatalf("check after release: %v", err)
+	}
+	if err := l.Check(nil, "key", "gpt-4o", nil, 71); err == nil {
+		t.Fatal("check beyond the remaining budget passed")
+	}
+	if len(l.reserved) != 0 {
+		t.Fatalf("reservations left after release: %v", l.reserved)
+	}
+}
@@ -0,0 +1,174 @@
+package usage
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 报表支持的分组维度
+const (
+	GroupByKey     = "key"
+	GroupByModel   = "model"
+	GroupByAccount = "account"
+)
+
+// Query 用量报表的查询条件
+type Query struct {
+	Start   time.Time // 包含
+	End     time.Time // 不包含
+	KeyID   string    // 为空时统计全部密钥
+	GroupBy []string  // key、model、account 的任意组合
+	Bucket  string    // hour、day，为空时不按时间分桶
+}
+
+// ParseGroupBy 解析逗号分隔的分组维度
+func ParseGroupBy(s string) ([]string, error) {
+	var dims []string
+	for _, d := range strings.Split(s, ",") {
+		d = strings.ToLower(strings.TrimSpace(d))
+		if d == "" {
+			continue
+		}
+		switch d {
+		case GroupByKey, GroupByModel, GroupByAccount:
+		default:
+			return nil, fmt.Errorf("unknown group_by: %s", d)
+		}
+		if !slices.Contains(dims, d) {
+			dims = append(dims, d)
+		}
+	}
+	return dims, nil
+}
+
+// Row 一个分组的用量汇总，延迟分位数按最近秩法计算
+type Row struct {
+	Bucket           string `json:"bucket,omitempty"` // 时间桶的起始时间
+	KeyID            string `json:"key_id,omitempty"`
+	Model            string `json:"model,omitempty"`
+	Account          string `json:"account,omitempty"`
+	Requests         int64  `json:"requests"`
+	Errors           int64  `json:"errors"` // 状态码 >= 400 的请求数
+	PromptTokens     int64  `json:"prompt_tokens"`
+	CompletionTokens int64  `json:"completion_tokens"`
+	TotalTokens      int64  `json:"total_tokens"`
+	LatencyP50Ms     int64  `json:"latency_p50_ms"`
+	LatencyP90Ms     int64  `json:"latency_p90_ms"`
+	LatencyP99Ms     int64  `json:"latency_p99_ms"`
+
+	latencies []int64
+}
+
+// Report 扫描账本，按查询条件过滤并分组汇总，结果按时间桶与分组维度排序
+func (l *Ledger) Report(q Query) ([]Row, error) {
+	groups := make(map[rowKey]*Row)
+	err := l.Scan(func(r Record) error {
+		if r.Time.Before(q.Start) || !r.Time.Before(q.End) {
+			return nil
+		}
+		if q.KeyID != "" && r.KeyID != q.KeyID {
+			return nil
+		}
+		k := q.groupKey(r)
+		row, ok := groups[k]
+		if !ok {
+			row = &Row{Bucket: k.bucket, KeyID: k.keyID, Model: k.model, Account: k.account}
+			groups[k] = row
+		}
+		row.Requests++
+		if r.Status >= 400 {
+			row.Errors++
+		}
+		row.PromptTokens += int64(r.PromptTokens)
+		row.CompletionTokens += int64(r.CompletionTokens)
+		row.TotalTokens += int64(r.TotalTokens)
+		row.latencies = append(row.latencies, r.LatencyMs)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	rows := make([]Row, 0, len(groups))
+	for _, row := range groups {
+		slices.Sort(row.latencies)
+		row.LatencyP50Ms = percentile(row.latencies, 50)
+		row.LatencyP90Ms = percentile(row.latencies, 90)
+		row.LatencyP99Ms = percentile(row.latencies, 99)
+		row.latencies = nil
+		rows = append(rows, *row)
+	}
+	slices.SortFunc(rows, func(a, b Row) int {
+		return strings.Compare(a.Bucket+"\x00"+a.KeyID+"\x00"+a.Model+"\x00"+a.Account,
+			b.Bucket+"\x00"+b.KeyID+"\x00"+b.Model+"\x00"+b.Account)
+	})
+	return rows, nil
+}
+
+// rowKey 报表一行的分组维度取值，未参与分组的维度为空
+type rowKey struct {
+	bucket  string
+	keyID   string
+	model   string
+	account string
+}
+
+// groupKey 返回记录所属的分组
+func (q Query) groupKey(r Record) rowKey {
+	var k rowKey
+	t := r.Time.Local()
+	switch q.Bucket {
+	case "hour":
+		k.bucket = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, t.Location()).Format(time.RFC3339)
+	case "day":
+		k.bucket = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location()).Format(time.RFC3339)
+	}
+	for _, d := range q.GroupBy {
+		switch d {
+		case GroupByKey:
+			k.keyID = r.KeyID
+		case GroupByModel:
+			k.model = r.Model
+		case GroupByAccount:
+			k.account = r.Account
+		}
+	}
+	return k
+}
+
+// percentile 按最近秩法返回已排序数据的 p 分位数
+func percentile(sorted []int64, p int) int64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// WriteCSV 以 CSV 输出报表，第一行为表头
+func WriteCSV(w io.Writer, rows []Row) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{
+		"bucket", "key_id", "model", "account", "requests", "errors",
+		"prompt_tokens", "completion_tokens", "total_tokens",
+		"latency_p50_ms", "latency_p90_ms", "latency_p99_ms",
+	})
+	for _, r := range rows {
+		cw.Write([]string{
+			r.Bucket, r.KeyID, r.Model, r.Account,
+			strconv.FormatInt(r.Requests, 10), strconv.FormatInt(r.Errors, 10),
+			strconv.FormatInt(r.PromptTokens, 10), strconv.FormatInt(r.CompletionTokens, 10), strconv.FormatInt(r.TotalTokens, 10),
+			strconv.FormatInt(r.LatencyP50Ms, 10), strconv.FormatInt(r.LatencyP90Ms, 10), strconv.FormatInt(r.LatencyP99Ms, 10),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
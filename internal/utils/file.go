@@ -0,0 +1,12 @@
+package utils
+
+import "os"
+
+// WriteFileAtomic 先写临时文件再重命名，避免写入中途失败损坏原文件，文件仅所有者可读写
+func WriteFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -1,17 +1,37 @@
 package utils
 
 import (
+	crand "crypto/rand"
 	"math/rand/v2"
 )
 
+const letters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
 // RandStringUsingMathRand 生成指定长度的随机字符串
 // 使用 math/rand/v2 减少锁竞争，提升高并发下的性能
 func RandStringUsingMathRand(n int) string {
-	const letters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
-
 	result := make([]byte, n)
 	for i := range result {
 		result[i] = letters[rand.IntN(len(letters))]
 	}
 	return string(result)
 }
+
+// RandStringSecure 使用安全随机数生成指定长度的随机字符串，用于客户端可以凭其访问数据的 ID
+func RandStringSecure(n int) string {
+	// 丢弃大于 letters 长度整数倍的字节，保证每个字符等概率
+	const limit = 256 - 256%len(letters)
+	result := make([]byte, 0, n)
+	buf := make([]byte, n)
+	for len(result) < n {
+		if _, err := crand.Read(buf); err != nil {
+			panic(err)
+		}
+		for _, b := range buf {
+			if int(b) < limit && len(result) < n {
+				result = append(result, letters[int(b)%len(letters)])
+			}
+		}
+	}
+	return string(result)
+}
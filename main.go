@@ -1,18 +1,54 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"flag"
 	"fmt"
 	"github.com/labstack/echo/v4"
-	"github.com/labstack/echo/v4/middleware"
+	echomw "github.com/labstack/echo/v4/middleware"
 	"log"
+	"monica-proxy/internal/account"
+	"monica-proxy/internal/apikey"
 	"monica-proxy/internal/apiserver"
 	"monica-proxy/internal/config"
+	"monica-proxy/internal/credstore"
+	"monica-proxy/internal/jwtauth"
+	"monica-proxy/internal/middleware"
+	"monica-proxy/internal/monica"
+	"monica-proxy/internal/usage"
+	"monica-proxy/internal/utils"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 )
 
 func main() {
+	// creds 子命令：管理加密凭据库
+	if len(os.Args) > 1 && os.Args[1] == "creds" {
+		if err := credstore.RunCLI(config.LoadConfig(), os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	// keys 子命令：管理 API 密钥
+	if len(os.Args) > 1 && os.Args[1] == "keys" {
+		cfg := config.LoadConfig()
+		creds, err := openCredStore(cfg)
+		if err != nil {
+			log.Fatal(err)
+		}
+		quotas, err := usage.LoadQuotaConfig(cfg.QuotaFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := apikey.RunCLI(keyBackend(cfg, creds), quotas, os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	// 定义命令行参数
 	port := flag.Int("p", 8080, "服务器监听端口")
 	host := flag.String("h", "0.0.0.0", "服务器监听地址")
@@ -26,6 +62,8 @@ func main() {
 		fmt.Println("选项:")
 		flag.PrintDefaults()
 		fmt.Println("\n示例: ./monica-proxy -p 8080 -c \"cookie\" -k \"token\" -i=false")
+		fmt.Println("管理加密凭据库: ./monica-proxy creds help")
+		fmt.Println("管理 API 密钥: ./monica-proxy keys help")
 	}
 
 	// 解析命令行参数
@@ -43,17 +81,92 @@ func main() {
 	cfg.IsIncognito = *isIncognito
 	cfg.Debug = *debug
 
+	// 全局上游代理，账号可以单独配置代理覆盖
+	if err := utils.SetDefaultProxy(cfg.UpstreamProxy); err != nil {
+		log.Fatalf("upstream proxy error: %v", err)
+	}
+
+	// 加密凭据库中的账号与 API 密钥
+	creds, err := openCredStore(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var stores []account.Backend
+	if creds != nil {
+		stores = append(stores, creds.Accounts())
+	}
+
+	// API 密钥：BEARER_TOKEN 与 ADMIN_TOKEN 作为内置密钥，其余来自凭据库或 API_KEYS_FILE
+	keys := apikey.NewStore(keyBackend(cfg, creds))
+	if cfg.AdminToken != "" {
+		if err := keys.AddBuiltin("admin_token", cfg.AdminToken, apikey.ScopeAdmin); err != nil {
+			log.Fatalf("load api keys error: %v", err)
+		}
+		err = keys.AddBuiltin("bearer_token", cfg.BearerToken, apikey.ScopeChat, apikey.ScopeImages)
+	} else {
+		err = keys.AddBuiltin("bearer_token", cfg.BearerToken, apikey.AllScopes...)
+	}
+	if err != nil {
+		log.Fatalf("load api keys error: %v", err)
+	}
+	if err := keys.Load(); err != nil {
+		log.Fatalf("load api keys error: %v", err)
+	}
+	if path := keyFile(cfg, creds); path != "" {
+		keys.Watch(context.Background(), path, apikey.WatchInterval)
+	}
+	apikey.DefaultStore = keys
+
+	// 用量账本与 token 配额
+	quotas, err := usage.LoadQuotaConfig(cfg.QuotaFile)
+	if err != nil {
+		log.Fatalf("load quota config error: %v", err)
+	}
+	ledger, err := usage.OpenLedger(cfg.UsageLedgerFile, quotas)
+	if err != nil {
+		log.Fatalf("open usage ledger error: %v", err)
+	}
+	usage.DefaultLedger = ledger
+	if cfg.UsageLedgerFile == "" && quotasConfigured(quotas, keys) {
+		log.Printf("Warning: token quotas are configured but USAGE_LEDGER_FILE is not set, usage is kept in memory and quotas reset on restart")
+	}
+
+	// JWT 认证：网关签发的令牌按策略规则映射为与 API 密钥相同的权限与限制
+	var jwks *jwtauth.KeySet
+	if cfg.JWTSecret != "" || cfg.JWTJWKSFile != "" {
+		validator, keySet, err := loadJWTValidator(cfg, quotas)
+		if err != nil {
+			log.Fatalf("load jwt config error: %v", err)
+		}
+		jwtauth.Default, jwks = validator, keySet
+	}
+	reloadOnSIGHUP(keys, jwks)
+
 	// 检查必要的配置
-	if cfg.MonicaCookie == "" {
-		log.Fatal("Monica Cookie is required. Please set it via -c flag or MONICA_COOKIE environment variable")
+	if cfg.MonicaCookie == "" && len(cfg.MonicaCookies) == 0 && cfg.AccountsFile == "" && cfg.CredStoreFile == "" {
+		log.Fatal("Monica Cookie is required. Please set it via -c flag, MONICA_COOKIE / MONICA_COOKIES environment variable, MONICA_ACCOUNTS_FILE or CREDSTORE_FILE")
+	}
+	if keys.Len() == 0 && jwtauth.Default == nil {
+		log.Fatal("API key is required. Please set it via -k flag, BEARER_TOKEN environment variable or add one with ./monica-proxy keys add")
+	}
+
+	pool, err := account.LoadPool(cfg, stores...)
+	if err != nil {
+		log.Fatalf("load monica accounts error: %v", err)
 	}
-	if cfg.BearerToken == "" {
-		log.Fatal("Bearer Token is required. Please set it via -k flag or BEARER_TOKEN environment variable")
+	// 后台定期探测账号，失效与冷却中的账号不参与选择
+	pool.StartHealthCheck(context.Background(), cfg.HealthCheckInterval, monica.ProbeAccount)
+	// cookie 即将过期时输出日志并通知 webhook
+	var notify account.ExpiryNotifier
+	if cfg.ExpiryWebhookURL != "" {
+		notify = account.ExpiryWebhook(cfg.ExpiryWebhookURL)
 	}
+	pool.StartExpiryCheck(context.Background(), notify)
 
 	e := echo.New()
+	// 访问日志隐藏查询参数中的 API 密钥
 	e.Use(middleware.Logger())
-	e.Use(middleware.Recover())
+	e.Use(echomw.Recover())
 	// 注册路由
 	apiserver.RegisterRoutes(e)
 
@@ -61,7 +174,115 @@ func main() {
 	addr := fmt.Sprintf("%s:%d", *host, *port)
 	log.Printf("Server starting on %s", addr)
 	log.Printf("Incognito mode: %v", cfg.IsIncognito)
+	log.Printf("API keys: %d", keys.Len())
+	if jwtauth.Default != nil {
+		log.Printf("JWT auth enabled, issuer: %q, audience: %v", cfg.JWTIssuer, cfg.JWTAudience)
+	}
+	if cfg.UsageLedgerFile != "" {
+		log.Printf("Usage ledger: %s", cfg.UsageLedgerFile)
+	}
+	if cfg.UpstreamProxy != "" {
+		log.Printf("Upstream proxy: %s", utils.RedactProxy(cfg.UpstreamProxy))
+	}
+	log.Printf("Monica accounts: %d, strategy: %s, health check interval: %s, sticky ttl: %s", len(pool.Accounts()), pool.Strategy(), cfg.HealthCheckInterval, cfg.StickyTTL)
+	log.Printf("Concurrency: global %d, per account %d, queue size %d, queue timeout %s", cfg.MaxConcurrency, cfg.AccountMaxConcurrency, cfg.QueueSize, cfg.QueueTimeout)
 	if err := e.Start(addr); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		log.Fatalf("start server error: %v", err)
 	}
 }
+
+// openCredStore 打开加密凭据库，未配置 CREDSTORE_FILE 时返回 nil
+func openCredStore(cfg *config.Config) (*credstore.Store, error) {
+	if cfg.CredStoreFile == "" {
+		return nil, nil
+	}
+	store, err := credstore.Open(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("open credential store error: %v", err)
+	}
+	// 启动时校验主密钥与文件内容
+	if _, err := store.Load(); err != nil {
+		return nil, fmt.Errorf("load credential store error: %v", err)
+	}
+	return store, nil
+}
+
+// quotasConfigured 返回是否配置了默认配额或有密钥设置了配额
+func quotasConfigured(quotas *usage.QuotaConfig, keys *apikey.Store) bool {
+	if len(quotas.Default) > 0 {
+		return true
+	}
+	for _, k := range keys.List() {
+		if len(k.Quotas) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// reloadOnSIGHUP 收到 SIGHUP 时重新加载 API 密钥与 JWKS（未配置时为 nil），新文件无法解析时保留之前的内容
+func reloadOnSIGHUP(keys *apikey.Store, jwks *jwtauth.KeySet) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			if err := keys.Load(); err != nil {
+				log.Printf("reload api keys failed, keeping previous keys: %v", err)
+			} else {
+				log.Printf("Reloaded api keys: %d keys", keys.Len())
+			}
+			if jwks == nil {
+				continue
+			}
+			if err := jwks.Reload(); err != nil {
+				log.Printf("reload jwks failed, keeping previous keys: %v", err)
+				continue
+			}
+			log.Printf("Reloaded jwks %s: %d keys", jwks.Path(), jwks.Len())
+		}
+	}()
+}
+
+// loadJWTValidator 创建 JWT 校验器，返回配置了 JWKS 文件时的公钥集合，文件修改后自动重新加载公钥
+func loadJWTValidator(cfg *config.Config, quotas *usage.QuotaConfig) (*jwtauth.Validator, *jwtauth.KeySet, error) {
+	rules, err := jwtauth.LoadRules(cfg.JWTPolicyFile, quotas)
+	if err != nil {
+		return nil, nil, err
+	}
+	opts := jwtauth.Options{
+		Secret:       []byte(cfg.JWTSecret),
+		Issuer:       cfg.JWTIssuer,
+		Audience:     cfg.JWTAudience,
+		SubjectClaim: cfg.JWTSubjectClaim,
+		GroupsClaim:  cfg.JWTGroupsClaim,
+		Leeway:       cfg.JWTLeeway,
+		Rules:        rules,
+	}
+	if cfg.JWTJWKSFile != "" {
+		if opts.Keys, err = jwtauth.LoadKeySet(cfg.JWTJWKSFile); err != nil {
+			return nil, nil, err
+		}
+		opts.Keys.Watch(context.Background(), jwtauth.WatchInterval)
+	}
+	validator, err := jwtauth.New(opts)
+	return validator, opts.Keys, err
+}
+
+// keyFile 返回 API 密钥所在的文件，用于检查修改后重新加载，未配置时返回空字符串
+func keyFile(cfg *config.Config, creds *credstore.Store) string {
+	if creds != nil {
+		return cfg.CredStoreFile
+	}
+	return cfg.APIKeysFile
+}
+
+// keyBackend 返回 API 密钥的持久化来源：优先使用加密凭据库，其次是 API_KEYS_FILE，都未配置时返回 nil
+func keyBackend(cfg *config.Config, creds *credstore.Store) apikey.Backend {
+	if creds != nil {
+		return creds.APIKeys()
+	}
+	if cfg.APIKeysFile != "" {
+		return &apikey.FileBackend{Path: cfg.APIKeysFile}
+	}
+	return nil
+}